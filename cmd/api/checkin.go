@@ -0,0 +1,216 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/AbrahamMayowa/ticketmania/internal/data"
+	"github.com/AbrahamMayowa/ticketmania/internal/validator"
+)
+
+// checkInHandler validates a scanned ticket code and admits the ticket to the
+// event. Only the event's organizer can check tickets in.
+func (app *application) checkInHandler(w http.ResponseWriter, r *http.Request) {
+	event, ok := app.readOwnedEvent(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Code     string `json:"code"`
+		DeviceID string `json:"device_id"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.DeviceID == "" {
+		input.DeviceID = "online"
+	}
+
+	v := validator.New()
+	v.Check(input.Code != "", "code", "must be provided")
+	v.Check(len(input.DeviceID) <= 100, "device_id", "must not be more than 100 bytes")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	ticketID, codeEventID, err := app.parseScannedCode(input.Code)
+	if err != nil {
+		v.AddError("code", "is not a valid ticket code")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if codeEventID != event.ID {
+		app.errorResponse(w, r, http.StatusUnprocessableEntity, data.ErrTicketWrongEvent.Error())
+		return
+	}
+
+	ticket, err := app.models.Tickets.CheckIn(r.Context(), ticketID, event.ID, input.DeviceID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrTicketWrongEvent):
+			app.errorResponse(w, r, http.StatusUnprocessableEntity, err.Error())
+		case errors.Is(err, data.ErrTicketAlreadyUsed):
+			app.conflictResponse(w, r, err, fmt.Sprintf("%s at %s", err, ticket.UsedAt.Format(time.RFC3339)))
+		case errors.Is(err, data.ErrTicketCancelled), errors.Is(err, data.ErrTicketNotPaid):
+			app.conflictResponse(w, r, err, err.Error())
+		default:
+			app.serverErrorResponse(w, r, err, input)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"data": ticket}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// checkInManifestHandler lets a scanner download the event's tickets changed
+// since its last sync. Start with since=0 and pass next_cursor back until
+// has_more is false; later syncs start from the last next_cursor.
+func (app *application) checkInManifestHandler(w http.ResponseWriter, r *http.Request) {
+	event, ok := app.readOwnedEvent(w, r)
+	if !ok {
+		return
+	}
+
+	qs := r.URL.Query()
+	v := validator.New()
+
+	since := qs.Get("since")
+	if since == "" {
+		since = data.ManifestStart
+	}
+
+	limit := app.readInt(qs, "limit", 500)
+	v.Check(limit > 0 && limit <= 1000, "limit", "must be between 1 and 1000")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	manifest, err := app.models.CheckIns.Manifest(r.Context(), event.ID, since, limit)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrInvalidCursor):
+			app.failedValidationResponse(w, r, map[string]string{"since": "must be a cursor returned by a previous sync"})
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"data": manifest}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// maxSyncScans caps how many scans one upload may carry.
+const maxSyncScans = 500
+
+// checkInSyncHandler reconciles a batch of scans a device made while offline.
+// Results are returned in the same order as the uploaded scans.
+func (app *application) checkInSyncHandler(w http.ResponseWriter, r *http.Request) {
+	event, ok := app.readOwnedEvent(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		DeviceID string `json:"device_id"`
+		Scans    []struct {
+			Code      string    `json:"code"`
+			TicketID  *int64    `json:"ticket_id"`
+			ScannedAt time.Time `json:"scanned_at"`
+		} `json:"scans"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.DeviceID != "", "device_id", "must be provided")
+	v.Check(len(input.DeviceID) <= 100, "device_id", "must not be more than 100 bytes")
+	v.Check(len(input.Scans) > 0, "scans", "must contain at least one scan")
+	v.Check(len(input.Scans) <= maxSyncScans, "scans", fmt.Sprintf("must not contain more than %d scans", maxSyncScans))
+
+	// Allow for scanner clocks running slightly fast
+	latest := time.Now().Add(5 * time.Minute)
+	for i, scan := range input.Scans {
+		key := fmt.Sprintf("scans[%d]", i)
+		v.Check(scan.Code != "" || scan.TicketID != nil, key, "must have a code or ticket_id")
+		v.Check(!scan.ScannedAt.IsZero(), key+".scanned_at", "must be provided")
+		v.Check(scan.ScannedAt.Before(latest), key+".scanned_at", "must not be in the future")
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	results := make([]*data.ScanOutcome, 0, len(input.Scans))
+	summary := map[data.CheckInResult]int{
+		data.CheckInAccepted:  0,
+		data.CheckInDuplicate: 0,
+		data.CheckInRejected:  0,
+	}
+
+	for _, scan := range input.Scans {
+		var (
+			outcome  *data.ScanOutcome
+			parseErr error
+		)
+
+		ticketID, eventID := int64(0), event.ID
+		if scan.TicketID != nil {
+			ticketID = *scan.TicketID
+		}
+		if scan.Code != "" {
+			ticketID, eventID, parseErr = app.parseScannedCode(scan.Code)
+		}
+
+		switch {
+		case parseErr != nil:
+			outcome = &data.ScanOutcome{Result: data.CheckInRejected, Reason: "invalid ticket code"}
+		case eventID != event.ID:
+			outcome = &data.ScanOutcome{TicketID: ticketID, Result: data.CheckInRejected, Reason: data.ErrTicketWrongEvent.Error()}
+		default:
+			outcome, err = app.models.CheckIns.RecordScan(r.Context(), event.ID, data.Scan{
+				TicketID:  ticketID,
+				DeviceID:  input.DeviceID,
+				ScannedAt: scan.ScannedAt,
+			})
+			if err != nil {
+				app.serverErrorResponse(w, r, err, input)
+				return
+			}
+		}
+
+		summary[outcome.Result]++
+		results = append(results, outcome)
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"data": envelope{"results": results, "summary": summary}}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/AbrahamMayowa/ticketmania/internal/money"
+)
+
+// listCurrenciesHandler returns the currencies tickets can be priced in.
+func (app *application) listCurrenciesHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.writeJSON(w, http.StatusOK, envelope{"data": money.Currencies()}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+}
@@ -88,3 +88,8 @@ func (app *application) requireAuthenticationResponse(w http.ResponseWriter, r *
 
 	app.errorResponse(w, r, http.StatusUnauthorized, message)
 }
+
+func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Request) {
+	message := "unable to update the record due to an edit conflict, please try again"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
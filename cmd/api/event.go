@@ -2,75 +2,212 @@ package main
 
 import (
 	"errors"
-	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/AbrahamMayowa/ticketmania/internal/data"
 	"github.com/AbrahamMayowa/ticketmania/internal/validator"
 )
 
+// eventInput is the body of a request creating an event with its ticket
+// types.
+type eventInput struct {
+	Title             string             `json:"title"`
+	Description       string             `json:"description"`
+	Location          string             `json:"location"`
+	Date              string             `json:"date"`
+	StartTime         string             `json:"start_time"`
+	EndTime           string             `json:"end_time"`
+	EndDate           string             `json:"end_date"`
+	Timezone          string             `json:"timezone"`
+	Status            *data.EventStatus  `json:"status"`
+	RefundPolicy      *data.RefundPolicy `json:"refund_policy"`
+	RefundPercent     *int               `json:"refund_percent"`
+	RefundCutoffHours *int               `json:"refund_cutoff_hours"`
+	ServiceFeeFlat    *int64             `json:"service_fee_flat"`
+	ServiceFeeBps     *int               `json:"service_fee_bps"`
+	FeesAbsorbed      *bool              `json:"fees_absorbed"`
+	TaxRateBps        *int               `json:"tax_rate_bps"`
+	VenueID           *int64             `json:"venue_id"`
+	Latitude          *float64           `json:"latitude"`
+	Longitude         *float64           `json:"longitude"`
+	TicketTypes       []struct {
+		Name        string     `json:"name"`
+		Price       int64      `json:"price"`
+		Currency    string     `json:"currency"`
+		TotalQty    int        `json:"total_qty"`
+		SalesStart  *time.Time `json:"sales_start"`
+		SalesEnd    *time.Time `json:"sales_end"`
+		MinPerOrder *int       `json:"min_per_order"`
+		MaxPerOrder *int       `json:"max_per_order"`
+		MaxPerBuyer *int       `json:"max_per_buyer"`
+	} `json:"ticket_types"`
+}
+
 func (app *application) createEventHandler(w http.ResponseWriter, r *http.Request) {
 	user := app.contextGetUser(r)
 
-	var input struct {
-		Title       string `json:"title"`
-		Description string `json:"description"`
-		Location    string `json:"location"`
-		Date        string `json:"date"`
-		StartTime   string `json:"start_time"`
-		EndTime     string `json:"end_time"`	
-		TicketTypes []struct {
-			Name     string `json:"name"`
-			Price    int64  `json:"price"`
-			Currency string `json:"currency"`
-			TotalQty int    `json:"total_qty"`
-		} `json:"ticket_types"`
-	}
+	var input eventInput
 
 	err := app.readJSON(w, r, &input)
-	fmt.Println(input)
 	if err != nil {
 		app.badRequestResponse(w, r, err)
 		return
 	}
 
+	event, ticketTypes, ok := app.newEvent(w, r, &input)
+	if !ok {
+		return
+	}
+
+	app.logger.PrintInfo("create ticket event", map[string]string{"event": event.Title, "user": strconv.FormatInt(*user.Id, 10)})
+	err = app.models.Events.InsertEvent(event, ticketTypes)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateTicketType):
+			app.conflictResponse(w, r, err, err.Error())
+		case errors.Is(err, data.ErrOverCapacity):
+			app.failedValidationResponse(w, r, map[string]string{"total_qty": err.Error()})
+		default:
+			app.serverErrorResponse(w, r, err, input)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"data": event}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+}
+
+// newEvent builds and validates the event and ticket types described by
+// input, organized by the current user. It writes the error response itself
+// and reports whether the handler should continue.
+func (app *application) newEvent(w http.ResponseWriter, r *http.Request, input *eventInput) (*data.Event, []*data.TicketType, bool) {
+	user := app.contextGetUser(r)
+
 	parsedDate, err := validator.ParseDate(input.Date)
 	if err != nil {
 		app.badRequestResponse(w, r, err)
-		return
+		return nil, nil, false
+	}
+
+	// Events end on the day they start unless told otherwise
+	endDate := parsedDate
+	if input.EndDate != "" {
+		endDate, err = validator.ParseDate(input.EndDate)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return nil, nil, false
+		}
+	}
+
+	// Events at a venue take its timezone and address unless told otherwise
+	var venue *data.Venue
+	if input.VenueID != nil {
+		var ok bool
+		venue, ok = app.readEventVenue(w, r, *input.VenueID)
+		if !ok {
+			return nil, nil, false
+		}
+	}
+
+	timezone := strings.TrimSpace(input.Timezone)
+	if timezone == "" {
+		timezone = "UTC"
+		if venue != nil {
+			timezone = venue.Timezone
+		}
+	}
+
+	location := input.Location
+	if location == "" && venue != nil {
+		location = strings.TrimSuffix(venue.Name+", "+venue.Address, ", ")
+	}
+
+	latitude, longitude := input.Latitude, input.Longitude
+	if latitude == nil && longitude == nil && venue != nil {
+		latitude, longitude = venue.Latitude, venue.Longitude
 	}
 
 	if len(input.TicketTypes) == 0 {
 		app.badRequestResponse(w, r, errors.New("At least one ticket type is required"))
-		return
+		return nil, nil, false
 	}
 
 	event := &data.Event{
-		Title:       input.Title,
-		Description: input.Description,
-		Location:    input.Location,
-		UserID:      *user.Id,
-		Status:      data.EventPublished	,
-		Date:        parsedDate,
-		StartTime: input.StartTime,
-		EndTime: input.EndTime,
+		Title:             input.Title,
+		Description:       input.Description,
+		Location:          location,
+		UserID:            *user.Id,
+		Status:            data.EventPublished,
+		Date:              parsedDate,
+		StartTime:         input.StartTime,
+		EndTime:           input.EndTime,
+		EndDate:           endDate,
+		Timezone:          timezone,
+		RefundPolicy:      data.RefundFull,
+		RefundPercent:     100,
+		RefundCutoffHours: 24,
+		VenueID:           input.VenueID,
+		Latitude:          latitude,
+		Longitude:         longitude,
+	}
+
+	if input.RefundPolicy != nil {
+		event.RefundPolicy = *input.RefundPolicy
+	}
+	if input.RefundPercent != nil {
+		event.RefundPercent = *input.RefundPercent
+	}
+	if input.RefundCutoffHours != nil {
+		event.RefundCutoffHours = *input.RefundCutoffHours
+	}
+	if input.ServiceFeeFlat != nil {
+		event.ServiceFeeFlat = *input.ServiceFeeFlat
+	}
+	if input.ServiceFeeBps != nil {
+		event.ServiceFeeBps = *input.ServiceFeeBps
+	}
+	if input.FeesAbsorbed != nil {
+		event.FeesAbsorbed = *input.FeesAbsorbed
+	}
+	if input.TaxRateBps != nil {
+		event.TaxRateBps = *input.TaxRateBps
 	}
 
 	v := validator.New()
 
+	// Events are published straight away unless created as drafts
+	if input.Status != nil {
+		v.Check(*input.Status == data.EventDraft || *input.Status == data.EventPublished, "status", "must be draft or published")
+		event.Status = *input.Status
+	}
+
 	ticketTypes := []*data.TicketType{}
 	for _, tt := range input.TicketTypes {
 		ticket := &data.TicketType{
-			Name:     tt.Name,
-			Price:    tt.Price,
-			Currency: tt.Currency,
-			TotalQty: tt.TotalQty,
+			Name:        tt.Name,
+			Price:       tt.Price,
+			Currency:    strings.ToUpper(strings.TrimSpace(tt.Currency)),
+			TotalQty:    tt.TotalQty,
+			SalesStart:  tt.SalesStart,
+			SalesEnd:    tt.SalesEnd,
+			MinPerOrder: 1,
+			MaxPerOrder: tt.MaxPerOrder,
+			MaxPerBuyer: tt.MaxPerBuyer,
+		}
+		if tt.MinPerOrder != nil {
+			ticket.MinPerOrder = *tt.MinPerOrder
 		}
 
 		if data.ValidateTicketType(v, ticket); !v.Valid() {
 			app.failedValidationResponse(w, r, v.Errors)
-			return
+			return nil, nil, false
 		}
 
 		ticketTypes = append(ticketTypes, ticket)
@@ -78,14 +215,35 @@ func (app *application) createEventHandler(w http.ResponseWriter, r *http.Reques
 
 	if data.ValidateEvent(v, event); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
+		return nil, nil, false
+	}
+
+	return event, ticketTypes, true
+}
+
+func (app *application) getEventHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
 		return
 	}
-	
 
-	app.logger.PrintInfo("create ticket event", map[string]string{"event": event.Title, "user": strconv.FormatInt(*user.Id, 10)})
-	err = app.models.Events.InsertEvent(event, ticketTypes)
+	event, err := app.models.Events.GetWithTicketTypes(r.Context(), id)
 	if err != nil {
-		app.serverErrorResponse(w, r, err, input)
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		app.notFoundResponse(w, r)
+		return
+	default:
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	}
+
+	// Drafts are only visible to their organizer
+	user := app.contextGetUser(r)
+	if event.Event.Status == data.EventDraft && (user.IsAnonymous() || event.Event.UserID != *user.Id) {
+		app.notFoundResponse(w, r)
 		return
 	}
 
@@ -94,27 +252,280 @@ func (app *application) createEventHandler(w http.ResponseWriter, r *http.Reques
 		app.serverErrorResponse(w, r, err)
 		return
 	}
+}
+
+// listEventsHandler lists events, published ones with tickets left by
+// default, narrowed and sorted by the query string. Drafts are only listed
+// to their organizer.
+func (app *application) listEventsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	qs := r.URL.Query()
+	v := validator.New()
 
+	filters := data.EventFilters{
+		Query:          strings.TrimSpace(qs.Get("q")),
+		From:           app.readOptionalDate(qs, "from", v),
+		To:             app.readOptionalDate(qs, "to", v),
+		Location:       strings.TrimSpace(qs.Get("location")),
+		MinPrice:       app.readOptionalInt64(qs, "min_price", v),
+		MaxPrice:       app.readOptionalInt64(qs, "max_price", v),
+		Currency:       strings.ToUpper(strings.TrimSpace(qs.Get("currency"))),
+		OrganizerID:    app.readOptionalInt64(qs, "organizer_id", v),
+		Near:           app.readGeoPoint(qs, "near", v),
+		IncludeSoldOut: app.readBool(qs, "include_sold_out", false, v),
+		Sort:           qs.Get("sort"),
+		PerPage:        app.readInt(qs, "limit", 20),
+		After:          qs.Get("after"),
+		Page:           app.readInt(qs, "page", 1),
+	}
+	v.Check(filters.After == "" || qs.Get("page") == "", "page", "cannot be used with after")
+	if filters.Near != nil {
+		filters.RadiusKm = 25
+	}
+	if radius := app.readOptionalFloat(qs, "radius_km", v); radius != nil {
+		filters.RadiusKm = *radius
+	}
+	if filters.Sort == "" {
+		switch {
+		case filters.Query != "":
+			filters.Sort = data.SortByRelevance
+		case filters.Near != nil:
+			filters.Sort = data.SortByDistance
+		default:
+			filters.Sort = data.SortByDate
+		}
+	}
+	for _, status := range app.readCSV(qs, "status") {
+		filters.Statuses = append(filters.Statuses, data.EventStatus(status))
+		if data.EventStatus(status) == data.EventDraft {
+			ownDrafts := filters.OrganizerID != nil && !user.IsAnonymous() && *filters.OrganizerID == *user.Id
+			v.Check(ownDrafts, "status", "drafts can only be listed by their organizer, with organizer_id set to your id")
+		}
+	}
+
+	if data.ValidateEventFilters(v, &filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	events, err := app.models.Events.GetEventList(r.Context(), filters)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrInvalidCursor):
+			app.failedValidationResponse(w, r, map[string]string{"after": err.Error()})
+		default:
+			app.serverErrorResponse(w, r, err, qs)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"event": events}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
 }
 
-func (app *application) getEventHandler(w http.ResponseWriter, r *http.Request) {
+// readOwnedEvent loads the event named by the :id parameter and checks that
+// the current user organizes it. It writes the error response itself and
+// reports whether the handler should continue.
+func (app *application) readOwnedEvent(w http.ResponseWriter, r *http.Request) (*data.Event, bool) {
+	user := app.contextGetUser(r)
+
 	id, err := app.readIDParam(r)
 	if err != nil {
 		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	event, err := app.models.Events.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	if user.IsAnonymous() || event.UserID != *user.Id {
+		app.forbiddenResponse(w, r)
+		return nil, false
+	}
+
+	return event, true
+}
+
+// eventPatch is the body of a partial event update. Fields left out stay
+// as they are.
+type eventPatch struct {
+	Title             *string            `json:"title"`
+	Description       *string            `json:"description"`
+	Location          *string            `json:"location"`
+	Date              *string            `json:"date"`
+	StartTime         *string            `json:"start_time"`
+	EndTime           *string            `json:"end_time"`
+	EndDate           *string            `json:"end_date"`
+	Timezone          *string            `json:"timezone"`
+	RefundPolicy      *data.RefundPolicy `json:"refund_policy"`
+	RefundPercent     *int               `json:"refund_percent"`
+	RefundCutoffHours *int               `json:"refund_cutoff_hours"`
+	ServiceFeeFlat    *int64             `json:"service_fee_flat"`
+	ServiceFeeBps     *int               `json:"service_fee_bps"`
+	FeesAbsorbed      *bool              `json:"fees_absorbed"`
+	TaxRateBps        *int               `json:"tax_rate_bps"`
+	VenueID           nullableInt64      `json:"venue_id"`
+	Latitude          nullableFloat64    `json:"latitude"`
+	Longitude         nullableFloat64    `json:"longitude"`
+	Version           *int               `json:"version"`
+}
+
+// apply copies the fields set in input to event. It fails on malformed
+// dates.
+func (input *eventPatch) apply(event *data.Event) error {
+	var err error
+
+	if input.Title != nil {
+		event.Title = *input.Title
+	}
+	if input.Description != nil {
+		event.Description = *input.Description
+	}
+	if input.Location != nil {
+		event.Location = *input.Location
+	}
+	if input.Date != nil {
+		previous := event.Date
+		event.Date, err = validator.ParseDate(*input.Date)
+		if err != nil {
+			return err
+		}
+		// Moving the start date moves the end date with it, keeping the
+		// event's length, unless a new end date is sent too
+		if input.EndDate == nil {
+			days := int(event.Date.Sub(previous).Hours() / 24)
+			event.EndDate = event.EndDate.AddDate(0, 0, days)
+		}
+	}
+	if input.EndDate != nil {
+		event.EndDate, err = validator.ParseDate(*input.EndDate)
+		if err != nil {
+			return err
+		}
+	}
+	if input.StartTime != nil {
+		event.StartTime = *input.StartTime
+	}
+	if input.EndTime != nil {
+		event.EndTime = *input.EndTime
+	}
+	if input.Timezone != nil {
+		event.Timezone = strings.TrimSpace(*input.Timezone)
+	}
+	if input.RefundPolicy != nil {
+		event.RefundPolicy = *input.RefundPolicy
+	}
+	if input.RefundPercent != nil {
+		event.RefundPercent = *input.RefundPercent
+	}
+	if input.RefundCutoffHours != nil {
+		event.RefundCutoffHours = *input.RefundCutoffHours
+	}
+	if input.ServiceFeeFlat != nil {
+		event.ServiceFeeFlat = *input.ServiceFeeFlat
+	}
+	if input.ServiceFeeBps != nil {
+		event.ServiceFeeBps = *input.ServiceFeeBps
+	}
+	if input.FeesAbsorbed != nil {
+		event.FeesAbsorbed = *input.FeesAbsorbed
+	}
+	if input.TaxRateBps != nil {
+		event.TaxRateBps = *input.TaxRateBps
+	}
+	if input.VenueID.Set {
+		event.VenueID = input.VenueID.Value
+	}
+	if input.Latitude.Set {
+		event.Latitude = input.Latitude.Value
+	}
+	if input.Longitude.Set {
+		event.Longitude = input.Longitude.Value
+	}
+
+	return nil
+}
+
+// moveToVenue gives event the coordinates of the venue it moves to, unless
+// input sets its own.
+func (input *eventPatch) moveToVenue(event *data.Event, venue *data.Venue) {
+	if !input.Latitude.Set && !input.Longitude.Set && venue.Latitude != nil {
+		event.Latitude, event.Longitude = venue.Latitude, venue.Longitude
+	}
+}
+
+// updateEventHandler applies a partial update to an event that is not
+// cancelled or completed. Clients must send the version they last read; the
+// update is refused with 409 if the event has changed since. In a series, only
+// this occurrence changes.
+func (app *application) updateEventHandler(w http.ResponseWriter, r *http.Request) {
+	event, ok := app.readEditableEvent(w, r)
+	if !ok {
 		return
 	}
 
-	event, err := app.models.Events.GetWithTicketTypes(r.Context(), id)
+	var input eventPatch
+
+	err := app.readJSON(w, r, &input)
 	if err != nil {
-	switch {
-	case errors.Is(err, data.ErrRecordNotFound):
-		app.notFoundResponse(w, r)
+		app.badRequestResponse(w, r, err)
 		return
-	default:
-		app.serverErrorResponse(w, r, err)
+	}
+
+	v := validator.New()
+	if v.Check(input.Version != nil, "version", "must be provided"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if *input.Version != event.Version {
+		app.editConflictResponse(w, r)
+		return
+	}
+
+	err = input.apply(event)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.VenueID.Value != nil {
+		venue, ok := app.readEventVenue(w, r, *input.VenueID.Value)
+		if !ok {
+			return
+		}
+		input.moveToVenue(event, venue)
+	}
+
+	if data.ValidateEvent(v, event); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
+
+	err = app.models.Events.Update(r.Context(), event)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrOverCapacity):
+			app.failedValidationResponse(w, r, map[string]string{"venue_id": err.Error()})
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
 	}
+
 	err = app.writeJSON(w, http.StatusOK, envelope{"data": event}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -122,29 +533,122 @@ func (app *application) getEventHandler(w http.ResponseWriter, r *http.Request)
 	}
 }
 
-func (app *application) listEventsHandler(w http.ResponseWriter, r *http.Request) {
-	qs := r.URL.Query()
-
-	perPage := app.readInt(qs, "limit", 20)
-	page := app.readInt(qs, "page", 1)
-	offset := (page - 1) * perPage
+// deleteEventHandler removes an event that has not sold any tickets.
+func (app *application) deleteEventHandler(w http.ResponseWriter, r *http.Request) {
+	event, ok := app.readOwnedEvent(w, r)
+	if !ok {
+		return
+	}
 
-	events, err := app.models.Events.GetEventList(r.Context(), perPage, offset)
+	err := app.models.Events.Delete(r.Context(), event.ID)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
-			app.notFoundResponse(w,r)
-			return; 
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrEventHasSales):
+			app.conflictResponse(w, r, err, err.Error())
 		default:
-			app.serverErrorResponse(w, r, err, map[string]string{"page": strconv.Itoa(perPage), "offset": strconv.Itoa(offset)})
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "event successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+func (app *application) publishEventHandler(w http.ResponseWriter, r *http.Request) {
+	event, ok := app.readOwnedEvent(w, r)
+	if !ok {
+		return
+	}
+
+	event, err := app.models.Events.Publish(r.Context(), event.ID)
+	if err != nil {
+		app.eventTransitionErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"data": event}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+func (app *application) completeEventHandler(w http.ResponseWriter, r *http.Request) {
+	event, ok := app.readOwnedEvent(w, r)
+	if !ok {
+		return
+	}
+
+	event, err := app.models.Events.Complete(r.Context(), event.ID)
+	if err != nil {
+		app.eventTransitionErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"data": event}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// cancelEventHandler stops sales for an event, cancels every paid ticket with
+// a full refund and emails the buyers.
+func (app *application) cancelEventHandler(w http.ResponseWriter, r *http.Request) {
+	event, ok := app.readOwnedEvent(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Reason string `json:"reason"`
+	}
+
+	// The body is optional
+	if r.ContentLength != 0 {
+		err := app.readJSON(w, r, &input)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
 			return
 		}
-		
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"event": events}, nil)
+	v := validator.New()
+	if v.Check(len(input.Reason) <= 500, "reason", "must not be more than 500 bytes"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	event, refunds, err := app.models.Events.Cancel(r.Context(), event.ID, *user.Id, input.Reason)
+	if err != nil {
+		app.eventTransitionErrorResponse(w, r, err)
+		return
+	}
+
+	app.settleRefunds(r.Context(), event, refunds, "event_cancelled.tmpl")
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"data": event, "refunds": refunds}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 }
+
+func (app *application) eventTransitionErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		app.notFoundResponse(w, r)
+	case errors.Is(err, data.ErrInvalidEventTransition):
+		app.conflictResponse(w, r, err, err.Error())
+	default:
+		app.serverErrorResponse(w, r, err)
+	}
+}
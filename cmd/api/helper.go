@@ -6,9 +6,15 @@ import (
 	"fmt"
 	"github.com/julienschmidt/httprouter"
 	"io"
+	"math"
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AbrahamMayowa/ticketmania/internal/data"
+	"github.com/AbrahamMayowa/ticketmania/internal/validator"
 )
 
 type envelope map[string]interface{}
@@ -67,11 +73,16 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst int
 }
 
 func (app *application) readIDParam(r *http.Request) (int64, error) {
+	return app.readNamedIDParam(r, "id")
+}
+
+// readNamedIDParam reads a positive id from the named route parameter, for
+// routes with more than one id.
+func (app *application) readNamedIDParam(r *http.Request, name string) (int64, error) {
 	// Extract params from httprouter context
 	params := httprouter.ParamsFromContext(r.Context())
 
-	// Get the "id" parameter
-	idStr := params.ByName("id")
+	idStr := params.ByName(name)
 	if idStr == "" {
 		return 0, errors.New("invalid id parameter")
 	}
@@ -99,6 +110,100 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int) int
 	return i
 }
 
+// readOptionalInt64 reads an integer query parameter. A malformed value is
+// recorded in v and nil returned, as it is for a missing one.
+func (app *application) readOptionalInt64(qs url.Values, key string, v *validator.Validator) *int64 {
+	s := qs.Get(key)
+	if s == "" {
+		return nil
+	}
+
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		v.AddError(key, "must be an integer value")
+		return nil
+	}
+
+	return &i
+}
+
+// readOptionalDate reads a YYYY-MM-DD query parameter the same way.
+func (app *application) readOptionalDate(qs url.Values, key string, v *validator.Validator) *time.Time {
+	s := qs.Get(key)
+	if s == "" {
+		return nil
+	}
+
+	d, err := validator.ParseDate(s)
+	if err != nil {
+		v.AddError(key, err.Error())
+		return nil
+	}
+
+	return &d
+}
+
+func (app *application) readBool(qs url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be true or false")
+		return defaultValue
+	}
+
+	return b
+}
+
+// readCSV reads a comma separated query parameter, dropping empty values.
+func (app *application) readCSV(qs url.Values, key string) []string {
+	values := []string{}
+	for _, s := range strings.Split(qs.Get(key), ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			values = append(values, s)
+		}
+	}
+	return values
+}
+
+// readOptionalFloat reads a decimal query parameter the same way as
+// readOptionalInt64.
+func (app *application) readOptionalFloat(qs url.Values, key string, v *validator.Validator) *float64 {
+	s := qs.Get(key)
+	if s == "" {
+		return nil
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		v.AddError(key, "must be a number")
+		return nil
+	}
+
+	return &f
+}
+
+// readGeoPoint reads a "latitude,longitude" query parameter the same way.
+func (app *application) readGeoPoint(qs url.Values, key string, v *validator.Validator) *data.GeoPoint {
+	s := qs.Get(key)
+	if s == "" {
+		return nil
+	}
+
+	lat, lng, ok := strings.Cut(s, ",")
+	latitude, latErr := strconv.ParseFloat(strings.TrimSpace(lat), 64)
+	longitude, lngErr := strconv.ParseFloat(strings.TrimSpace(lng), 64)
+	if !ok || latErr != nil || lngErr != nil || math.IsNaN(latitude) || math.IsNaN(longitude) {
+		v.AddError(key, "must be a latitude and longitude, such as 6.4253,3.4095")
+		return nil
+	}
+
+	return &data.GeoPoint{Latitude: latitude, Longitude: longitude}
+}
+
 func (app *application) background(fn func()) {
 	// Increment the WaitGroup counter.
 	app.wg.Add(1)
@@ -114,3 +219,89 @@ func (app *application) background(fn func()) {
 		fn()
 	}()
 }
+
+// nullableTime is a PATCH field that tells a missing value apart from an
+// explicit null, which clears the stored time.
+type nullableTime struct {
+	Set   bool
+	Value *time.Time
+}
+
+func (n *nullableTime) UnmarshalJSON(b []byte) error {
+	n.Set = true
+	if string(b) == "null" {
+		n.Value = nil
+		return nil
+	}
+
+	var t time.Time
+	if err := json.Unmarshal(b, &t); err != nil {
+		return err
+	}
+	n.Value = &t
+	return nil
+}
+
+// nullableInt is the integer counterpart of nullableTime.
+type nullableInt struct {
+	Set   bool
+	Value *int
+}
+
+func (n *nullableInt) UnmarshalJSON(b []byte) error {
+	n.Set = true
+	if string(b) == "null" {
+		n.Value = nil
+		return nil
+	}
+
+	var i int
+	if err := json.Unmarshal(b, &i); err != nil {
+		return err
+	}
+	n.Value = &i
+	return nil
+}
+
+// nullableInt64 is the int64 counterpart of nullableTime, for references such
+// as a venue that can be removed.
+type nullableInt64 struct {
+	Set   bool
+	Value *int64
+}
+
+func (n *nullableInt64) UnmarshalJSON(b []byte) error {
+	n.Set = true
+	if string(b) == "null" {
+		n.Value = nil
+		return nil
+	}
+
+	var i int64
+	if err := json.Unmarshal(b, &i); err != nil {
+		return err
+	}
+	n.Value = &i
+	return nil
+}
+
+// nullableFloat64 is the float64 counterpart of nullableTime.
+type nullableFloat64 struct {
+	Set   bool
+	Value *float64
+}
+
+func (n *nullableFloat64) UnmarshalJSON(b []byte) error {
+	n.Set = true
+	if string(b) == "null" {
+		n.Value = nil
+		return nil
+	}
+
+	var f float64
+	if err := json.Unmarshal(b, &f); err != nil {
+		return err
+	}
+	n.Value = &f
+	return nil
+}
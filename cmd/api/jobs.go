@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// reservationSweepBatch caps how many reservations a single sweep releases.
+const reservationSweepBatch = 100
+
+func (app *application) startJobs(ctx context.Context) {
+	app.runPeriodically(ctx, "release_expired_reservations", app.config.reservation.sweepInterval, app.releaseExpiredReservations)
+	app.runPeriodically(ctx, "offer_waitlist_tickets", app.config.reservation.sweepInterval, app.offerWaitlistTickets)
+	app.runPeriodically(ctx, "delete_expired_idempotency_keys", time.Hour, app.deleteExpiredIdempotencyKeys)
+}
+
+// runPeriodically calls fn every interval until ctx is cancelled. The loop runs
+// as a background task so graceful shutdown waits for an in-flight run. A run
+// that panics is logged like a failed one and the loop carries on.
+func (app *application) runPeriodically(ctx context.Context, name string, interval time.Duration, fn func(context.Context) error) {
+	app.background(func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				err := runJob(ctx, fn)
+				if err != nil && ctx.Err() == nil {
+					app.logger.PrintError(err, map[string]string{"job": name})
+				}
+			}
+		}
+	})
+}
+
+// runJob calls fn once, turning a panic into an error.
+func runJob(ctx context.Context, fn func(context.Context) error) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("job panicked: %v", p)
+		}
+	}()
+
+	return fn(ctx)
+}
+
+func (app *application) releaseExpiredReservations(ctx context.Context) error {
+	total := 0
+	for {
+		released, err := app.models.Reservations.ReleaseExpired(ctx, reservationSweepBatch)
+		if err != nil {
+			return err
+		}
+
+		total += released
+		if released > 0 {
+			app.logger.PrintInfo("released expired reservations", map[string]string{"count": strconv.Itoa(released)})
+		}
+
+		// A short batch means there is nothing left to release for now. The
+		// freed tickets are offered to the waitlist before anyone else
+		if released < reservationSweepBatch {
+			if total > 0 {
+				return app.offerWaitlistTickets(ctx)
+			}
+			return nil
+		}
+	}
+}
+
+func (app *application) deleteExpiredIdempotencyKeys(ctx context.Context) error {
+	deleted, err := app.models.Idempotency.DeleteExpired(ctx, idempotencyKeyTTL)
+	if err != nil {
+		return err
+	}
+
+	if deleted > 0 {
+		app.logger.PrintInfo("deleted expired idempotency keys", map[string]string{"count": strconv.FormatInt(deleted, 10)})
+	}
+
+	return nil
+}
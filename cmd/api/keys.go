@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/AbrahamMayowa/ticketmania/internal/data"
+	"github.com/AbrahamMayowa/ticketmania/pkg/ticketverify"
+)
+
+// listKeysHandler publishes the public ticket signing keys as a JWK set that
+// scanners cache to verify tickets offline.
+func (app *application) listKeysHandler(w http.ResponseWriter, r *http.Request) {
+	headers := make(http.Header)
+	headers.Set("Cache-Control", "public, max-age=300")
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"keys": app.ticketKeys.PublicKeys()}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// issueTicketCodes fills in the online code and the offline signed token of a
+// ticket that is about to be shown to its buyer.
+func (app *application) issueTicketCodes(ticket *data.Ticket) error {
+	ticket.Code = app.ticketCodes.Code(ticket.ID, *ticket.EventID)
+
+	payload := ticketverify.Payload{
+		TicketID:     ticket.ID,
+		EventID:      *ticket.EventID,
+		TicketTypeID: *ticket.TicketTypeID,
+		IssuedAt:     time.Now().Unix(),
+	}
+	if ticket.BuyerEmail != nil {
+		payload.Holder = *ticket.BuyerEmail
+	}
+
+	token, err := app.ticketKeys.Sign(payload)
+	if err != nil {
+		return err
+	}
+	ticket.SignedToken = token
+
+	return nil
+}
+
+// issueOrderTicketCodes fills in the codes of an order's paid and used tickets.
+func (app *application) issueOrderTicketCodes(order *data.Order) error {
+	for _, ticket := range order.Tickets {
+		if ticket.Admitted() {
+			if err := app.issueTicketCodes(ticket); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// parseScannedCode accepts either a ticket code or a signed ticket token and
+// returns the ticket and event it was issued for.
+func (app *application) parseScannedCode(code string) (ticketID, eventID int64, err error) {
+	if strings.HasPrefix(code, ticketverify.TokenPrefix+".") {
+		payload, err := app.ticketKeys.Verifier().Verify(code)
+		if err != nil {
+			return 0, 0, err
+		}
+		return payload.TicketID, payload.EventID, nil
+	}
+
+	ticketID, eventID, err = app.ticketCodes.Parse(code)
+	if err != nil {
+		return 0, 0, errors.New("invalid ticket code")
+	}
+	return ticketID, eventID, nil
+}
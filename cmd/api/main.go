@@ -2,11 +2,16 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
 	"database/sql"
+	"encoding/hex"
 	"fmt"
 	"github.com/AbrahamMayowa/ticketmania/internal/data"
 	"github.com/AbrahamMayowa/ticketmania/internal/jsonlog"
 	"github.com/AbrahamMayowa/ticketmania/internal/mailer"
+	"github.com/AbrahamMayowa/ticketmania/internal/payments"
+	"github.com/AbrahamMayowa/ticketmania/internal/ticketcode"
+	"github.com/AbrahamMayowa/ticketmania/internal/ticketsign"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 	"log"
@@ -14,9 +19,9 @@ import (
 	"strconv"
 	"sync"
 	"time"
+	_ "time/tzdata" // event timezones must load without system zoneinfo
 )
 
-
 type db struct {
 	dsn string
 }
@@ -28,15 +33,35 @@ type config struct {
 	jwt  struct {
 		secret string
 	}
+	ticketCodeSecret string
+	ticketSigning    struct {
+		keys      string
+		activeKey string
+	}
 	mailerConfig mailer.Config
+	reservation  struct {
+		ttl           time.Duration
+		sweepInterval time.Duration
+	}
+	waitlist struct {
+		offerTTL time.Duration
+	}
+	payments struct {
+		provider      string
+		apiKey        string
+		webhookSecret string
+	}
 }
 
 type application struct {
-	config config
-	logger *jsonlog.Logger
-	models data.Models
-	wg     sync.WaitGroup
-	mailer mailer.Mailer
+	config      config
+	logger      *jsonlog.Logger
+	models      data.Models
+	wg          sync.WaitGroup
+	mailer      mailer.Mailer
+	payments    payments.Provider
+	ticketCodes *ticketcode.Signer
+	ticketKeys  *ticketsign.KeyRing
 }
 
 func init() {
@@ -70,11 +95,24 @@ func main() {
 
 	logger.PrintInfo("database connection pool established", nil)
 
+	paymentProvider, err := newPaymentProvider(*cfg)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	ticketKeys, err := newTicketKeyRing(*cfg)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
 	app := &application{
-		config: *cfg,
-		logger: logger,
-		models: data.NewModels(db),
-		mailer: *mailer.New(cfg.mailerConfig),
+		config:      *cfg,
+		logger:      logger,
+		models:      data.NewModels(db),
+		mailer:      *mailer.New(cfg.mailerConfig),
+		payments:    paymentProvider,
+		ticketCodes: ticketcode.New(cfg.ticketCodeSecret),
+		ticketKeys:  ticketKeys,
 	}
 
 	err = app.server()
@@ -102,6 +140,54 @@ func loadConfig() (*config, error) {
 		return nil, fmt.Errorf("HASH_SECRET_KEY is required")
 	}
 
+	// Ticket codes are signed with their own secret when one is configured
+	cfg.ticketCodeSecret = getEnv("TICKET_CODE_SECRET", cfg.jwt.secret)
+
+	// Ed25519 keys for offline-verifiable tickets
+	cfg.ticketSigning.keys = os.Getenv("TICKET_SIGNING_KEYS")
+	cfg.ticketSigning.activeKey = os.Getenv("TICKET_SIGNING_ACTIVE_KEY")
+	if cfg.ticketSigning.keys == "" && cfg.env == "production" {
+		return nil, fmt.Errorf("TICKET_SIGNING_KEYS is required in production")
+	}
+
+	// Reservation configuration
+	cfg.reservation.ttl = getEnvAsDuration("RESERVATION_TTL", 15*time.Minute)
+	cfg.reservation.sweepInterval = getEnvAsDuration("RESERVATION_SWEEP_INTERVAL", time.Minute)
+
+	// Waitlist configuration
+	cfg.waitlist.offerTTL = getEnvAsDuration("WAITLIST_OFFER_TTL", time.Hour)
+
+	// Payment configuration. The fake provider marks reservations paid on any
+	// webhook signed with its secret, so production must name a real one
+	cfg.payments.provider = os.Getenv("PAYMENT_PROVIDER")
+	switch {
+	case cfg.payments.provider == "" && cfg.env == "production":
+		return nil, fmt.Errorf("PAYMENT_PROVIDER is required in production")
+	case cfg.payments.provider == "":
+		cfg.payments.provider = "fake"
+	case cfg.payments.provider == "fake" && cfg.env == "production":
+		return nil, fmt.Errorf("PAYMENT_PROVIDER=fake cannot be used in production")
+	}
+
+	cfg.payments.apiKey = os.Getenv("PAYMENT_API_KEY")
+	if cfg.payments.apiKey == "" && cfg.payments.provider != "fake" {
+		return nil, fmt.Errorf("PAYMENT_API_KEY is required")
+	}
+
+	cfg.payments.webhookSecret = os.Getenv("PAYMENT_WEBHOOK_SECRET")
+	if cfg.payments.webhookSecret == "" {
+		if cfg.payments.provider != "fake" {
+			return nil, fmt.Errorf("PAYMENT_WEBHOOK_SECRET is required")
+		}
+
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		log.Println("PAYMENT_WEBHOOK_SECRET not set, fake webhooks can only be signed with a temporary secret")
+		cfg.payments.webhookSecret = hex.EncodeToString(secret)
+	}
+
 	// Mailer configuration
 	mailerPort, err := strconv.Atoi(os.Getenv("MAILTRAP_PORT"))
 	if err != nil {
@@ -130,6 +216,28 @@ func loadConfig() (*config, error) {
 	return cfg, nil
 }
 
+func newPaymentProvider(cfg config) (payments.Provider, error) {
+	switch cfg.payments.provider {
+	case "fake":
+		return payments.NewFakeProvider(cfg.payments.webhookSecret), nil
+	case "stripe":
+		return payments.NewStripeProvider(cfg.payments.apiKey, cfg.payments.webhookSecret), nil
+	default:
+		return nil, fmt.Errorf("unsupported PAYMENT_PROVIDER %q", cfg.payments.provider)
+	}
+}
+
+// newTicketKeyRing loads the configured ticket signing keys, falling back to a
+// throwaway key outside production.
+func newTicketKeyRing(cfg config) (*ticketsign.KeyRing, error) {
+	if cfg.ticketSigning.keys == "" {
+		log.Println("TICKET_SIGNING_KEYS not set, signing tickets with a temporary key")
+		return ticketsign.Generate()
+	}
+
+	return ticketsign.Parse(cfg.ticketSigning.keys, cfg.ticketSigning.activeKey)
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -142,13 +250,28 @@ func getEnvAsInt(key string, defaultValue int) int {
 	if valueStr == "" {
 		return defaultValue
 	}
-	
+
 	value, err := strconv.Atoi(valueStr)
 	if err != nil {
 		log.Printf("Warning: Invalid integer value for %s, using default %d", key, defaultValue)
 		return defaultValue
 	}
-	
+
+	return value
+}
+
+func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+	valueStr := os.Getenv(key)
+	if valueStr == "" {
+		return defaultValue
+	}
+
+	value, err := time.ParseDuration(valueStr)
+	if err != nil || value <= 0 {
+		log.Printf("Warning: Invalid duration value for %s, using default %s", key, defaultValue)
+		return defaultValue
+	}
+
 	return value
 }
 
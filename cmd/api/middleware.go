@@ -1,10 +1,20 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/AbrahamMayowa/ticketmania/internal/data"
+	"io"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 )
 
 func (app *application) authenticate(next http.Handler) http.Handler {
@@ -65,3 +75,170 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// idempotencyKeyTTL is how long a stored response is replayed for.
+const idempotencyKeyTTL = 24 * time.Hour
+
+// idempotent makes a mutating endpoint safe to retry. When the client sends an
+// Idempotency-Key header the first response is stored and replayed for later
+// requests with the same key and body; reusing a key with a different body is
+// rejected with 422. Requests without the header are passed straight through.
+// Secrets are left out of stored responses, so a replay never hands them out.
+func (app *application) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if len(key) > 255 {
+			app.badRequestResponse(w, r, errors.New("Idempotency-Key must not be more than 255 bytes"))
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1_048_576))
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		sum := sha256.Sum256(body)
+		requestHash := hex.EncodeToString(sum[:])
+
+		// Keys are only meaningful for the same endpoint and caller. Anonymous
+		// callers are told apart by address, so clients that happen to pick
+		// the same key never see each other's responses
+		caller := "anonymous:" + clientIP(r)
+		if user := app.contextGetUser(r); !user.IsAnonymous() {
+			caller = "user:" + strconv.FormatInt(*user.Id, 10)
+		}
+		scope := r.Method + " " + r.URL.Path + " " + caller
+
+		stored, err := app.models.Idempotency.Begin(r.Context(), scope, key, requestHash)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrIdempotencyKeyInUse):
+				app.conflictResponse(w, r, err, err.Error())
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		if stored != nil {
+			switch {
+			case stored.RequestHash != requestHash:
+				app.errorResponse(w, r, http.StatusUnprocessableEntity, "Idempotency-Key was already used with a different request body")
+			case !stored.Completed():
+				app.conflictResponse(w, r, data.ErrIdempotencyKeyInUse, data.ErrIdempotencyKeyInUse.Error())
+			default:
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(*stored.StatusCode)
+				w.Write(stored.ResponseBody)
+			}
+			return
+		}
+
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		completed := false
+
+		// Free the key if the handler panics so the client can retry
+		defer func() {
+			if !completed {
+				if err := app.models.Idempotency.Release(context.Background(), scope, key); err != nil {
+					app.logError(r, err)
+				}
+			}
+		}()
+
+		next.ServeHTTP(rec, r)
+
+		// Server errors are not replayed; the client should be able to retry
+		if rec.status >= http.StatusInternalServerError {
+			return
+		}
+
+		body, err = withoutSecrets(rec.body.Bytes())
+		if err != nil {
+			app.logError(r, err)
+			return
+		}
+
+		err = app.models.Idempotency.Complete(r.Context(), scope, key, rec.status, body)
+		if err != nil {
+			app.logError(r, err)
+			return
+		}
+		completed = true
+	})
+}
+
+// replayHiddenFields are left out of stored responses: the reservation secret
+// and the payment client secret must only reach the client that made the
+// request.
+var replayHiddenFields = []string{"secret", "client_secret"}
+
+// withoutSecrets returns a JSON response body with replayHiddenFields removed
+// at any depth.
+func withoutSecrets(body []byte) ([]byte, error) {
+	var v interface{}
+	d := json.NewDecoder(bytes.NewReader(body))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	var strip func(v interface{})
+	strip = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for _, field := range replayHiddenFields {
+				delete(v, field)
+			}
+			for _, value := range v {
+				strip(value)
+			}
+		case []interface{}:
+			for _, value := range v {
+				strip(value)
+			}
+		}
+	}
+	strip(v)
+
+	js, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return append(js, '\n'), nil
+}
+
+// clientIP returns the address the request came from, without its port.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// responseRecorder writes through to the client while keeping a copy of the
+// status and body.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
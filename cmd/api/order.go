@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/AbrahamMayowa/ticketmania/internal/data"
+)
+
+// getOrderHandler returns an order with its line items and tickets to the
+// buyer who placed it or the organizer of its event.
+func (app *application) getOrderHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	order, err := app.models.Orders.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if order.UserID == nil || *order.UserID != *user.Id {
+		event, err := app.models.Events.Get(r.Context(), order.EventID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if event.UserID != *user.Id {
+			app.notFoundResponse(w, r)
+			return
+		}
+	}
+
+	err = app.issueOrderTicketCodes(order)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"data": order}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// getReservationOrderHandler returns the order placed with a reservation, with
+// its line items, price breakdown and tickets, to the buyer who made the
+// reservation. Buyers who did not sign in read their receipt and ticket codes
+// this way, using the reservation secret.
+func (app *application) getReservationOrderHandler(w http.ResponseWriter, r *http.Request) {
+	reservation, ok := app.readBuyerReservation(w, r)
+	if !ok {
+		return
+	}
+
+	order, err := app.models.Orders.GetForReservation(r.Context(), reservation.ID)
+	if err == nil {
+		order, err = app.models.Orders.Get(r.Context(), order.ID)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.issueOrderTicketCodes(order)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"data": order}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/AbrahamMayowa/ticketmania/internal/data"
+	"github.com/AbrahamMayowa/ticketmania/internal/money"
+	"github.com/AbrahamMayowa/ticketmania/internal/payments"
+)
+
+// paymentIntentResponse is a stored payment plus the secret the client needs
+// to complete it with the provider.
+type paymentIntentResponse struct {
+	*data.Payment
+	ClientSecret string `json:"client_secret"`
+}
+
+// startPayment creates a provider intent for the order placed with a
+// reservation. The amount always comes from the stored order, never from the
+// client.
+func (app *application) startPayment(ctx context.Context, reservationID int64) (*paymentIntentResponse, error) {
+	order, err := app.models.Orders.GetForReservation(ctx, reservationID)
+	if err != nil {
+		return nil, err
+	}
+
+	if order.Status != data.OrderPending {
+		return nil, data.ErrReservationNotActive
+	}
+
+	if order.Total == 0 {
+		return app.completeFreeOrder(ctx, order)
+	}
+
+	intent, err := app.payments.CreateIntent(ctx, order.Total, order.Currency, order.OrderNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	payment := &data.Payment{
+		ReservationID: reservationID,
+		Provider:      app.payments.Name(),
+		ProviderRef:   intent.ID,
+		Amount:        intent.Amount,
+		Currency:      intent.Currency,
+		Status:        data.PaymentPending,
+	}
+
+	err = app.models.Payments.Insert(ctx, payment)
+	if err != nil {
+		return nil, err
+	}
+
+	return &paymentIntentResponse{Payment: payment, ClientSecret: intent.ClientSecret}, nil
+}
+
+// freeProvider names the payments recorded for orders a discount made free.
+const freeProvider = "free"
+
+// completeFreeOrder confirms an order with nothing to pay straight away,
+// recording a zero payment so it follows the same path as paid orders.
+func (app *application) completeFreeOrder(ctx context.Context, order *data.Order) (*paymentIntentResponse, error) {
+	payment := &data.Payment{
+		ReservationID: *order.ReservationID,
+		Provider:      freeProvider,
+		ProviderRef:   order.OrderNumber,
+		Amount:        0,
+		Currency:      order.Currency,
+		Status:        data.PaymentPending,
+	}
+
+	err := app.models.Payments.Insert(ctx, payment)
+	if err != nil {
+		return nil, err
+	}
+
+	err = app.models.Payments.MarkSucceeded(ctx, payment.ID)
+	if err != nil {
+		// Nothing was paid, so there is nothing to return
+		if errors.Is(err, data.ErrReservationNotActive) {
+			if updateErr := app.models.Payments.UpdateStatus(ctx, payment.ID, data.PaymentRefunded); updateErr != nil {
+				return nil, updateErr
+			}
+		}
+		return nil, err
+	}
+	payment.Status = data.PaymentSucceeded
+
+	app.sendOrderConfirmation(payment.ReservationID)
+
+	return &paymentIntentResponse{Payment: payment}, nil
+}
+
+// createReservationPaymentHandler starts paying for a reservation. Reservations
+// made while signed in can only be paid by the same user; others need the
+// secret returned with the reservation in the Reservation-Secret header.
+func (app *application) createReservationPaymentHandler(w http.ResponseWriter, r *http.Request) {
+	reservation, ok := app.readBuyerReservation(w, r)
+	if !ok {
+		return
+	}
+
+	if reservation.Status != data.ReservationActive {
+		app.conflictResponse(w, r, data.ErrReservationNotActive, data.ErrReservationNotActive.Error())
+		return
+	}
+
+	payment, err := app.startPayment(r.Context(), reservation.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrReservationNotActive):
+			app.conflictResponse(w, r, err, err.Error())
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"data": payment}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+func (app *application) paymentWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1_048_576))
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	event, err := app.payments.VerifyWebhook(payload, r.Header)
+	if err != nil {
+		switch {
+		case errors.Is(err, payments.ErrInvalidSignature):
+			app.unauthorizedResponse(w, r, err.Error())
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
+	}
+
+	payment, err := app.models.Payments.GetByProviderRef(r.Context(), app.payments.Name(), event.IntentID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			// Not one of ours; acknowledge so the provider stops retrying
+			app.logger.PrintInfo("ignoring webhook for unknown payment", map[string]string{"intent_id": event.IntentID})
+			app.writeWebhookAck(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	switch event.Type {
+	case payments.EventPaymentAuthorized, payments.EventPaymentSucceeded:
+		if event.Amount != payment.Amount || event.Currency != payment.Currency {
+			app.badRequestResponse(w, r, errors.New("webhook amount does not match the payment"))
+			return
+		}
+
+		if event.Type == payments.EventPaymentAuthorized {
+			_, err = app.payments.Capture(r.Context(), payment.ProviderRef)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+		}
+
+		err = app.completePayment(r.Context(), payment)
+	case payments.EventPaymentFailed:
+		if payment.Status == data.PaymentPending {
+			err = app.models.Payments.UpdateStatus(r.Context(), payment.ID, data.PaymentFailed)
+		}
+	}
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeWebhookAck(w, r)
+}
+
+// completePayment marks the reservation's tickets paid. If the hold was already
+// released the money is returned to the buyer instead, once however often the
+// webhook is delivered.
+func (app *application) completePayment(ctx context.Context, payment *data.Payment) error {
+	if payment.Status == data.PaymentRefunded {
+		return nil
+	}
+
+	err := app.models.Payments.MarkSucceeded(ctx, payment.ID)
+	switch {
+	case err == nil:
+		// Replayed webhooks find the payment already succeeded and were
+		// confirmed the first time
+		if payment.Status != data.PaymentSucceeded {
+			app.sendOrderConfirmation(payment.ReservationID)
+		}
+		return nil
+	case errors.Is(err, data.ErrPaymentRefunded):
+		return nil
+	case !errors.Is(err, data.ErrReservationNotActive):
+		return err
+	}
+
+	app.logger.PrintInfo("refunding payment for released reservation", map[string]string{
+		"payment_id":     strconv.FormatInt(payment.ID, 10),
+		"reservation_id": strconv.FormatInt(payment.ReservationID, 10),
+	})
+
+	_, err = app.payments.Refund(ctx, payment.ProviderRef, payment.Amount)
+	if err != nil {
+		// Give up the claim so a retried webhook refunds it instead
+		if resetErr := app.models.Payments.UpdateStatus(ctx, payment.ID, data.PaymentPending); resetErr != nil {
+			app.logger.PrintError(resetErr, nil)
+		}
+		return err
+	}
+
+	return app.models.Payments.UpdateStatus(ctx, payment.ID, data.PaymentRefunded)
+}
+
+// sendOrderConfirmation emails the buyer the receipt and ticket codes of the
+// order placed with a reservation once it is paid, so buyers who did not sign
+// in have what they need at the door.
+func (app *application) sendOrderConfirmation(reservationID int64) {
+	app.background(func() {
+		err := app.mailOrderConfirmation(context.Background(), reservationID)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"reservation_id": strconv.FormatInt(reservationID, 10)})
+		}
+	})
+}
+
+func (app *application) mailOrderConfirmation(ctx context.Context, reservationID int64) error {
+	order, err := app.models.Orders.GetForReservation(ctx, reservationID)
+	if err != nil {
+		return err
+	}
+
+	order, err = app.models.Orders.Get(ctx, order.ID)
+	if err != nil {
+		return err
+	}
+
+	event, err := app.models.Events.Get(ctx, order.EventID)
+	if err != nil {
+		return err
+	}
+
+	err = app.issueOrderTicketCodes(order)
+	if err != nil {
+		return err
+	}
+
+	names := make(map[int64]string, len(order.Items))
+	for _, item := range order.Items {
+		names[item.TicketTypeID] = item.Name
+	}
+
+	tickets := []map[string]interface{}{}
+	for _, ticket := range order.Tickets {
+		if !ticket.Admitted() {
+			continue
+		}
+		tickets = append(tickets, map[string]interface{}{
+			"id":    ticket.ID,
+			"name":  names[*ticket.TicketTypeID],
+			"code":  ticket.Code,
+			"token": ticket.SignedToken,
+		})
+	}
+
+	// Amounts that are zero are left out of the receipt
+	amount := func(value int64) string {
+		if value == 0 {
+			return ""
+		}
+		return money.New(value, order.Currency).String()
+	}
+
+	return app.mailer.Send([]string{order.BuyerEmail}, "order_confirmation.tmpl", map[string]interface{}{
+		"eventTitle":  event.Title,
+		"orderNumber": order.OrderNumber,
+		"subtotal":    money.New(order.Subtotal, order.Currency).String(),
+		"discount":    amount(order.Discount),
+		"serviceFee":  amount(order.ServiceFee),
+		"tax":         amount(order.Tax),
+		"total":       money.New(order.Total, order.Currency).String(),
+		"tickets":     tickets,
+	})
+}
+
+func (app *application) writeWebhookAck(w http.ResponseWriter, r *http.Request) {
+	err := app.writeJSON(w, http.StatusOK, envelope{"received": true}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/AbrahamMayowa/ticketmania/internal/data"
+	"github.com/AbrahamMayowa/ticketmania/internal/validator"
+)
+
+// quoteHandler returns the itemized price of a purchase, with promo code,
+// service fees and tax applied, without holding any tickets. It takes the same
+// body as /v1/buy-ticket.
+func (app *application) quoteHandler(w http.ResponseWriter, r *http.Request) {
+	purchase, ok := app.readTicketPurchase(w, r)
+	if !ok {
+		return
+	}
+
+	quote, err := app.models.Tickets.Quote(r.Context(), purchase)
+	if err != nil {
+		app.purchaseErrorResponse(w, r, err, purchase)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"data": quote}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// updatePricingHandler changes an event's service fee and tax settings.
+// Orders already placed keep the breakdown they were charged.
+func (app *application) updatePricingHandler(w http.ResponseWriter, r *http.Request) {
+	event, ok := app.readOwnedEvent(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		ServiceFeeFlat *int64 `json:"service_fee_flat"`
+		ServiceFeeBps  *int   `json:"service_fee_bps"`
+		FeesAbsorbed   *bool  `json:"fees_absorbed"`
+		TaxRateBps     *int   `json:"tax_rate_bps"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.ServiceFeeFlat != nil {
+		event.ServiceFeeFlat = *input.ServiceFeeFlat
+	}
+	if input.ServiceFeeBps != nil {
+		event.ServiceFeeBps = *input.ServiceFeeBps
+	}
+	if input.FeesAbsorbed != nil {
+		event.FeesAbsorbed = *input.FeesAbsorbed
+	}
+	if input.TaxRateBps != nil {
+		event.TaxRateBps = *input.TaxRateBps
+	}
+
+	v := validator.New()
+	if data.ValidatePricing(v, &event.Pricing); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Events.UpdatePricing(r.Context(), event)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"data": event}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+}
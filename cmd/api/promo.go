@@ -0,0 +1,276 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/AbrahamMayowa/ticketmania/internal/data"
+	"github.com/AbrahamMayowa/ticketmania/internal/validator"
+)
+
+// listPromoCodesHandler returns an event's promo codes with how often each
+// has been used.
+func (app *application) listPromoCodesHandler(w http.ResponseWriter, r *http.Request) {
+	event, ok := app.readOwnedEvent(w, r)
+	if !ok {
+		return
+	}
+
+	codes, err := app.models.PromoCodes.ListForEvent(r.Context(), event.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"data": codes}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+func (app *application) createPromoCodeHandler(w http.ResponseWriter, r *http.Request) {
+	event, ok := app.readEditableEvent(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Code          string            `json:"code"`
+		DiscountType  data.DiscountType `json:"discount_type"`
+		DiscountValue int64             `json:"discount_value"`
+		Currency      *string           `json:"currency"`
+		TicketTypeIDs []int64           `json:"ticket_type_ids"`
+		MaxUses       *int              `json:"max_uses"`
+		ValidFrom     *time.Time        `json:"valid_from"`
+		ValidUntil    *time.Time        `json:"valid_until"`
+		Active        *bool             `json:"active"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	promo := &data.PromoCode{
+		EventID:       event.ID,
+		Code:          strings.ToUpper(strings.TrimSpace(input.Code)),
+		DiscountType:  input.DiscountType,
+		DiscountValue: input.DiscountValue,
+		Currency:      upperCurrency(input.Currency),
+		TicketTypeIDs: input.TicketTypeIDs,
+		MaxUses:       input.MaxUses,
+		ValidFrom:     input.ValidFrom,
+		ValidUntil:    input.ValidUntil,
+		Active:        true,
+	}
+	if input.Active != nil {
+		promo.Active = *input.Active
+	}
+	if promo.TicketTypeIDs == nil {
+		promo.TicketTypeIDs = []int64{}
+	}
+
+	if !app.validatePromoCode(w, r, promo) {
+		return
+	}
+
+	err = app.models.PromoCodes.Insert(r.Context(), promo)
+	if err != nil {
+		app.promoCodeErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"data": promo}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// updatePromoCodeHandler changes some of a promo code's settings, for
+// example to deactivate it or raise its usage cap.
+func (app *application) updatePromoCodeHandler(w http.ResponseWriter, r *http.Request) {
+	event, ok := app.readOwnedEvent(w, r)
+	if !ok {
+		return
+	}
+
+	promo, ok := app.readEventPromoCode(w, r, event)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Code          *string            `json:"code"`
+		DiscountType  *data.DiscountType `json:"discount_type"`
+		DiscountValue *int64             `json:"discount_value"`
+		Currency      *string            `json:"currency"`
+		TicketTypeIDs []int64            `json:"ticket_type_ids"`
+		MaxUses       nullableInt        `json:"max_uses"`
+		ValidFrom     nullableTime       `json:"valid_from"`
+		ValidUntil    nullableTime       `json:"valid_until"`
+		Active        *bool              `json:"active"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Code != nil {
+		promo.Code = strings.ToUpper(strings.TrimSpace(*input.Code))
+	}
+	if input.DiscountType != nil {
+		promo.DiscountType = *input.DiscountType
+	}
+	if input.DiscountValue != nil {
+		promo.DiscountValue = *input.DiscountValue
+	}
+	if input.Currency != nil {
+		promo.Currency = upperCurrency(input.Currency)
+	}
+	if input.TicketTypeIDs != nil {
+		promo.TicketTypeIDs = input.TicketTypeIDs
+	}
+	if input.MaxUses.Set {
+		promo.MaxUses = input.MaxUses.Value
+	}
+	if input.ValidFrom.Set {
+		promo.ValidFrom = input.ValidFrom.Value
+	}
+	if input.ValidUntil.Set {
+		promo.ValidUntil = input.ValidUntil.Value
+	}
+	if input.Active != nil {
+		promo.Active = *input.Active
+	}
+
+	if !app.validatePromoCode(w, r, promo) {
+		return
+	}
+
+	err = app.models.PromoCodes.Update(r.Context(), promo)
+	if err != nil {
+		app.promoCodeErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"data": promo}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+func (app *application) deletePromoCodeHandler(w http.ResponseWriter, r *http.Request) {
+	event, ok := app.readOwnedEvent(w, r)
+	if !ok {
+		return
+	}
+
+	promo, ok := app.readEventPromoCode(w, r, event)
+	if !ok {
+		return
+	}
+
+	err := app.models.PromoCodes.Delete(r.Context(), promo.ID)
+	if err != nil {
+		app.promoCodeErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "promo code successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// validatePromoCode runs data.ValidatePromoCode and checks that the scoped
+// ticket types belong to the code's event. It writes the error response
+// itself and reports whether the handler should continue.
+func (app *application) validatePromoCode(w http.ResponseWriter, r *http.Request, promo *data.PromoCode) bool {
+	v := validator.New()
+	data.ValidatePromoCode(v, promo)
+
+	if len(promo.TicketTypeIDs) > 0 {
+		ticketTypes, err := app.models.TicketTypes.ListForEvent(r.Context(), promo.EventID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return false
+		}
+
+		known := make(map[int64]bool, len(ticketTypes))
+		for _, tt := range ticketTypes {
+			known[tt.ID] = true
+		}
+		for _, id := range promo.TicketTypeIDs {
+			if !known[id] {
+				v.AddError("ticket_type_ids", "must only contain ticket types of this event")
+				break
+			}
+		}
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return false
+	}
+
+	return true
+}
+
+// readEventPromoCode loads the promo code named by the :promoCodeId
+// parameter, which must belong to event.
+func (app *application) readEventPromoCode(w http.ResponseWriter, r *http.Request, event *data.Event) (*data.PromoCode, bool) {
+	id, err := app.readNamedIDParam(r, "promoCodeId")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	promo, err := app.models.PromoCodes.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	if promo.EventID != event.ID {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	return promo, true
+}
+
+func (app *application) promoCodeErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		app.notFoundResponse(w, r)
+	case errors.Is(err, data.ErrDuplicatePromoCode):
+		app.conflictResponse(w, r, err, err.Error())
+	case errors.Is(err, data.ErrEditConflict):
+		app.editConflictResponse(w, r)
+	default:
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// upperCurrency normalizes an optional currency code to the stored form.
+func upperCurrency(currency *string) *string {
+	if currency == nil {
+		return nil
+	}
+	code := strings.ToUpper(strings.TrimSpace(*currency))
+	return &code
+}
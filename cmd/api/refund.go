@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/AbrahamMayowa/ticketmania/internal/data"
+	"github.com/AbrahamMayowa/ticketmania/internal/money"
+	"github.com/AbrahamMayowa/ticketmania/internal/validator"
+)
+
+// maxRefundTickets caps how many tickets one refund request may cancel.
+const maxRefundTickets = 500
+
+// cancelTicketHandler cancels a single paid ticket. The ticket holder is
+// refunded according to the event's refund policy; the organizer always
+// refunds in full.
+func (app *application) cancelTicketHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	ticket, err := app.models.Tickets.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if ticket.EventID == nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	event, err := app.models.Events.Get(r.Context(), *ticket.EventID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	organizer := event.UserID == *user.Id
+	holder := ticket.UserID != nil && *ticket.UserID == *user.Id
+	if !organizer && !holder {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	refunds, err := app.models.Refunds.CancelTickets(r.Context(), data.CancelRequest{
+		EventID:     event.ID,
+		TicketIDs:   []int64{ticket.ID},
+		RequestedBy: *user.Id,
+		FullRefund:  organizer,
+	})
+	if err != nil {
+		app.cancelErrorResponse(w, r, err)
+		return
+	}
+
+	app.settleRefunds(r.Context(), event, refunds, "ticket_refund.tmpl")
+	app.triggerWaitlistOffers()
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"data": refunds[0]}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// refundTicketsHandler lets an organizer cancel and fully refund any number
+// of paid tickets for their event.
+func (app *application) refundTicketsHandler(w http.ResponseWriter, r *http.Request) {
+	event, ok := app.readOwnedEvent(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		TicketIDs []int64 `json:"ticket_ids"`
+		Reason    string  `json:"reason"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(len(input.TicketIDs) > 0, "ticket_ids", "must be provided")
+	v.Check(len(input.TicketIDs) <= maxRefundTickets, "ticket_ids", fmt.Sprintf("must not contain more than %d tickets", maxRefundTickets))
+	v.Check(len(input.Reason) <= 500, "reason", "must not be more than 500 bytes")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	refunds, err := app.models.Refunds.CancelTickets(r.Context(), data.CancelRequest{
+		EventID:     event.ID,
+		TicketIDs:   input.TicketIDs,
+		RequestedBy: *user.Id,
+		Reason:      input.Reason,
+		FullRefund:  true,
+	})
+	if err != nil {
+		app.cancelErrorResponse(w, r, err)
+		return
+	}
+
+	app.settleRefunds(r.Context(), event, refunds, "ticket_refund.tmpl")
+	app.triggerWaitlistOffers()
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"data": refunds}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+func (app *application) updateRefundPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	event, ok := app.readOwnedEvent(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		RefundPolicy      *data.RefundPolicy `json:"refund_policy"`
+		RefundPercent     *int               `json:"refund_percent"`
+		RefundCutoffHours *int               `json:"refund_cutoff_hours"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.RefundPolicy != nil {
+		event.RefundPolicy = *input.RefundPolicy
+	}
+	if input.RefundPercent != nil {
+		event.RefundPercent = *input.RefundPercent
+	}
+	if input.RefundCutoffHours != nil {
+		event.RefundCutoffHours = *input.RefundCutoffHours
+	}
+
+	v := validator.New()
+	if data.ValidateRefundPolicy(v, event); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Events.UpdateRefundPolicy(r.Context(), event)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"data": event}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// settleRefunds returns the money for pending refunds through the payment
+// provider and emails each buyer using templateFile. A refund the provider
+// rejects is marked failed for staff to settle by hand; the tickets stay
+// cancelled either way.
+func (app *application) settleRefunds(ctx context.Context, event *data.Event, refunds []*data.Refund, templateFile string) {
+	for _, refund := range refunds {
+		if refund.Status == data.RefundPending {
+			err := app.settleRefund(ctx, refund)
+			if err != nil {
+				app.logger.PrintError(err, map[string]string{"refund_id": strconv.FormatInt(refund.ID, 10)})
+
+				refund.Status = data.RefundFailed
+				if err := app.models.Refunds.MarkFailed(ctx, refund.ID); err != nil {
+					app.logger.PrintError(err, map[string]string{"refund_id": strconv.FormatInt(refund.ID, 10)})
+				}
+			}
+		}
+
+		if refund.BuyerEmail == "" {
+			continue
+		}
+
+		refund := refund
+		app.background(func() {
+			err := app.mailer.Send([]string{refund.BuyerEmail}, templateFile, map[string]interface{}{
+				"eventTitle":  event.Title,
+				"ticketCount": len(refund.TicketIDs),
+				"amount":      money.New(refund.Amount, refund.Currency).String(),
+				"refunded":    refund.Amount > 0 && refund.Status == data.RefundSucceeded,
+				"failed":      refund.Status == data.RefundFailed,
+				"reason":      refund.Reason,
+			})
+			if err != nil {
+				app.logger.PrintError(err, nil)
+			}
+		})
+	}
+}
+
+func (app *application) settleRefund(ctx context.Context, refund *data.Refund) error {
+	if refund.PaymentID == nil {
+		return errors.New("no captured payment to refund")
+	}
+
+	payment, err := app.models.Payments.Get(ctx, *refund.PaymentID)
+	if err != nil {
+		return err
+	}
+
+	result, err := app.payments.Refund(ctx, payment.ProviderRef, refund.Amount)
+	if err != nil {
+		return err
+	}
+
+	err = app.models.Refunds.MarkSucceeded(ctx, refund.ID, result.ID)
+	if err != nil {
+		return err
+	}
+
+	refund.Status = data.RefundSucceeded
+	refund.ProviderRef = &result.ID
+	return nil
+}
+
+func (app *application) cancelErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound), errors.Is(err, data.ErrTicketNotFound):
+		app.notFoundResponse(w, r)
+	case errors.Is(err, data.ErrTicketWrongEvent):
+		app.badRequestResponse(w, r, err)
+	case errors.Is(err, data.ErrTicketAlreadyUsed), errors.Is(err, data.ErrTicketCancelled), errors.Is(err, data.ErrTicketNotPaid):
+		app.conflictResponse(w, r, err, err.Error())
+	default:
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/AbrahamMayowa/ticketmania/internal/data"
+)
+
+// createReservationHandler holds the requested tickets for the configured
+// reservation TTL. The hold is released by the background sweeper unless the
+// reservation is completed before it expires.
+func (app *application) createReservationHandler(w http.ResponseWriter, r *http.Request) {
+	purchase, ok := app.readTicketPurchase(w, r)
+	if !ok {
+		return
+	}
+
+	purchase.HoldFor = app.config.reservation.ttl
+
+	result, err := app.models.Tickets.InsertTickets(purchase)
+	if err != nil {
+		app.purchaseErrorResponse(w, r, err, purchase)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"data": result}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// readBuyerReservation loads the reservation named in the URL for the buyer
+// who made it. Reservations made while signed in can only be read by the same
+// user; others need the secret returned with the reservation in the
+// Reservation-Secret header. It writes the error response itself and reports
+// whether the handler should continue.
+func (app *application) readBuyerReservation(w http.ResponseWriter, r *http.Request) (*data.Reservation, bool) {
+	user := app.contextGetUser(r)
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	reservation, err := app.models.Reservations.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	if reservation.UserID != nil && (user.Id == nil || *user.Id != *reservation.UserID) {
+		app.forbiddenResponse(w, r)
+		return nil, false
+	}
+
+	// Without the secret, anonymous reservations are treated as unknown so
+	// their ids cannot be probed
+	if reservation.UserID == nil && !reservation.MatchesSecret(r.Header.Get("Reservation-Secret")) {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	return reservation, true
+}
@@ -11,10 +11,50 @@ func (app *application) router() http.Handler {
 
 	router.HandlerFunc(http.MethodPost, "/v1/register", app.registerUserHandler)
 	router.HandlerFunc(http.MethodPost, "/v1/login", app.LoginUserHandler)
-	router.HandlerFunc(http.MethodPost, "/v1/create-event", app.requireAuthentication(app.createEventHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/create-event", app.requireAuthentication(app.idempotent(app.createEventHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/event-series", app.requireAuthentication(app.idempotent(app.createEventSeriesHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/event-series/:id", app.getEventSeriesHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/venues", app.listVenuesHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/venues", app.requireAuthentication(app.createVenueHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/venues/:id", app.getVenueHandler)
+	router.HandlerFunc(http.MethodPatch, "/v1/venues/:id", app.requireAuthentication(app.updateVenueHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/venues/:id", app.requireAuthentication(app.deleteVenueHandler))
 	router.HandlerFunc(http.MethodGet, "/v1/events", app.listEventsHandler)
 	router.HandlerFunc(http.MethodGet, "/v1/events/:id", app.getEventHandler)
-	router.HandlerFunc(http.MethodPost, "/v1/buy-ticket", app.createTicket )
+	router.HandlerFunc(http.MethodPatch, "/v1/events/:id", app.requireAuthentication(app.updateEventHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/events/:id/following", app.requireAuthentication(app.updateFollowingEventsHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/events/:id", app.requireAuthentication(app.deleteEventHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/events/:id/publish", app.requireAuthentication(app.publishEventHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/events/:id/cancel", app.requireAuthentication(app.idempotent(app.cancelEventHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/events/:id/complete", app.requireAuthentication(app.completeEventHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/events/:id/ticket-types", app.listTicketTypesHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/events/:id/ticket-types", app.requireAuthentication(app.createTicketTypeHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/events/:id/ticket-types/:ticketTypeId", app.requireAuthentication(app.updateTicketTypeHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/events/:id/ticket-types/:ticketTypeId", app.requireAuthentication(app.deleteTicketTypeHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/events/:id/seats", app.getEventSeatsHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/events/:id/seat-map", app.requireAuthentication(app.updateSeatMapHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/events/:id/promo-codes", app.requireAuthentication(app.listPromoCodesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/events/:id/promo-codes", app.requireAuthentication(app.createPromoCodeHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/events/:id/promo-codes/:promoCodeId", app.requireAuthentication(app.updatePromoCodeHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/events/:id/promo-codes/:promoCodeId", app.requireAuthentication(app.deletePromoCodeHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/events/:id/check-in", app.requireAuthentication(app.checkInHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/events/:id/check-in/manifest", app.requireAuthentication(app.checkInManifestHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/events/:id/check-in/sync", app.requireAuthentication(app.checkInSyncHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/events/:id/refunds", app.requireAuthentication(app.idempotent(app.refundTicketsHandler)))
+	router.HandlerFunc(http.MethodPut, "/v1/events/:id/refund-policy", app.requireAuthentication(app.updateRefundPolicyHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/events/:id/pricing", app.requireAuthentication(app.updatePricingHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/ticket-types/:id/waitlist", app.joinWaitlistHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tickets/:id/cancel", app.requireAuthentication(app.idempotent(app.cancelTicketHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/quote", app.quoteHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/buy-ticket", app.idempotent(app.createTicket))
+	router.HandlerFunc(http.MethodPost, "/v1/reservations", app.idempotent(app.createReservationHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/reservations/:id/payments", app.idempotent(app.createReservationPaymentHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/reservations/:id/order", app.getReservationOrderHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/payments/webhook", app.paymentWebhookHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/currencies", app.listCurrenciesHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/keys", app.listKeysHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/orders/:id", app.requireAuthentication(app.getOrderHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/me/events/:id/stats", app.requireAuthentication(app.eventStatsHandler))
 
 	return app.recoverPanic(app.authenticate(router))
 }
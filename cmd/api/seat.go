@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/AbrahamMayowa/ticketmania/internal/data"
+	"github.com/AbrahamMayowa/ticketmania/internal/validator"
+)
+
+// getEventSeatsHandler returns an event's seat map with the live status of
+// every seat.
+func (app *application) getEventSeatsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	event, err := app.models.Events.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user := app.contextGetUser(r)
+	if event.Status == data.EventDraft && (user.IsAnonymous() || event.UserID != *user.Id) {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	seatMap, err := app.models.Seats.GetMap(r.Context(), event.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"data": seatMap}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// updateSeatMapHandler replaces an event's seat map. A row's ticket_type_id
+// applies to its seats unless a seat names its own; an empty sections list
+// removes the map.
+func (app *application) updateSeatMapHandler(w http.ResponseWriter, r *http.Request) {
+	event, ok := app.readEditableEvent(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Sections []struct {
+			Name string `json:"name"`
+			Rows []struct {
+				Label        string `json:"label"`
+				TicketTypeID int64  `json:"ticket_type_id"`
+				Seats        []struct {
+					Number       string `json:"number"`
+					TicketTypeID int64  `json:"ticket_type_id"`
+				} `json:"seats"`
+			} `json:"rows"`
+		} `json:"sections"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	seats := []*data.Seat{}
+	for _, section := range input.Sections {
+		for _, row := range section.Rows {
+			for _, seat := range row.Seats {
+				s := &data.Seat{
+					Section:      strings.TrimSpace(section.Name),
+					Row:          strings.TrimSpace(row.Label),
+					Number:       strings.TrimSpace(seat.Number),
+					TicketTypeID: row.TicketTypeID,
+				}
+				if seat.TicketTypeID != 0 {
+					s.TicketTypeID = seat.TicketTypeID
+				}
+				seats = append(seats, s)
+			}
+		}
+	}
+
+	v := validator.New()
+	if data.ValidateSeats(v, seats); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Seats.Replace(r.Context(), event.ID, seats)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrTicketNotFound):
+			app.failedValidationResponse(w, r, map[string]string{"sections": "ticket types must belong to this event"})
+		case errors.Is(err, data.ErrSeatMapHasSales):
+			app.conflictResponse(w, r, err, err.Error())
+		case errors.Is(err, data.ErrOverCapacity):
+			app.failedValidationResponse(w, r, map[string]string{"sections": err.Error()})
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	seatMap, err := app.models.Seats.GetMap(r.Context(), event.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"data": seatMap}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/AbrahamMayowa/ticketmania/internal/data"
+	"github.com/AbrahamMayowa/ticketmania/internal/validator"
+)
+
+// createEventSeriesHandler creates a recurring event. It takes the same body
+// as /v1/create-event, describing the first occurrence, plus the recurrence
+// rule and the dates to skip. Every occurrence is created straight away with
+// its own copy of the ticket types.
+func (app *application) createEventSeriesHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		eventInput
+		RRule   string   `json:"rrule"`
+		ExDates []string `json:"exdates"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	template, ticketTypes, ok := app.newEvent(w, r, &input.eventInput)
+	if !ok {
+		return
+	}
+
+	series := &data.EventSeries{
+		UserID:  *user.Id,
+		RRule:   input.RRule,
+		ExDates: input.ExDates,
+	}
+
+	v := validator.New()
+	if data.ValidateEventSeries(v, series, template.Date); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Series.Insert(r.Context(), series, template, ticketTypes)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateTicketType):
+			app.conflictResponse(w, r, err, err.Error())
+		case errors.Is(err, data.ErrOverCapacity):
+			app.failedValidationResponse(w, r, map[string]string{"total_qty": err.Error()})
+		default:
+			app.serverErrorResponse(w, r, err, input)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"data": series}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// getEventSeriesHandler returns a series with its occurrences. Draft
+// occurrences are only shown to the organizer.
+func (app *application) getEventSeriesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	series, err := app.models.Series.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user := app.contextGetUser(r)
+	if user.IsAnonymous() || series.UserID != *user.Id {
+		visible := []*data.Event{}
+		for _, e := range series.Occurrences {
+			if e.Status != data.EventDraft {
+				visible = append(visible, e)
+			}
+		}
+		if len(visible) == 0 {
+			app.notFoundResponse(w, r)
+			return
+		}
+		series.Occurrences = visible
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"data": series}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// updateFollowingEventsHandler applies a partial update to an occurrence of
+// a series and every later occurrence that is not cancelled or completed, all
+// or none of them. It takes the same body as PATCH /v1/events/:id, version of
+// the named occurrence included, except that dates cannot change; move
+// occurrences one at a time instead. Fields left out keep each occurrence's
+// own value.
+func (app *application) updateFollowingEventsHandler(w http.ResponseWriter, r *http.Request) {
+	event, ok := app.readEditableEvent(w, r)
+	if !ok {
+		return
+	}
+
+	var input eventPatch
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Version != nil, "version", "must be provided")
+	v.Check(input.Date == nil, "date", "cannot be changed for following events; update occurrences one at a time")
+	v.Check(input.EndDate == nil, "end_date", "cannot be changed for following events; update occurrences one at a time")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if *input.Version != event.Version {
+		app.editConflictResponse(w, r)
+		return
+	}
+
+	var venue *data.Venue
+	if input.VenueID.Value != nil {
+		venue, ok = app.readEventVenue(w, r, *input.VenueID.Value)
+		if !ok {
+			return
+		}
+	}
+
+	events, err := app.models.Series.Following(r.Context(), event)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNotInSeries):
+			app.conflictResponse(w, r, err, err.Error())
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	for _, e := range events {
+		err = input.apply(e)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		if venue != nil {
+			input.moveToVenue(e, venue)
+		}
+
+		if data.ValidateEvent(v, e); !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+	}
+
+	err = app.models.Series.UpdateAll(r.Context(), events)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrOverCapacity):
+			app.failedValidationResponse(w, r, map[string]string{"venue_id": err.Error()})
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"data": events}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+}
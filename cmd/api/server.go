@@ -24,6 +24,9 @@ func (app *application) server() error {
 
 	shutDownError := make(chan error)
 
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	app.startJobs(jobsCtx)
+
 	go func() {
 		quit := make(chan os.Signal, 1)
 
@@ -47,6 +50,7 @@ func (app *application) server() error {
 		app.logger.PrintInfo("completing background tasks", map[string]string{
 			"addr": srv.Addr})
 
+		stopJobs()
 		app.wg.Wait()
 		shutDownError <- nil
 
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/AbrahamMayowa/ticketmania/internal/data"
+	"github.com/AbrahamMayowa/ticketmania/internal/validator"
+)
+
+// eventStatsHandler returns the sales dashboard of one of the current user's
+// events: inventory per ticket type, revenue per currency, sales over time in
+// hourly or daily buckets, check-ins and cancellations.
+func (app *application) eventStatsHandler(w http.ResponseWriter, r *http.Request) {
+	event, ok := app.readOwnedEvent(w, r)
+	if !ok {
+		return
+	}
+
+	bucket := r.URL.Query().Get("bucket")
+	if bucket == "" {
+		bucket = data.BucketDay
+	}
+
+	v := validator.New()
+	v.Check(bucket == data.BucketHour || bucket == data.BucketDay, "bucket", "must be hour or day")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	stats, err := app.models.Stats.ForEvent(r.Context(), event, bucket)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"data": stats}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+}
@@ -2,92 +2,139 @@ package main
 
 import (
 	"errors"
-	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/AbrahamMayowa/ticketmania/internal/data"
 	"github.com/AbrahamMayowa/ticketmania/internal/validator"
 )
 
 func (app *application) createTicket(w http.ResponseWriter, r *http.Request) {
+	ticketType, ok := app.readTicketPurchase(w, r)
+	if !ok {
+		return
+	}
+
+	ticketType.HoldFor = app.config.reservation.ttl
+
+	newTickets, err := app.models.Tickets.InsertTickets(ticketType)
+	if err != nil {
+		app.purchaseErrorResponse(w, r, err, ticketType)
+		return
+	}
+
+	// Tickets stay reserved until the payment webhook confirms the payment
+	payment, err := app.startPayment(r.Context(), newTickets.Reservation.ID)
+	if err != nil {
+		cancelErr := app.models.Reservations.Cancel(r.Context(), newTickets.Reservation.ID)
+		if cancelErr != nil {
+			app.logError(r, cancelErr)
+		} else {
+			app.triggerWaitlistOffers()
+		}
+		app.serverErrorResponse(w, r, err, ticketType)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"data": newTickets, "payment": payment}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+}
+
+// readTicketPurchase decodes and validates a ticket purchase body shared by the
+// buy-ticket and reservation endpoints. It writes the error response itself and
+// reports whether the handler should continue.
+func (app *application) readTicketPurchase(w http.ResponseWriter, r *http.Request) (*data.TicketPurchaseRequest, bool) {
 	user := app.contextGetUser(r)
 
 	var input struct {
-		EventID *int64 `json:"eventId"`
+		EventID     *int64 `json:"eventId"`
+		PromoCode   string `json:"promoCode"`
 		TicketTypes []struct {
-			TicketTypeID *int64 `json:"ticketTypeId"`
-			Quantity     int `json:"quantity"`
-			BuyerEmail   string `json:"buyerEmail"`
-			BuyerPhone   string `json:"buyerPhone"`
+			TicketTypeID *int64  `json:"ticketTypeId"`
+			Quantity     int     `json:"quantity"`
+			BuyerEmail   string  `json:"buyerEmail"`
+			BuyerPhone   string  `json:"buyerPhone"`
+			SeatIDs      []int64 `json:"seatIds"`
 		} `json:"ticketTypes"`
 	}
 
-	err := app.readJSON(w,r, &input)
+	err := app.readJSON(w, r, &input)
 
 	if err != nil {
-		app.badRequestResponse(w,r,err)
-		return
+		app.badRequestResponse(w, r, err)
+		return nil, false
 	}
 
 	if len(input.TicketTypes) == 0 {
 		app.badRequestResponse(w, r, errors.New("At least one ticket type is required"))
-		return
+		return nil, false
 	}
 
 	v := validator.New()
 
 	if input.EventID == nil {
 		app.badRequestResponse(w, r, errors.New("EventId is required"))
-		return
+		return nil, false
 	}
 
 	//anonymous user can still create ticket
 	ticketType := &data.TicketPurchaseRequest{
-		EventID: input.EventID,
-		
+		EventID:   input.EventID,
+		PromoCode: strings.TrimSpace(input.PromoCode),
 	}
 
-	fmt.Printf("user.Id: %+v\n", user.Id)
-
 	if user.Id != nil {
 		ticketType.UserID = user.Id
 	}
 
-	fmt.Printf("ticketType: %+v\n", ticketType)
-
-	for _,item := range input.TicketTypes {
+	for _, item := range input.TicketTypes {
 		ticketItem := &data.TicketPurchaseItem{
 			TicketTypeID: item.TicketTypeID,
-			Quantity: item.Quantity,
-			BuyerEmail: item.BuyerEmail,
-			BuyerPhone: item.BuyerPhone,
+			Quantity:     item.Quantity,
+			BuyerEmail:   item.BuyerEmail,
+			BuyerPhone:   item.BuyerPhone,
+			SeatIDs:      item.SeatIDs,
+		}
+		// Picking seats implies the quantity
+		if ticketItem.Quantity == 0 {
+			ticketItem.Quantity = len(item.SeatIDs)
 		}
 		if data.ValidateTicket(v, ticketItem); !v.Valid() {
 			app.failedValidationResponse(w, r, v.Errors)
-			return;
+			return nil, false
 		}
 		ticketType.Items = append(ticketType.Items, ticketItem)
 	}
 
-	newTickets, err := app.models.Tickets.InsertTickets(ticketType)
-	if err != nil {
-		switch {
-		case errors.Is(err, data.ErrTicketNotFound):
-			app.badRequestResponse(w, r, err)
-			return
-		case errors.Is(err, data.ErrTicketNotAvailable):
-			app.badRequestResponse(w, r, err)
-			return
-		default:
-			app.serverErrorResponse(w, r, err, input)
-			return
-		}
-	}
-
-	err = app.writeJSON(w, http.StatusCreated, envelope{"data": newTickets}, nil)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
+	return ticketType, true
+}
+
+// purchaseErrorResponse maps errors returned by InsertTickets to a response.
+func (app *application) purchaseErrorResponse(w http.ResponseWriter, r *http.Request, err error, input interface{}) {
+	switch {
+	case errors.Is(err, data.ErrTicketNotFound):
+		app.badRequestResponse(w, r, err)
+	case errors.Is(err, data.ErrTicketNotAvailable):
+		app.badRequestResponse(w, r, err)
+	case errors.Is(err, data.ErrMixedCurrency):
+		app.badRequestResponse(w, r, err)
+	case errors.Is(err, data.ErrEventNotOnSale):
+		app.badRequestResponse(w, r, err)
+	case errors.Is(err, data.ErrTicketTypeNotOnSale):
+		app.badRequestResponse(w, r, err)
+	case errors.Is(err, data.ErrPurchaseLimit):
+		app.failedValidationResponse(w, r, map[string]string{"quantity": err.Error()})
+	case errors.Is(err, data.ErrInvalidPromoCode):
+		app.failedValidationResponse(w, r, map[string]string{"promoCode": err.Error()})
+	case errors.Is(err, data.ErrSeatsRequired):
+		app.failedValidationResponse(w, r, map[string]string{"seatIds": err.Error()})
+	case errors.Is(err, data.ErrSeatNotAvailable):
+		app.conflictResponse(w, r, err, err.Error())
+	default:
+		app.serverErrorResponse(w, r, err, input)
 	}
-
-}
\ No newline at end of file
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/AbrahamMayowa/ticketmania/internal/data"
+	"github.com/AbrahamMayowa/ticketmania/internal/validator"
+)
+
+// listTicketTypesHandler returns every ticket type of an event, including
+// sold out and paused ones.
+func (app *application) listTicketTypesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	event, err := app.models.Events.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user := app.contextGetUser(r)
+	if event.Status == data.EventDraft && (user.IsAnonymous() || event.UserID != *user.Id) {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	ticketTypes, err := app.models.TicketTypes.ListForEvent(r.Context(), event.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"data": ticketTypes}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+func (app *application) createTicketTypeHandler(w http.ResponseWriter, r *http.Request) {
+	event, ok := app.readEditableEvent(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Name        string     `json:"name"`
+		Price       int64      `json:"price"`
+		Currency    string     `json:"currency"`
+		TotalQty    int        `json:"total_qty"`
+		SalesStart  *time.Time `json:"sales_start"`
+		SalesEnd    *time.Time `json:"sales_end"`
+		SalesPaused bool       `json:"sales_paused"`
+		MinPerOrder *int       `json:"min_per_order"`
+		MaxPerOrder *int       `json:"max_per_order"`
+		MaxPerBuyer *int       `json:"max_per_buyer"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	tt := &data.TicketType{
+		EventID:     event.ID,
+		Name:        input.Name,
+		Price:       input.Price,
+		Currency:    strings.ToUpper(strings.TrimSpace(input.Currency)),
+		TotalQty:    input.TotalQty,
+		SalesStart:  input.SalesStart,
+		SalesEnd:    input.SalesEnd,
+		SalesPaused: input.SalesPaused,
+		MinPerOrder: 1,
+		MaxPerOrder: input.MaxPerOrder,
+		MaxPerBuyer: input.MaxPerBuyer,
+	}
+
+	if input.MinPerOrder != nil {
+		tt.MinPerOrder = *input.MinPerOrder
+	}
+
+	v := validator.New()
+	if data.ValidateTicketType(v, tt); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.TicketTypes.Insert(r.Context(), tt)
+	if err != nil {
+		app.ticketTypeErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"data": tt}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// updateTicketTypeHandler changes a ticket type's name, price, quantity or
+// sales window, or pauses and resumes its sales. Fields left out are kept;
+// send null for sales_start, sales_end or a maximum to remove it.
+func (app *application) updateTicketTypeHandler(w http.ResponseWriter, r *http.Request) {
+	event, ok := app.readEditableEvent(w, r)
+	if !ok {
+		return
+	}
+
+	tt, ok := app.readEventTicketType(w, r, event)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Name        *string      `json:"name"`
+		Price       *int64       `json:"price"`
+		Currency    *string      `json:"currency"`
+		TotalQty    *int         `json:"total_qty"`
+		SalesStart  nullableTime `json:"sales_start"`
+		SalesEnd    nullableTime `json:"sales_end"`
+		SalesPaused *bool        `json:"sales_paused"`
+		MinPerOrder *int         `json:"min_per_order"`
+		MaxPerOrder nullableInt  `json:"max_per_order"`
+		MaxPerBuyer nullableInt  `json:"max_per_buyer"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		tt.Name = *input.Name
+	}
+	if input.Price != nil {
+		tt.Price = *input.Price
+	}
+	if input.Currency != nil {
+		tt.Currency = strings.ToUpper(strings.TrimSpace(*input.Currency))
+	}
+	if input.TotalQty != nil {
+		tt.TotalQty = *input.TotalQty
+	}
+	if input.SalesStart.Set {
+		tt.SalesStart = input.SalesStart.Value
+	}
+	if input.SalesEnd.Set {
+		tt.SalesEnd = input.SalesEnd.Value
+	}
+	if input.SalesPaused != nil {
+		tt.SalesPaused = *input.SalesPaused
+	}
+	if input.MinPerOrder != nil {
+		tt.MinPerOrder = *input.MinPerOrder
+	}
+	if input.MaxPerOrder.Set {
+		tt.MaxPerOrder = input.MaxPerOrder.Value
+	}
+	if input.MaxPerBuyer.Set {
+		tt.MaxPerBuyer = input.MaxPerBuyer.Value
+	}
+
+	v := validator.New()
+	if data.ValidateTicketType(v, tt); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.TicketTypes.Update(r.Context(), tt)
+	if err != nil {
+		app.ticketTypeErrorResponse(w, r, err)
+		return
+	}
+
+	if input.TotalQty != nil || input.SalesPaused != nil {
+		app.triggerWaitlistOffers()
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"data": tt}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+func (app *application) deleteTicketTypeHandler(w http.ResponseWriter, r *http.Request) {
+	event, ok := app.readEditableEvent(w, r)
+	if !ok {
+		return
+	}
+
+	tt, ok := app.readEventTicketType(w, r, event)
+	if !ok {
+		return
+	}
+
+	err := app.models.TicketTypes.Delete(r.Context(), tt.ID)
+	if err != nil {
+		app.ticketTypeErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "ticket type successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// readEditableEvent is readOwnedEvent for changes that only make sense while
+// the event can still sell tickets.
+func (app *application) readEditableEvent(w http.ResponseWriter, r *http.Request) (*data.Event, bool) {
+	event, ok := app.readOwnedEvent(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	if event.Status == data.EventCancelled || event.Status == data.EventCompleted {
+		err := errors.New("cancelled or completed events cannot be changed")
+		app.conflictResponse(w, r, err, err.Error())
+		return nil, false
+	}
+
+	return event, true
+}
+
+// readEventTicketType loads the ticket type named by the :ticketTypeId
+// parameter, which must belong to event.
+func (app *application) readEventTicketType(w http.ResponseWriter, r *http.Request, event *data.Event) (*data.TicketType, bool) {
+	id, err := app.readNamedIDParam(r, "ticketTypeId")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	tt, err := app.models.TicketTypes.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	if tt.EventID != event.ID {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	return tt, true
+}
+
+func (app *application) ticketTypeErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		app.notFoundResponse(w, r)
+	case errors.Is(err, data.ErrDuplicateTicketType),
+		errors.Is(err, data.ErrTotalBelowSold),
+		errors.Is(err, data.ErrTicketTypeHasSales):
+		app.conflictResponse(w, r, err, err.Error())
+	case errors.Is(err, data.ErrOverCapacity):
+		app.failedValidationResponse(w, r, map[string]string{"total_qty": err.Error()})
+	default:
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/AbrahamMayowa/ticketmania/internal/data"
+	"github.com/AbrahamMayowa/ticketmania/internal/validator"
+)
+
+func (app *application) createVenueHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		Name      string   `json:"name"`
+		Address   string   `json:"address"`
+		Latitude  *float64 `json:"latitude"`
+		Longitude *float64 `json:"longitude"`
+		Timezone  string   `json:"timezone"`
+		Capacity  int      `json:"capacity"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	venue := &data.Venue{
+		UserID:    *user.Id,
+		Name:      strings.TrimSpace(input.Name),
+		Address:   strings.TrimSpace(input.Address),
+		Latitude:  input.Latitude,
+		Longitude: input.Longitude,
+		Timezone:  strings.TrimSpace(input.Timezone),
+		Capacity:  input.Capacity,
+	}
+	if venue.Timezone == "" {
+		venue.Timezone = "UTC"
+	}
+
+	v := validator.New()
+	if data.ValidateVenue(v, venue); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Venues.Insert(r.Context(), venue)
+	if err != nil {
+		app.serverErrorResponse(w, r, err, input)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"data": venue}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// listVenuesHandler lists venues by name, narrowed by q, which matches
+// names and addresses.
+func (app *application) listVenuesHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	query := strings.TrimSpace(qs.Get("q"))
+	page := app.readInt(qs, "page", 1)
+	perPage := app.readInt(qs, "limit", 20)
+
+	v := validator.New()
+	v.Check(len(query) <= 200, "q", "must not be more than 200 bytes")
+	v.Check(page >= 1 && page <= 10000, "page", "must be between 1 and 10000")
+	v.Check(perPage >= 1 && perPage <= 100, "limit", "must be between 1 and 100")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	venues, meta, err := app.models.Venues.List(r.Context(), query, page, perPage)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"data": venues, "meta": meta}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+func (app *application) getVenueHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	venue, err := app.models.Venues.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"data": venue}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// updateVenueHandler changes some of a venue's details. Clients must send the
+// version they last read. Coordinates sent as null are removed. Lowering the
+// capacity below the tickets of an upcoming event at the venue is refused.
+// Events keep their own timezone when the venue's changes.
+func (app *application) updateVenueHandler(w http.ResponseWriter, r *http.Request) {
+	venue, ok := app.readOwnedVenue(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Name      *string         `json:"name"`
+		Address   *string         `json:"address"`
+		Latitude  nullableFloat64 `json:"latitude"`
+		Longitude nullableFloat64 `json:"longitude"`
+		Timezone  *string         `json:"timezone"`
+		Capacity  *int            `json:"capacity"`
+		Version   *int            `json:"version"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if v.Check(input.Version != nil, "version", "must be provided"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if *input.Version != venue.Version {
+		app.editConflictResponse(w, r)
+		return
+	}
+
+	if input.Name != nil {
+		venue.Name = strings.TrimSpace(*input.Name)
+	}
+	if input.Address != nil {
+		venue.Address = strings.TrimSpace(*input.Address)
+	}
+	if input.Latitude.Set {
+		venue.Latitude = input.Latitude.Value
+	}
+	if input.Longitude.Set {
+		venue.Longitude = input.Longitude.Value
+	}
+	if input.Timezone != nil {
+		venue.Timezone = strings.TrimSpace(*input.Timezone)
+	}
+	if input.Capacity != nil {
+		venue.Capacity = *input.Capacity
+	}
+
+	if data.ValidateVenue(v, venue); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Venues.Update(r.Context(), venue)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrOverCapacity):
+			app.failedValidationResponse(w, r, map[string]string{"capacity": err.Error()})
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"data": venue}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// deleteVenueHandler removes a venue no event is held at.
+func (app *application) deleteVenueHandler(w http.ResponseWriter, r *http.Request) {
+	venue, ok := app.readOwnedVenue(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.models.Venues.Delete(r.Context(), venue.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrVenueInUse):
+			app.conflictResponse(w, r, err, err.Error())
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "venue successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// readOwnedVenue loads the venue named by the :id parameter and checks that
+// the current user added it. It writes the error response itself and reports
+// whether the handler should continue.
+func (app *application) readOwnedVenue(w http.ResponseWriter, r *http.Request) (*data.Venue, bool) {
+	user := app.contextGetUser(r)
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	venue, err := app.models.Venues.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	if user.IsAnonymous() || venue.UserID != *user.Id {
+		app.forbiddenResponse(w, r)
+		return nil, false
+	}
+
+	return venue, true
+}
+
+// readEventVenue loads the venue an event is being moved to. An unknown
+// venue fails validation. It writes the error response itself and reports
+// whether the handler should continue.
+func (app *application) readEventVenue(w http.ResponseWriter, r *http.Request, id int64) (*data.Venue, bool) {
+	venue, err := app.models.Venues.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.failedValidationResponse(w, r, map[string]string{"venue_id": "must be an existing venue"})
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return venue, true
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AbrahamMayowa/ticketmania/internal/data"
+	"github.com/AbrahamMayowa/ticketmania/internal/money"
+	"github.com/AbrahamMayowa/ticketmania/internal/validator"
+)
+
+// waitlistOfferBatch caps how many ticket types a single offer run handles.
+const waitlistOfferBatch = 100
+
+// joinWaitlistHandler puts a buyer in line for a sold out ticket type. Signed
+// in buyers are recorded so only they can pay for the hold they are offered.
+func (app *application) joinWaitlistHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Quantity   int    `json:"quantity"`
+		BuyerEmail string `json:"buyerEmail"`
+		BuyerPhone string `json:"buyerPhone"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	entry := &data.WaitlistEntry{
+		TicketTypeID: id,
+		UserID:       user.Id,
+		Email:        strings.TrimSpace(input.BuyerEmail),
+		Phone:        strings.TrimSpace(input.BuyerPhone),
+		Quantity:     input.Quantity,
+	}
+
+	v := validator.New()
+	if data.ValidateWaitlistEntry(v, entry); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Waitlist.Join(r.Context(), entry)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrEventNotOnSale), errors.Is(err, data.ErrTicketTypeNotOnSale):
+			app.badRequestResponse(w, r, err)
+		case errors.Is(err, data.ErrPurchaseLimit):
+			app.failedValidationResponse(w, r, map[string]string{"quantity": err.Error()})
+		case errors.Is(err, data.ErrTicketsStillAvailable), errors.Is(err, data.ErrAlreadyWaitlisted):
+			app.conflictResponse(w, r, err, err.Error())
+		default:
+			app.serverErrorResponse(w, r, err, input)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"data": entry}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// offerWaitlistTickets offers freed tickets to the buyers waiting for them
+// and emails each buyer their hold.
+func (app *application) offerWaitlistTickets(ctx context.Context) error {
+	ticketTypeIDs, err := app.models.Waitlist.OfferableTicketTypes(ctx, waitlistOfferBatch)
+	if err != nil {
+		return err
+	}
+
+	for _, ticketTypeID := range ticketTypeIDs {
+		offers, err := app.models.Waitlist.Offer(ctx, ticketTypeID, app.config.waitlist.offerTTL)
+		if err != nil {
+			return err
+		}
+
+		for _, offer := range offers {
+			app.logger.PrintInfo("offered waitlist tickets", map[string]string{
+				"waitlist_entry_id": strconv.FormatInt(offer.Entry.ID, 10),
+				"reservation_id":    strconv.FormatInt(*offer.Entry.ReservationID, 10),
+			})
+
+			offer := offer
+			app.background(func() {
+				err := app.mailer.Send([]string{offer.Entry.Email}, "waitlist_offer.tmpl", map[string]interface{}{
+					"eventTitle":     offer.EventTitle,
+					"ticketTypeName": offer.TicketType.Name,
+					"quantity":       offer.Entry.Quantity,
+					"amount":         money.New(offer.Order.Total, offer.Order.Currency).String(),
+					"reservationID":  *offer.Entry.ReservationID,
+					"secret":         offer.ReservationSecret,
+					"expiresAt":      offer.Entry.OfferExpiresAt.UTC().Format(time.RFC1123),
+				})
+				if err != nil {
+					app.logger.PrintError(err, nil)
+				}
+			})
+		}
+	}
+
+	return nil
+}
+
+// triggerWaitlistOffers runs an offer round straight away after inventory was
+// freed, instead of waiting for the next scheduled run.
+func (app *application) triggerWaitlistOffers() {
+	app.background(func() {
+		err := app.offerWaitlistTickets(context.Background())
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"job": "offer_waitlist_tickets"})
+		}
+	})
+}
@@ -0,0 +1,286 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type CheckInResult string
+
+const (
+	CheckInAccepted  CheckInResult = "accepted"
+	CheckInDuplicate CheckInResult = "duplicate"
+	CheckInRejected  CheckInResult = "rejected"
+)
+
+// ManifestEntry is what a scanner needs to know about a ticket offline.
+type ManifestEntry struct {
+	TicketID     int64        `json:"ticket_id"`
+	TicketTypeID int64        `json:"ticket_type_id"`
+	Status       TicketStatus `json:"status"`
+	UsedAt       *time.Time   `json:"used_at,omitempty"`
+	Revision     int64        `json:"revision"`
+}
+
+// Manifest is one page of an event's tickets changed since a cursor. Passing
+// NextCursor back as the cursor returns the following changes.
+type Manifest struct {
+	Tickets    []*ManifestEntry `json:"tickets"`
+	NextCursor string           `json:"next_cursor"`
+	HasMore    bool             `json:"has_more"`
+}
+
+// ManifestStart is the cursor of a scanner that has not synced yet.
+const ManifestStart = "0"
+
+// manifestCursor is the position after the last change handed out: the
+// transaction that wrote it and the ticket, as "xid.ticket_id".
+type manifestCursor struct {
+	xid      int64
+	ticketID int64
+}
+
+func (c manifestCursor) String() string {
+	if c.xid == 0 {
+		return ManifestStart
+	}
+	return fmt.Sprintf("%d.%d", c.xid, c.ticketID)
+}
+
+func parseManifestCursor(s string) (manifestCursor, error) {
+	if s == ManifestStart {
+		return manifestCursor{}, nil
+	}
+
+	xid, id, ok := strings.Cut(s, ".")
+	if !ok {
+		return manifestCursor{}, ErrInvalidCursor
+	}
+
+	var c manifestCursor
+	var err1, err2 error
+	c.xid, err1 = strconv.ParseInt(xid, 10, 64)
+	c.ticketID, err2 = strconv.ParseInt(id, 10, 64)
+	if err1 != nil || err2 != nil || c.xid <= 0 || c.ticketID <= 0 {
+		return manifestCursor{}, ErrInvalidCursor
+	}
+
+	return c, nil
+}
+
+// Scan is a single check-in reported by a scanner device.
+type Scan struct {
+	TicketID  int64
+	DeviceID  string
+	ScannedAt time.Time
+}
+
+// FirstScan identifies the scan that admitted a ticket.
+type FirstScan struct {
+	DeviceID  string    `json:"device_id"`
+	ScannedAt time.Time `json:"scanned_at"`
+}
+
+// ScanOutcome is the reconciled result of a Scan. Duplicates carry the scan
+// that admitted the ticket first so staff can investigate double entries.
+type ScanOutcome struct {
+	TicketID  int64         `json:"ticket_id"`
+	Result    CheckInResult `json:"result"`
+	Reason    string        `json:"reason,omitempty"`
+	FirstScan *FirstScan    `json:"first_scan,omitempty"`
+}
+
+type CheckInModel struct {
+	DB *sql.DB
+}
+
+// Manifest returns up to limit admissible, used or cancelled tickets of an
+// event changed after the since cursor, in the order the changes were made.
+// It fails with ErrInvalidCursor if since is not a cursor it returned.
+//
+// Only changes written by transactions older than every transaction still
+// running are handed out. A transaction that commits late therefore holds
+// back the changes made after it started, rather than being skipped, so a
+// scanner that follows the cursors sees every change exactly once it has
+// settled. Long-running transactions delay the manifest.
+func (m CheckInModel) Manifest(ctx context.Context, eventID int64, since string, limit int) (*Manifest, error) {
+	cursor, err := parseManifestCursor(since)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT id, ticket_type_id, status, used_at, revision, revision_xid
+		FROM tickets
+		WHERE event_id = $1
+		  AND (revision_xid, id) > ($2::text::xid8, $3)
+		  AND revision_xid < pg_snapshot_xmin(pg_current_snapshot())
+		  AND status IN ('paid', 'used', 'cancelled')
+		ORDER BY revision_xid, id
+		LIMIT $4
+	`
+
+	// Fetch one extra row to learn whether another page follows
+	rows, err := m.DB.QueryContext(ctx, query, eventID, cursor.xid, cursor.ticketID, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	manifest := &Manifest{
+		Tickets:    []*ManifestEntry{},
+		NextCursor: cursor.String(),
+	}
+
+	for rows.Next() {
+		var entry ManifestEntry
+		var xid int64
+		err := rows.Scan(&entry.TicketID, &entry.TicketTypeID, &entry.Status, &entry.UsedAt, &entry.Revision, &xid)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(manifest.Tickets) == limit {
+			manifest.HasMore = true
+			break
+		}
+
+		manifest.Tickets = append(manifest.Tickets, &entry)
+		manifest.NextCursor = manifestCursor{xid: xid, ticketID: entry.TicketID}.String()
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+// RecordScan reconciles an offline scan against the ticket's current status.
+// A paid ticket is admitted as of the scan time; a ticket that was already
+// admitted is reported as a duplicate. Uploading the same scan again returns
+// the original outcome.
+func (m CheckInModel) RecordScan(ctx context.Context, eventID int64, scan Scan) (*ScanOutcome, error) {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	committed := false
+	defer func() {
+		if !committed {
+			_ = tx.Rollback()
+		}
+	}()
+
+	outcome := &ScanOutcome{TicketID: scan.TicketID}
+
+	var (
+		ticketEventID int64
+		status        TicketStatus
+	)
+	err = tx.QueryRowContext(ctx, `
+		SELECT event_id, status FROM tickets WHERE id = $1 FOR UPDATE
+	`, scan.TicketID).Scan(&ticketEventID, &status)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			outcome.Result = CheckInRejected
+			outcome.Reason = "ticket not found"
+			return outcome, nil
+		}
+		return nil, err
+	}
+
+	// The device is retrying an upload we already processed
+	var reason sql.NullString
+	err = tx.QueryRowContext(ctx, `
+		SELECT result, reason FROM check_in_scans
+		WHERE device_id = $1 AND ticket_id = $2 AND scanned_at = $3
+	`, scan.DeviceID, scan.TicketID, scan.ScannedAt).Scan(&outcome.Result, &reason)
+	switch {
+	case err == nil:
+		outcome.Reason = reason.String
+		if outcome.Result == CheckInDuplicate {
+			outcome.FirstScan, err = firstScan(ctx, tx, scan.TicketID)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return outcome, nil
+	case !errors.Is(err, sql.ErrNoRows):
+		return nil, err
+	}
+
+	switch {
+	case ticketEventID != eventID:
+		outcome.Result = CheckInRejected
+		outcome.Reason = ErrTicketWrongEvent.Error()
+	case status == TicketPaid:
+		_, err = tx.ExecContext(ctx, `
+			UPDATE tickets SET status = 'used', used_at = $2 WHERE id = $1
+		`, scan.TicketID, scan.ScannedAt)
+		if err != nil {
+			return nil, err
+		}
+		outcome.Result = CheckInAccepted
+	case status == TicketUsed:
+		outcome.Result = CheckInDuplicate
+		outcome.Reason = ErrTicketAlreadyUsed.Error()
+		outcome.FirstScan, err = firstScan(ctx, tx, scan.TicketID)
+		if err != nil {
+			return nil, err
+		}
+	case status == TicketCancelled:
+		outcome.Result = CheckInRejected
+		outcome.Reason = ErrTicketCancelled.Error()
+	default:
+		outcome.Result = CheckInRejected
+		outcome.Reason = ErrTicketNotPaid.Error()
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO check_in_scans (event_id, ticket_id, device_id, scanned_at, result, reason)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''))
+	`, eventID, scan.TicketID, scan.DeviceID, scan.ScannedAt, outcome.Result, outcome.Reason)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	committed = true
+
+	return outcome, nil
+}
+
+// firstScan finds the scan that admitted a ticket. Tickets admitted before
+// scans were recorded fall back to their used_at time.
+func firstScan(ctx context.Context, tx *sql.Tx, ticketID int64) (*FirstScan, error) {
+	var first FirstScan
+	err := tx.QueryRowContext(ctx, `
+		SELECT device_id, scanned_at FROM check_in_scans
+		WHERE ticket_id = $1 AND result = 'accepted'
+		ORDER BY scanned_at
+		LIMIT 1
+	`, ticketID).Scan(&first.DeviceID, &first.ScannedAt)
+	if err == nil {
+		return &first, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	var usedAt *time.Time
+	err = tx.QueryRowContext(ctx, `SELECT used_at FROM tickets WHERE id = $1`, ticketID).Scan(&usedAt)
+	if err != nil || usedAt == nil {
+		return nil, err
+	}
+
+	return &FirstScan{DeviceID: "unknown", ScannedAt: *usedAt}, nil
+}
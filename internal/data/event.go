@@ -7,9 +7,11 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"strings"
 	"time"
 
 	"github.com/AbrahamMayowa/ticketmania/internal/validator"
+	"github.com/lib/pq"
 )
 
 type EventStatus string
@@ -21,6 +23,32 @@ const (
 	EventCompleted EventStatus = "completed"
 )
 
+// eventTransitions lists the statuses an event may move to from each status.
+// Cancelled and completed events are final.
+var eventTransitions = map[EventStatus][]EventStatus{
+	EventDraft:     {EventPublished, EventCancelled},
+	EventPublished: {EventCancelled, EventCompleted},
+}
+
+// CanTransitionTo reports whether an event may move from s to status to.
+func (s EventStatus) CanTransitionTo(to EventStatus) bool {
+	for _, allowed := range eventTransitions[s] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// RefundPolicy decides how much a ticket holder gets back when they cancel.
+type RefundPolicy string
+
+const (
+	RefundFull    RefundPolicy = "full"
+	RefundPartial RefundPolicy = "partial"
+	RefundNone    RefundPolicy = "none"
+)
+
 type Event struct {
 	ID          int64  `json:"id"`
 	Title       string `json:"title"`
@@ -34,12 +62,164 @@ type Event struct {
 
 	Status EventStatus `json:"status"`
 
-	Date time.Time `json:"date"`
+	// SeriesID is set on the occurrences of an event series.
+	SeriesID *int64 `json:"series_id,omitempty"`
+
+	// VenueID is set for events held at a known venue, which caps how many
+	// tickets the event can have.
+	VenueID *int64 `json:"venue_id"`
+
+	// Coordinates of the event's location in decimal degrees, for finding
+	// events nearby. Either both are set or neither.
+	Latitude  *float64 `json:"latitude"`
+	Longitude *float64 `json:"longitude"`
+
+	// The event runs from StartTime on Date to EndTime on EndDate, local
+	// time in Timezone, an IANA name such as Africa/Lagos.
+	Date     time.Time `json:"date"`
+	EndDate  time.Time `json:"end_date"`
+	Timezone string    `json:"timezone"`
+
+	// Holder cancellations are refunded per RefundPolicy until
+	// RefundCutoffHours before the event starts, and not at all after that.
+	RefundPolicy      RefundPolicy `json:"refund_policy"`
+	RefundPercent     int          `json:"refund_percent"` // used by the partial policy
+	RefundCutoffHours int          `json:"refund_cutoff_hours"`
+
+	// Pricing sets the service fees and tax added to orders.
+	Pricing
+
+	// Version is incremented on every change and guards against edits
+	// overwriting each other.
+	Version int `json:"version"`
 
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// eventColumns are the events columns read by eventFields, for queries that
+// alias the table as e.
+const eventColumns = `e.id, e.title, e.description, e.location, e.start_time, e.end_time, e.user_id, e.status,
+	e.created_at, e.updated_at, e.date, e.refund_policy, e.refund_percent, e.refund_cutoff_hours, e.version,
+	e.service_fee_flat, e.service_fee_bps, e.fees_absorbed, e.tax_rate_bps, e.end_date, e.timezone, e.series_id, e.venue_id,
+	e.latitude, e.longitude`
+
+// eventFields returns scan destinations matching eventColumns.
+func eventFields(e *Event) []interface{} {
+	return []interface{}{
+		&e.ID,
+		&e.Title,
+		&e.Description,
+		&e.Location,
+		&e.StartTime,
+		&e.EndTime,
+		&e.UserID,
+		&e.Status,
+		&e.CreatedAt,
+		&e.UpdatedAt,
+		&e.Date,
+		&e.RefundPolicy,
+		&e.RefundPercent,
+		&e.RefundCutoffHours,
+		&e.Version,
+		&e.ServiceFeeFlat,
+		&e.ServiceFeeBps,
+		&e.FeesAbsorbed,
+		&e.TaxRateBps,
+		&e.EndDate,
+		&e.Timezone,
+		&e.SeriesID,
+		&e.VenueID,
+		&e.Latitude,
+		&e.Longitude,
+	}
+}
+
+// maxEventLength caps how long a single event can run.
+const maxEventLength = 31 * 24 * time.Hour
+
+// StartsAt returns the moment the event starts, in its timezone.
+func (e *Event) StartsAt() time.Time {
+	return localInstant(e.Date, e.StartTime, e.location())
+}
+
+// EndsAt returns the moment the event ends, in its timezone.
+func (e *Event) EndsAt() time.Time {
+	return localInstant(e.EndDate, e.EndTime, e.location())
+}
+
+// location returns the event's timezone, or UTC if it is not a known zone.
+func (e *Event) location() *time.Location {
+	loc, err := time.LoadLocation(e.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// localInstant returns the moment the clock shows clock on date in loc.
+// Clock times skipped by a daylight saving change move forward by the gap.
+func localInstant(date time.Time, clock string, loc *time.Location) time.Time {
+	y, mo, d := date.Date()
+
+	t, err := parseClock(clock)
+	if err != nil {
+		return time.Date(y, mo, d, 0, 0, 0, 0, loc)
+	}
+
+	return time.Date(y, mo, d, t.Hour(), t.Minute(), t.Second(), 0, loc)
+}
+
+// EventInstant is a moment shown both as the local time at the event and
+// in UTC.
+type EventInstant struct {
+	Local time.Time `json:"local"`
+	UTC   time.Time `json:"utc"`
+}
+
+func newEventInstant(t time.Time) EventInstant {
+	return EventInstant{Local: t, UTC: t.UTC()}
+}
+
+// MarshalJSON adds the start and end instants worked out from the stored
+// local dates, times and timezone.
+func (e Event) MarshalJSON() ([]byte, error) {
+	type event Event
+	return json.Marshal(struct {
+		event
+		StartsAt EventInstant `json:"starts_at"`
+		EndsAt   EventInstant `json:"ends_at"`
+	}{event(e), newEventInstant(e.StartsAt()), newEventInstant(e.EndsAt())})
+}
+
+// parseClock parses a time of day as sent by clients ("15:04") or read back
+// from a Postgres time column ("15:04:05").
+func parseClock(s string) (time.Time, error) {
+	t, err := time.Parse("15:04:05", s)
+	if err != nil {
+		return time.Parse("15:04", s)
+	}
+	return t, nil
+}
+
+// RefundFor returns how much of amount a ticket holder cancelling at now gets
+// back under the event's refund policy.
+func (e *Event) RefundFor(amount int64, now time.Time) int64 {
+	cutoff := e.StartsAt().Add(-time.Duration(e.RefundCutoffHours) * time.Hour)
+	if !now.Before(cutoff) {
+		return 0
+	}
+
+	switch e.RefundPolicy {
+	case RefundFull:
+		return amount
+	case RefundPartial:
+		return amount * int64(e.RefundPercent) / 100
+	default:
+		return 0
+	}
+}
+
 type TicketType struct {
 	ID      int64  `json:"id"`
 	EventID int64  `json:"event_id"`
@@ -49,8 +229,22 @@ type TicketType struct {
 	Price    int64  `json:"price"`
 	Currency string `json:"currency"`
 
-	TotalQty int `json:"total_qty"` // total available
-	SoldQty  int `json:"sold_qty"`  // cached counter (important)
+	TotalQty    int `json:"total_qty"`    // total available
+	SoldQty     int `json:"sold_qty"`     // cached counter (important)
+	ReservedQty int `json:"reserved_qty"` // held by unexpired reservations
+
+	// Tickets can only be bought between SalesStart and SalesEnd, when set,
+	// and while sales are not paused.
+	SalesStart  *time.Time `json:"sales_start"`
+	SalesEnd    *time.Time `json:"sales_end"`
+	SalesPaused bool       `json:"sales_paused"`
+
+	// Purchase limits. MaxPerBuyer counts the tickets of this type a buyer
+	// (by user ID or buyer email) currently holds or has bought; cancelled
+	// and released tickets don't count. Nil means no limit.
+	MinPerOrder int  `json:"min_per_order"`
+	MaxPerOrder *int `json:"max_per_order"`
+	MaxPerBuyer *int `json:"max_per_buyer"`
 
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
@@ -58,11 +252,12 @@ type TicketType struct {
 
 
 
-type EventModel struct {
-	DB *sql.DB
+// Available returns how many tickets of this type can still be sold or held.
+func (tt *TicketType) Available() int {
+	return tt.TotalQty - tt.SoldQty - tt.ReservedQty
 }
 
-type TicketTypeModel struct {
+type EventModel struct {
 	DB *sql.DB
 }
 
@@ -71,13 +266,23 @@ type TicketTypeModel struct {
 type EventWithTicketTypes struct {
 	Event       Event         `json:"event"`
 	TicketTypes []*TicketType `json:"ticket_types"`
+
+	// Search is set when the event was found by a full-text search.
+	Search *SearchMatch `json:"search,omitempty"`
+
+	// DistanceKm is set when searching near a point.
+	DistanceKm *float64 `json:"distance_km,omitempty"`
 }
 
+// PaginationMeta describes a page of a list. Pages read by cursor are not
+// counted, so CurrentPage, TotalPages and Total are left out for them.
+// NextCursor is null on the last page.
 type PaginationMeta struct {
-	CurrentPage int `json:"current_page"`
-	PerPage     int `json:"per_page"`
-	TotalPages  int `json:"total_pages"`
-	Total       int `json:"total"`
+	CurrentPage int     `json:"current_page,omitempty"`
+	PerPage     int     `json:"per_page"`
+	TotalPages  *int    `json:"total_pages,omitempty"`
+	Total       *int    `json:"total,omitempty"`
+	NextCursor  *string `json:"next_cursor"`
 }
 
 type EventListResponse struct {
@@ -85,22 +290,39 @@ type EventListResponse struct {
 	Meta PaginationMeta          `json:"meta"`
 }
 
-func validateTimeRange(start, end string) bool {
-	startT, err := time.Parse("15:04", start)
-	if err != nil {
-		return false
-	}
-
-	endT, err := time.Parse("15:04", end)
-	if err != nil {
-		return false
+// ValidateRefundPolicy checks the refund settings of an event.
+func ValidateRefundPolicy(v *validator.Validator, e *Event) {
+	switch e.RefundPolicy {
+	case RefundFull, RefundPartial, RefundNone:
+	default:
+		v.AddError("refund_policy", "must be full, partial or none")
 	}
+	v.Check(e.RefundPercent >= 0 && e.RefundPercent <= 100, "refund_percent", "must be between 0 and 100")
+	v.Check(e.RefundCutoffHours >= 0, "refund_cutoff_hours", "must be >= 0")
+}
 
-	if !startT.Before(endT) {
-		return false
+// validateSchedule checks the event's timezone and that it ends after it
+// starts, on the same day or a later one.
+func validateSchedule(v *validator.Validator, e *Event) {
+	v.Check(validTimezone(e.Timezone), "timezone", "must be an IANA timezone, such as Africa/Lagos")
+
+	_, startErr := parseClock(e.StartTime)
+	v.Check(startErr == nil, "start_time", "must be a valid time, such as 19:00")
+	_, endErr := parseClock(e.EndTime)
+	v.Check(endErr == nil, "end_time", "must be a valid time, such as 23:30")
+	v.Check(!e.EndDate.Before(e.Date), "end_date", "must not be before date")
+
+	if startErr == nil && endErr == nil && v.Valid() {
+		length := e.EndsAt().Sub(e.StartsAt())
+		v.Check(length > 0, "end_time", "must be after the start; set end_date for events that end on a later day")
+		v.Check(length <= maxEventLength, "end_date", "events must not run for more than 31 days")
 	}
+}
 
-	return true
+// validTimezone reports whether name is a known IANA timezone.
+func validTimezone(name string) bool {
+	_, err := time.LoadLocation(name)
+	return name != "" && name != "Local" && err == nil
 }
 
 func ValidateEvent(v *validator.Validator, e *Event) {
@@ -109,8 +331,12 @@ func ValidateEvent(v *validator.Validator, e *Event) {
 	v.Check(e.StartTime != "", "start_time", "must be provided")
 	v.Check(e.EndTime != "", "end_time", "must be provided")
 	v.Check(!e.Date.IsZero(), "date", "must be provided")
-	v.Check(validateTimeRange(e.StartTime, e.EndTime), "start_time", "must be valid time, and start_time before end_time")
+	v.Check(!e.EndDate.IsZero(), "end_date", "must be provided")
+	validateSchedule(v, e)
 	v.Check(e.UserID > 0, "user_id", "must be provided")
+	ValidateRefundPolicy(v, e)
+	ValidatePricing(v, &e.Pricing)
+	validateCoordinates(v, e.Latitude, e.Longitude)
 }
 
 // ValidateTicketType runs basic checks on a TicketType.
@@ -118,8 +344,19 @@ func ValidateTicketType(v *validator.Validator, tt *TicketType) {
 	v.Check(tt.Name != "", "name", "must be provided")
 	v.Check(len(tt.Name) <= 255, "name", "must not be more than 255 bytes")
 	v.Check(tt.Price >= 0, "price", "must be >= 0")
-	v.Check(tt.Currency != "", "currency", "must be provided")
+	validateCurrency(v, "currency", tt.Currency)
 	v.Check(tt.TotalQty >= 0, "total_qty", "must be >= 0")
+	if tt.SalesStart != nil && tt.SalesEnd != nil {
+		v.Check(tt.SalesStart.Before(*tt.SalesEnd), "sales_end", "must be after sales_start")
+	}
+	v.Check(tt.MinPerOrder >= 1, "min_per_order", "must be >= 1")
+	if tt.MaxPerOrder != nil {
+		v.Check(*tt.MaxPerOrder >= tt.MinPerOrder, "max_per_order", "must be >= min_per_order")
+	}
+	if tt.MaxPerBuyer != nil {
+		v.Check(*tt.MaxPerBuyer >= 1, "max_per_buyer", "must be >= 1")
+		v.Check(*tt.MaxPerBuyer >= tt.MinPerOrder, "max_per_buyer", "must be >= min_per_order")
+	}
 }
 
 func (m EventModel) InsertEvent(e *Event, ticketTypes []*TicketType) error {
@@ -137,13 +374,30 @@ func (m EventModel) InsertEvent(e *Event, ticketTypes []*TicketType) error {
 		}
 	}()
 
+	err = insertEvent(ctx, tx, e, ticketTypes)
+	if err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	committed = true
+	return nil
+}
+
+// insertEvent adds an event and its ticket types in tx.
+func insertEvent(ctx context.Context, tx *sql.Tx, e *Event, ticketTypes []*TicketType) error {
 	// Insert event
 	eventQuery := `
-        INSERT INTO events (title, description, location, start_time, end_time, user_id, status, date)
-        VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-        RETURNING id, created_at, updated_at
+        INSERT INTO events (title, description, location, start_time, end_time, user_id, status, date,
+            refund_policy, refund_percent, refund_cutoff_hours,
+            service_fee_flat, service_fee_bps, fees_absorbed, tax_rate_bps,
+            end_date, timezone, starts_at, ends_at, series_id, venue_id, latitude, longitude)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23)
+        RETURNING id, version, created_at, updated_at
     `
-	err = tx.QueryRowContext(ctx, eventQuery,
+	err := tx.QueryRowContext(ctx, eventQuery,
 		e.Title,
 		e.Description,
 		e.Location,
@@ -152,7 +406,22 @@ func (m EventModel) InsertEvent(e *Event, ticketTypes []*TicketType) error {
 		e.UserID,
 		e.Status,
 		e.Date,
-	).Scan(&e.ID, &e.CreatedAt, &e.UpdatedAt)
+		e.RefundPolicy,
+		e.RefundPercent,
+		e.RefundCutoffHours,
+		e.ServiceFeeFlat,
+		e.ServiceFeeBps,
+		e.FeesAbsorbed,
+		e.TaxRateBps,
+		e.EndDate,
+		e.Timezone,
+		e.StartsAt(),
+		e.EndsAt(),
+		e.SeriesID,
+		e.VenueID,
+		e.Latitude,
+		e.Longitude,
+	).Scan(&e.ID, &e.Version, &e.CreatedAt, &e.UpdatedAt)
 	if err != nil {
 		return err
 	}
@@ -161,25 +430,107 @@ func (m EventModel) InsertEvent(e *Event, ticketTypes []*TicketType) error {
 	for _, tt := range ticketTypes {
 		tt.EventID = e.ID
 
-		ttQuery := `
-            INSERT INTO ticket_types
-                (event_id, name, price, currency, total_qty, sold_qty)
-            VALUES ($1,$2,$3,$4,$5,$6)
-            RETURNING id, created_at, updated_at
-        `
-		err = tx.QueryRowContext(ctx, ttQuery,
-			tt.EventID,
-			tt.Name,
-			tt.Price,
-			tt.Currency,
-			tt.TotalQty,
-			tt.SoldQty,
-		).Scan(&tt.ID, &tt.CreatedAt, &tt.UpdatedAt)
+		err = insertTicketType(ctx, tx, tt)
 		if err != nil {
 			return err
 		}
 	}
 
+	return checkVenueCapacity(ctx, tx, e.ID)
+}
+
+// Get returns an event without its ticket types.
+func (m EventModel) Get(ctx context.Context, id int64) (*Event, error) {
+	query := `
+	SELECT ` + eventColumns + `
+	FROM events e
+	WHERE e.id = $1
+	`
+
+	var e Event
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(eventFields(&e)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &e, nil
+}
+
+// UpdateRefundPolicy stores the refund settings of an event. It only affects
+// cancellations made after the change.
+func (m EventModel) UpdateRefundPolicy(ctx context.Context, e *Event) error {
+	query := `
+		UPDATE events
+		SET refund_policy = $3, refund_percent = $4, refund_cutoff_hours = $5,
+		    version = version + 1, updated_at = now()
+		WHERE id = $1 AND version = $2
+		RETURNING version, updated_at
+	`
+
+	err := m.DB.QueryRowContext(ctx, query, e.ID, e.Version, e.RefundPolicy, e.RefundPercent, e.RefundCutoffHours).Scan(&e.Version, &e.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UpdatePricing stores the fee and tax settings of an event. Orders already
+// placed keep the amounts they were priced with.
+func (m EventModel) UpdatePricing(ctx context.Context, e *Event) error {
+	query := `
+		UPDATE events
+		SET service_fee_flat = $3, service_fee_bps = $4, fees_absorbed = $5, tax_rate_bps = $6,
+		    version = version + 1, updated_at = now()
+		WHERE id = $1 AND version = $2
+		RETURNING version, updated_at
+	`
+
+	err := m.DB.QueryRowContext(ctx, query, e.ID, e.Version,
+		e.ServiceFeeFlat, e.ServiceFeeBps, e.FeesAbsorbed, e.TaxRateBps).Scan(&e.Version, &e.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Update saves the editable fields of an event. It fails with ErrEditConflict
+// if the event changed since e was read, going by e.Version, and with
+// ErrOverCapacity if its tickets do not fit its venue.
+func (m EventModel) Update(ctx context.Context, e *Event) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	committed := false
+	defer func() {
+		if !committed {
+			_ = tx.Rollback()
+		}
+	}()
+
+	err = updateEvent(ctx, tx, e)
+	if err != nil {
+		return err
+	}
+
 	if err = tx.Commit(); err != nil {
 		return err
 	}
@@ -187,96 +538,278 @@ func (m EventModel) InsertEvent(e *Event, ticketTypes []*TicketType) error {
 	return nil
 }
 
-func (m EventModel) GetWithTicketTypes(ctx context.Context, eventID int64) (*EventWithTicketTypes, error) {
+func updateEvent(ctx context.Context, tx *sql.Tx, e *Event) error {
 	query := `
-	SELECT
-	  e.id,
-	  e.title,
-	  e.description,
-	  e.location,
-	  e.start_time,
-	  e.end_time,
-	  e.user_id,
-	  e.status,
-	  e.created_at,
-	  e.updated_at,
-	  e.date,
-
-	  tt.id,
-	  tt.event_id,
-	  tt.name,
-	  tt.price,
-	  tt.currency,
-	  tt.total_qty,
-	  tt.sold_qty,
-	  tt.created_at,
-	  tt.updated_at
-	FROM events e
-	LEFT JOIN ticket_types tt ON tt.event_id = e.id
-	WHERE e.id = $1
-	ORDER BY tt.created_at ASC;
+		UPDATE events
+		SET title = $3, description = $4, location = $5, date = $6, start_time = $7, end_time = $8,
+		    refund_policy = $9, refund_percent = $10, refund_cutoff_hours = $11,
+		    service_fee_flat = $12, service_fee_bps = $13, fees_absorbed = $14, tax_rate_bps = $15,
+		    end_date = $16, timezone = $17, starts_at = $18, ends_at = $19, venue_id = $20,
+		    latitude = $21, longitude = $22,
+		    version = version + 1, updated_at = now()
+		WHERE id = $1 AND version = $2
+		RETURNING version, updated_at
 	`
 
-	rows, err := m.DB.QueryContext(ctx, query, eventID)
+	err := tx.QueryRowContext(ctx, query,
+		e.ID,
+		e.Version,
+		e.Title,
+		e.Description,
+		e.Location,
+		e.Date,
+		e.StartTime,
+		e.EndTime,
+		e.RefundPolicy,
+		e.RefundPercent,
+		e.RefundCutoffHours,
+		e.ServiceFeeFlat,
+		e.ServiceFeeBps,
+		e.FeesAbsorbed,
+		e.TaxRateBps,
+		e.EndDate,
+		e.Timezone,
+		e.StartsAt(),
+		e.EndsAt(),
+		e.VenueID,
+		e.Latitude,
+		e.Longitude,
+	).Scan(&e.Version, &e.UpdatedAt)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
-			return nil, ErrRecordNotFound
+			return ErrEditConflict
 		default:
-			return nil, err
+			return err
 		}
 	}
-	defer rows.Close()
 
-	var event *Event
-	ticketTypes := make([]*TicketType, 0)
+	return checkVenueCapacity(ctx, tx, e.ID)
+}
 
-	for rows.Next() {
-		var e Event
-		tt := &TicketType{}
-
-		err := rows.Scan(
-			&e.ID,
-			&e.Title,
-			&e.Description,
-			&e.Location,
-			&e.StartTime,
-			&e.EndTime,
-			&e.UserID,
-			&e.Status,
-			&e.CreatedAt,
-			&e.UpdatedAt,
-			&e.Date,
-
-			&tt.ID,
-			&tt.EventID,
-			&tt.Name,
-			&tt.Price,
-			&tt.Currency,
-			&tt.TotalQty,
-			&tt.SoldQty,
-			&tt.CreatedAt,
-			&tt.UpdatedAt,
+// Delete removes an event with its ticket types. Events with tickets that
+// were ever paid for, or are held for a buyer right now, are kept for their
+// sales records and have to be cancelled instead.
+func (m EventModel) Delete(ctx context.Context, id int64) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	committed := false
+	defer func() {
+		if !committed {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var hasSales bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM tickets
+			WHERE event_id = e.id AND (paid_at IS NOT NULL OR status IN ('reserved', 'paid', 'used'))
 		)
+		FROM events e
+		WHERE e.id = $1
+		FOR UPDATE OF e
+	`, id).Scan(&hasSales)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	if hasSales {
+		return ErrEventHasSales
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM events WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	committed = true
+	return nil
+}
+
+// Publish puts a draft event on sale.
+func (m EventModel) Publish(ctx context.Context, id int64) (*Event, error) {
+	return m.transition(ctx, id, EventPublished)
+}
+
+// Complete closes a published event once it has taken place.
+func (m EventModel) Complete(ctx context.Context, id int64) (*Event, error) {
+	return m.transition(ctx, id, EventCompleted)
+}
+
+func (m EventModel) transition(ctx context.Context, id int64, to EventStatus) (*Event, error) {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	committed := false
+	defer func() {
+		if !committed {
+			_ = tx.Rollback()
+		}
+	}()
+
+	e, err := transitionEvent(ctx, tx, id, to)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	committed = true
+
+	return e, nil
+}
+
+// Cancel stops sales for an event, releases its active reservations and
+// cancels its paid tickets with a full refund. The returned refunds still have
+// to be settled with the payment provider.
+func (m EventModel) Cancel(ctx context.Context, id, requestedBy int64, reason string) (*Event, []*Refund, error) {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	committed := false
+	defer func() {
+		if !committed {
+			_ = tx.Rollback()
+		}
+	}()
+
+	// The event row stays locked until commit, so no purchase can start
+	// while its tickets are being cancelled
+	e, err := transitionEvent(ctx, tx, id, EventCancelled)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reservationIDs, err := queryIDs(ctx, tx, `
+		SELECT id FROM reservations
+		WHERE event_id = $1 AND status = 'active'
+		ORDER BY id
+		FOR UPDATE
+	`, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(reservationIDs) > 0 {
+		err = releaseReservations(ctx, tx, reservationIDs, ReservationCancelled)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE waitlist_entries SET status = 'cancelled', updated_at = now()
+		WHERE event_id = $1 AND status = 'waiting'
+	`, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ticketIDs, err := queryIDs(ctx, tx, `
+		SELECT id FROM tickets WHERE event_id = $1 AND status = 'paid' ORDER BY id
+	`, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	refunds := []*Refund{}
+	if len(ticketIDs) > 0 {
+		refunds, err = cancelTickets(ctx, tx, e, CancelRequest{
+			EventID:     id,
+			TicketIDs:   ticketIDs,
+			RequestedBy: requestedBy,
+			Reason:      reason,
+			FullRefund:  true,
+		})
+		if err != nil {
+			return nil, nil, err
 		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+	committed = true
 
-		// Initialize event once
-		if event == nil {
-			event = &e
+	return e, refunds, nil
+}
+
+// transitionEvent locks an event and moves it to status to, if allowed.
+func transitionEvent(ctx context.Context, tx *sql.Tx, id int64, to EventStatus) (*Event, error) {
+	var e Event
+	err := tx.QueryRowContext(ctx, `SELECT `+eventColumns+` FROM events e WHERE e.id = $1 FOR UPDATE`, id).Scan(eventFields(&e)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
 		}
-		if tt.ID != 0 {
-			ticketTypes = append(ticketTypes, tt)
+	}
+
+	if !e.Status.CanTransitionTo(to) {
+		return nil, fmt.Errorf("cannot move a %s event to %s: %w", e.Status, to, ErrInvalidEventTransition)
+	}
+
+	err = tx.QueryRowContext(ctx, `
+		UPDATE events SET status = $2, version = version + 1, updated_at = now()
+		WHERE id = $1
+		RETURNING version, updated_at
+	`, id, to).Scan(&e.Version, &e.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	e.Status = to
+
+	return &e, nil
+}
+
+// queryIDs runs a query selecting a single id column.
+func queryIDs(ctx context.Context, q queryer, query string, args ...interface{}) ([]int64, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
 		}
+		ids = append(ids, id)
 	}
 
-	if err := rows.Err(); err != nil {
+	return ids, rows.Err()
+}
+
+func (m EventModel) GetWithTicketTypes(ctx context.Context, eventID int64) (*EventWithTicketTypes, error) {
+	event, err := m.Get(ctx, eventID)
+	if err != nil {
 		return nil, err
 	}
 
-	if event == nil {
-		return nil, ErrRecordNotFound
+	ticketTypes, err := TicketTypeModel{DB: m.DB}.ListForEvent(ctx, eventID)
+	if err != nil {
+		return nil, err
 	}
 
 	return &EventWithTicketTypes{
@@ -285,21 +818,49 @@ func (m EventModel) GetWithTicketTypes(ctx context.Context, eventID int64) (*Eve
 	}, nil
 }
 
-func (m EventModel) GetEventList(ctx context.Context, perPage int,
-	offset int) (*EventListResponse, error) {
+// GetEventList returns a page of events matching f, each with the ticket
+// types that match its ticket filters. Pages read by f.After continue right
+// after the previous page's last event, however the list changed since, and
+// skip the count. A cursor Postgres cannot read back returns
+// ErrInvalidCursor.
+func (m EventModel) GetEventList(ctx context.Context, f EventFilters) (*EventListResponse, error) {
+	q := newEventListQuery(f)
+	keys := q.sortKeys(f.Sort)
+	meta := PaginationMeta{PerPage: f.PerPage}
+
+	if f.After == "" {
+		countQuery := `SELECT COUNT(*) FROM events e WHERE ` + strings.Join(q.where, " AND ")
+
+		var totalEvents int
+		err := m.DB.QueryRowContext(ctx, countQuery, q.args...).Scan(&totalEvents)
+		if err != nil {
+			return nil, err
+		}
+
+		totalPages := int(math.Ceil(float64(totalEvents) / float64(f.PerPage)))
+		meta.CurrentPage = f.Page
+		meta.Total = &totalEvents
+		meta.TotalPages = &totalPages
+	} else {
+		values, err := decodeEventCursor(f.After, f.Sort)
+		if err != nil {
+			return nil, err
+		}
+		if len(values) != len(keys) {
+			return nil, ErrInvalidCursor
+		}
+		q.after(keys, values)
+	}
+
+	// One extra event tells whether there is a next page
+	pagination := `LIMIT ` + q.arg(f.PerPage+1)
+	if f.After == "" {
+		pagination += ` OFFSET ` + q.arg(f.offset())
+	}
+
 	query := `
 	SELECT
-		e.id,
-		e.title,
-		e.description,
-		e.location,
-		e.start_time,
-		e.end_time,
-		e.user_id,
-		e.status,
-		e.created_at,
-		e.updated_at,
-		e.date,
+		` + eventColumns + `,
 		COALESCE(
 			json_agg(
 				json_build_object(
@@ -309,81 +870,78 @@ func (m EventModel) GetEventList(ctx context.Context, perPage int,
 					'currency', tt.currency,
 					'total_qty', tt.total_qty,
 					'sold_qty', tt.sold_qty,
+					'reserved_qty', tt.reserved_qty,
+					'sales_start', tt.sales_start,
+					'sales_end', tt.sales_end,
+					'sales_paused', tt.sales_paused,
+					'min_per_order', tt.min_per_order,
+					'max_per_order', tt.max_per_order,
+					'max_per_buyer', tt.max_per_buyer,
 					'created_at', tt.created_at,
 					'updated_at', tt.updated_at
 				) ORDER BY tt.id
-			) FILTER (WHERE
-				tt.id IS NOT NULL
-				AND tt.total_qty > tt.sold_qty
-			),
+			) FILTER (WHERE tt.id IS NOT NULL AND ` + q.ticketTypeCondition("tt") + `),
 			'[]'
-		) AS ticket_types
+		) AS ticket_types,
+		` + keyColumn(keys) + q.searchColumns() + q.distanceColumn() + `
 	FROM events e
 	LEFT JOIN ticket_types tt ON tt.event_id = e.id
-	WHERE e.status = 'published'
-	  AND EXISTS (
-	      SELECT 1 FROM ticket_types tt2
-	      WHERE tt2.event_id = e.id
-	        AND tt2.total_qty > tt2.sold_qty
-	  )
+	WHERE ` + strings.Join(q.where, " AND ") + `
 	GROUP BY e.id
-	ORDER BY e.start_time ASC
-	LIMIT $1 OFFSET $2;
-	`
+	ORDER BY ` + orderBy(keys) + `
+	` + pagination
 
-	countQuery := `
-		SELECT COUNT(*)
-		FROM events e
-		WHERE e.status = 'published'
-		  AND EXISTS (
-		      SELECT 1 FROM ticket_types tt
-		      WHERE tt.event_id = e.id
-		        AND tt.total_qty > tt.sold_qty
-		  )
-	`
-
-	// Execute count query first
-	var totalEvents int
-	err := m.DB.QueryRowContext(ctx, countQuery).Scan(&totalEvents)
-	fmt.Printf("ticketType: %+v\n", err)
+	rows, err := m.DB.QueryContext(ctx, query, q.args...)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, ErrRecordNotFound
+		// Cursor values that do not convert back to the key types
+		var pgErr *pq.Error
+		if f.After != "" && errors.As(err, &pgErr) && pgErr.Code.Class() == "22" {
+			return nil, ErrInvalidCursor
 		}
 		return nil, err
 	}
-
-	// Execute main query
-	rows, err := m.DB.QueryContext(ctx, query, perPage, offset)
-	if err != nil {
-		return nil, err
-	}
 	defer rows.Close()
 
 	events := []*EventWithTicketTypes{}
+	var lastKey []byte
 
 	for rows.Next() {
 		var e Event
-		var ticketTypesJSON []byte
-
-		err := rows.Scan(
-			&e.ID,
-			&e.Title,
-			&e.Description,
-			&e.Location,
-			&e.StartTime,
-			&e.EndTime,
-			&e.UserID,
-			&e.Status,
-			&e.CreatedAt,
-			&e.UpdatedAt,
-			&e.Date,
-			&ticketTypesJSON,
-		)
+		var ticketTypesJSON, key []byte
+
+		dest := append(eventFields(&e), &ticketTypesJSON, &key)
+		var match *SearchMatch
+		if q.tsquery != "" {
+			match = &SearchMatch{}
+			dest = append(dest, match.fields()...)
+		}
+		var distance *float64
+		if q.distance != "" {
+			distance = new(float64)
+			dest = append(dest, distance)
+		}
+
+		err := rows.Scan(dest...)
 		if err != nil {
 			return nil, err
 		}
 
+		if len(events) == f.PerPage {
+			meta.NextCursor, err = nextEventCursor(f.Sort, lastKey)
+			if err != nil {
+				return nil, err
+			}
+			break
+		}
+		lastKey = key
+
+		if match != nil {
+			match.highlight()
+		}
+		if distance != nil {
+			*distance = math.Round(*distance*1000) / 1000 // to the metre
+		}
+
 		var ticketTypes []*TicketType
 		err = json.Unmarshal(ticketTypesJSON, &ticketTypes)
 		if err != nil {
@@ -393,6 +951,8 @@ func (m EventModel) GetEventList(ctx context.Context, perPage int,
 		eventWithTypes := &EventWithTicketTypes{
 			Event:       e,
 			TicketTypes: ticketTypes,
+			Search:      match,
+			DistanceKm:  distance,
 		}
 		events = append(events, eventWithTypes)
 	}
@@ -401,17 +961,16 @@ func (m EventModel) GetEventList(ctx context.Context, perPage int,
 		return nil, err
 	}
 
-	if len(events) == 0 {
-		return nil, sql.ErrNoRows
-	}
-
 	return &EventListResponse{
 		Data: events,
-		Meta: PaginationMeta{
-			CurrentPage: (offset / perPage) + 1,
-			PerPage:     perPage,
-			Total:       totalEvents,
-			TotalPages:  int(math.Ceil(float64(totalEvents) / float64(perPage))),
-		},
+		Meta: meta,
 	}, nil
 }
+
+func nextEventCursor(sort string, key []byte) (*string, error) {
+	cursor, err := encodeEventCursor(sort, key)
+	if err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
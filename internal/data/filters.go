@@ -0,0 +1,417 @@
+package data
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/AbrahamMayowa/ticketmania/internal/validator"
+	"github.com/lib/pq"
+)
+
+// Sort orders accepted by the event list.
+const (
+	SortByDate   = "date"   // soonest first
+	SortByPrice  = "price"  // cheapest matching ticket first
+	SortByNewest = "newest" // most recently created first
+
+	// SortByDistance puts the events closest to EventFilters.Near first. It
+	// is the default when searching near a point and only allowed then.
+	SortByDistance = "distance"
+
+	// SortByRelevance puts the best full-text matches first. It is the
+	// default when searching and only allowed then.
+	SortByRelevance = "relevance"
+)
+
+// Matches in search highlights are marked with these private use characters
+// by Postgres, so the text around them can be HTML escaped safely before the
+// marks are turned into <mark> tags.
+const (
+	highlightStart = "\uE000"
+	highlightStop  = "\uE001"
+)
+
+var highlightTags = strings.NewReplacer(highlightStart, "<mark>", highlightStop, "</mark>")
+
+// EventFilters narrows and orders the public event list. Zero values leave
+// a filter off.
+type EventFilters struct {
+	// Query is free text searched in titles, descriptions and locations.
+	// Words can be quoted as phrases or excluded with a minus sign.
+	Query string
+
+	// From and To keep events running on any day in the range, both
+	// inclusive, going by local dates.
+	From *time.Time
+	To   *time.Time
+
+	// Location matches events whose location contains it, ignoring case.
+	Location string
+
+	// MinPrice and MaxPrice keep events with a ticket type priced in the
+	// range, in the smallest unit of Currency when set.
+	MinPrice *int64
+	MaxPrice *int64
+	Currency string
+
+	OrganizerID *int64
+
+	// Near keeps events with coordinates within RadiusKm of it.
+	Near     *GeoPoint
+	RadiusKm float64
+
+	// Statuses defaults to published events only. Drafts are only listed
+	// for their organizer; the caller checks that.
+	Statuses []EventStatus
+
+	// IncludeSoldOut also lists events with nothing left to buy.
+	IncludeSoldOut bool
+
+	Sort    string
+	PerPage int
+
+	// After is the next_cursor of the previous page. Pages are read by
+	// cursor when it is set and by Page otherwise.
+	After string
+	Page  int
+}
+
+func ValidateEventFilters(v *validator.Validator, f *EventFilters) {
+	if f.After == "" {
+		v.Check(f.Page >= 1 && f.Page <= 10000, "page", "must be between 1 and 10000")
+	} else if _, err := decodeEventCursor(f.After, f.Sort); err != nil {
+		v.AddError("after", err.Error())
+	}
+	v.Check(f.PerPage >= 1 && f.PerPage <= 100, "limit", "must be between 1 and 100")
+
+	if f.From != nil && f.To != nil {
+		v.Check(!f.To.Before(*f.From), "to", "must not be before from")
+	}
+	v.Check(len(f.Location) <= 255, "location", "must not be more than 255 bytes")
+	v.Check(len(f.Query) <= 200, "q", "must not be more than 200 bytes")
+
+	if f.MinPrice != nil {
+		v.Check(*f.MinPrice >= 0, "min_price", "must be >= 0")
+	}
+	if f.MaxPrice != nil {
+		v.Check(*f.MaxPrice >= 0, "max_price", "must be >= 0")
+	}
+	if f.MinPrice != nil && f.MaxPrice != nil {
+		v.Check(*f.MaxPrice >= *f.MinPrice, "max_price", "must be >= min_price")
+	}
+	if f.Currency != "" {
+		validateCurrency(v, "currency", f.Currency)
+	}
+
+	if f.Near != nil {
+		v.Check(f.Near.Latitude >= -90 && f.Near.Latitude <= 90, "near", "latitude must be between -90 and 90")
+		v.Check(f.Near.Longitude >= -180 && f.Near.Longitude <= 180, "near", "longitude must be between -180 and 180")
+		v.Check(f.RadiusKm > 0 && f.RadiusKm <= MaxRadiusKm, "radius_km", fmt.Sprintf("must be more than 0 and at most %d", MaxRadiusKm))
+	} else {
+		v.Check(f.RadiusKm == 0, "radius_km", "can only be used with near")
+	}
+
+	for _, status := range f.Statuses {
+		switch status {
+		case EventDraft, EventPublished, EventCancelled, EventCompleted:
+		default:
+			v.AddError("status", "must be draft, published, cancelled or completed")
+		}
+	}
+
+	switch f.Sort {
+	case SortByDate, SortByPrice, SortByNewest:
+	case SortByRelevance:
+		v.Check(f.Query != "", "sort", "relevance can only be used with q")
+	case SortByDistance:
+		v.Check(f.Near != nil, "sort", "distance can only be used with near")
+	default:
+		v.AddError("sort", "must be relevance, distance, date, price or newest")
+	}
+}
+
+func (f EventFilters) offset() int {
+	return (f.Page - 1) * f.PerPage
+}
+
+// eventCursor is the position after the last event of a page: the sort it
+// was made for and that event's sort key values, as Postgres rendered them.
+type eventCursor struct {
+	Sort string          `json:"s"`
+	Key  json.RawMessage `json:"k"`
+}
+
+func encodeEventCursor(sort string, key []byte) (string, error) {
+	js, err := json.Marshal(eventCursor{Sort: sort, Key: key})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(js), nil
+}
+
+// decodeEventCursor reads a cursor made for sort and returns its key values
+// as query arguments. Postgres converts them back to the key types.
+func decodeEventCursor(s, sort string) ([]interface{}, error) {
+	js, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c eventCursor
+	if err := json.Unmarshal(js, &c); err != nil || c.Sort != sort {
+		return nil, ErrInvalidCursor
+	}
+
+	// Numbers are kept as written so ranks and ids lose no precision
+	var key []interface{}
+	d := json.NewDecoder(bytes.NewReader(c.Key))
+	d.UseNumber()
+	if err := d.Decode(&key); err != nil || len(key) == 0 {
+		return nil, ErrInvalidCursor
+	}
+
+	values := make([]interface{}, len(key))
+	for i, value := range key {
+		switch value := value.(type) {
+		case string:
+			values[i] = value
+		case json.Number:
+			values[i] = value.String()
+		default:
+			return nil, ErrInvalidCursor
+		}
+	}
+
+	return values, nil
+}
+
+// eventListQuery holds the SQL conditions built from EventFilters and the
+// arguments they refer to, so the filters never end up in the SQL text.
+type eventListQuery struct {
+	where      []string // conditions on events e
+	ticketType []string // conditions a listed ticket type tt must meet
+	tsquery    string   // the parsed search query, when searching
+	distance   string   // the distance from the point searched near, if any
+	args       []interface{}
+}
+
+// arg adds a query argument and returns its placeholder.
+func (q *eventListQuery) arg(value interface{}) string {
+	q.args = append(q.args, value)
+	return fmt.Sprintf("$%d", len(q.args))
+}
+
+// ticketTypeCondition returns the conditions of ticketType for the table
+// alias alias.
+func (q *eventListQuery) ticketTypeCondition(alias string) string {
+	if len(q.ticketType) == 0 {
+		return "true"
+	}
+	return strings.ReplaceAll(strings.Join(q.ticketType, " AND "), "tt.", alias+".")
+}
+
+func newEventListQuery(f EventFilters) *eventListQuery {
+	q := &eventListQuery{}
+
+	statuses := f.Statuses
+	if len(statuses) == 0 {
+		statuses = []EventStatus{EventPublished}
+	}
+	names := make([]string, len(statuses))
+	for i, s := range statuses {
+		names[i] = string(s)
+	}
+	q.where = append(q.where, "e.status::text = ANY("+q.arg(pq.Array(names))+")")
+
+	if f.Query != "" {
+		q.tsquery = "websearch_to_tsquery('english', " + q.arg(f.Query) + ")"
+		q.where = append(q.where, "e.search_vector @@ "+q.tsquery)
+	}
+	if f.From != nil {
+		q.where = append(q.where, "e.end_date >= "+q.arg(*f.From))
+	}
+	if f.To != nil {
+		q.where = append(q.where, "e.date <= "+q.arg(*f.To))
+	}
+	if f.Location != "" {
+		q.where = append(q.where, "e.location ILIKE '%' || "+q.arg(escapeLike(f.Location))+" || '%'")
+	}
+	if f.OrganizerID != nil {
+		q.where = append(q.where, "e.user_id = "+q.arg(*f.OrganizerID))
+	}
+	if f.Near != nil {
+		q.near(*f.Near, f.RadiusKm)
+	}
+
+	if !f.IncludeSoldOut {
+		q.ticketType = append(q.ticketType, "tt.total_qty > tt.sold_qty + tt.reserved_qty")
+	}
+	if f.MinPrice != nil {
+		q.ticketType = append(q.ticketType, "tt.price >= "+q.arg(*f.MinPrice))
+	}
+	if f.MaxPrice != nil {
+		q.ticketType = append(q.ticketType, "tt.price <= "+q.arg(*f.MaxPrice))
+	}
+	if f.Currency != "" {
+		q.ticketType = append(q.ticketType, "tt.currency = "+q.arg(f.Currency))
+	}
+
+	// Events must have a ticket type left that matches, unless sold out
+	// events were asked for and no ticket filter is set
+	if len(q.ticketType) > 0 {
+		q.where = append(q.where, `EXISTS (
+			SELECT 1 FROM ticket_types tt2
+			WHERE tt2.event_id = e.id AND `+q.ticketTypeCondition("tt2")+`
+		)`)
+	}
+
+	return q
+}
+
+// near keeps events within radiusKm of p, going by a bounding box first so
+// the index on coordinates can be used, then by the actual distance.
+func (q *eventListQuery) near(p GeoPoint, radiusKm float64) {
+	minLat, maxLat, minLng, maxLng, wholeLng := boundingBox(p, radiusKm)
+	q.where = append(q.where, "e.latitude BETWEEN "+q.arg(minLat)+" AND "+q.arg(maxLat))
+
+	switch {
+	case wholeLng:
+		q.where = append(q.where, "e.longitude IS NOT NULL")
+	case minLng <= maxLng:
+		q.where = append(q.where, "e.longitude BETWEEN "+q.arg(minLng)+" AND "+q.arg(maxLng))
+	default:
+		// The box crosses the antimeridian
+		q.where = append(q.where, "(e.longitude >= "+q.arg(minLng)+" OR e.longitude <= "+q.arg(maxLng)+")")
+	}
+
+	q.distance = distanceKm(q.arg(p.Latitude), q.arg(p.Longitude))
+	q.where = append(q.where, q.distance+" <= "+q.arg(radiusKm))
+}
+
+// sortKey is an expression the event list is ordered by.
+type sortKey struct {
+	expr string
+	desc bool
+}
+
+// sortKeys returns the keys of a sort. Every sort ends with the event id so
+// the order is total and pages never overlap.
+func (q *eventListQuery) sortKeys(sort string) []sortKey {
+	switch sort {
+	case SortByRelevance:
+		return []sortKey{{"ts_rank_cd(e.search_vector, " + q.tsquery + ")", true}, {"e.starts_at", false}, {"e.id", false}}
+	case SortByPrice:
+		// Events without a matching ticket type go last
+		minPrice := `COALESCE((
+			SELECT MIN(tt3.price) FROM ticket_types tt3
+			WHERE tt3.event_id = e.id AND ` + q.ticketTypeCondition("tt3") + `
+		), 9223372036854775807)`
+		return []sortKey{{minPrice, false}, {"e.starts_at", false}, {"e.id", false}}
+	case SortByNewest:
+		return []sortKey{{"e.created_at", true}, {"e.id", true}}
+	case SortByDistance:
+		return []sortKey{{q.distance, false}, {"e.starts_at", false}, {"e.id", false}}
+	default:
+		return []sortKey{{"e.starts_at", false}, {"e.id", false}}
+	}
+}
+
+// orderBy returns the ORDER BY clause for keys.
+func orderBy(keys []sortKey) string {
+	terms := make([]string, len(keys))
+	for i, k := range keys {
+		terms[i] = k.expr + " ASC"
+		if k.desc {
+			terms[i] = k.expr + " DESC"
+		}
+	}
+	return strings.Join(terms, ", ")
+}
+
+// keyColumn returns a column with the sort key values of a row as a JSON
+// array, for the next cursor.
+func keyColumn(keys []sortKey) string {
+	exprs := make([]string, len(keys))
+	for i, k := range keys {
+		exprs[i] = k.expr
+	}
+	return "json_build_array(" + strings.Join(exprs, ", ") + ")::text"
+}
+
+// after adds the condition for rows that come after the cursor values in
+// the order of keys.
+func (q *eventListQuery) after(keys []sortKey, values []interface{}) {
+	placeholders := make([]string, len(values))
+	for i, value := range values {
+		placeholders[i] = q.arg(value)
+	}
+
+	// Row comparisons cannot mix directions, so spell out the order
+	alternatives := make([]string, len(keys))
+	for i, k := range keys {
+		terms := []string{}
+		for j := 0; j < i; j++ {
+			terms = append(terms, keys[j].expr+" = "+placeholders[j])
+		}
+		op := " > "
+		if k.desc {
+			op = " < "
+		}
+		terms = append(terms, k.expr+op+placeholders[i])
+		alternatives[i] = "(" + strings.Join(terms, " AND ") + ")"
+	}
+
+	q.where = append(q.where, "("+strings.Join(alternatives, " OR ")+")")
+}
+
+// searchColumns returns the columns scanned by SearchMatch.fields, or nothing
+// when not searching. It adds arguments, so call it after the count query.
+func (q *eventListQuery) searchColumns() string {
+	if q.tsquery == "" {
+		return ""
+	}
+
+	marks := q.arg("StartSel=" + highlightStart + ", StopSel=" + highlightStop)
+	return `,
+		ts_rank_cd(e.search_vector, ` + q.tsquery + `),
+		ts_headline('english', e.title, ` + q.tsquery + `, ` + marks + ` || ', HighlightAll=true'),
+		ts_headline('english', e.description, ` + q.tsquery + `, ` + marks + ` || ', MaxWords=35, MinWords=15, MaxFragments=2')`
+}
+
+// distanceColumn returns the column scanned into the distance from the
+// point searched near, or nothing when not searching near one.
+func (q *eventListQuery) distanceColumn() string {
+	if q.distance == "" {
+		return ""
+	}
+	return ",\n\t\t" + q.distance
+}
+
+// SearchMatch shows how an event matched a full-text search. Title and
+// Description are HTML escaped, with the matching words wrapped in <mark>.
+type SearchMatch struct {
+	Rank        float64 `json:"rank"`
+	Title       string  `json:"title"`
+	Description string  `json:"description"`
+}
+
+// fields returns scan destinations matching searchColumns.
+func (m *SearchMatch) fields() []interface{} {
+	return []interface{}{&m.Rank, &m.Title, &m.Description}
+}
+
+// highlight escapes the scanned snippets and marks up their matches.
+func (m *SearchMatch) highlight() {
+	m.Title = highlightTags.Replace(html.EscapeString(m.Title))
+	m.Description = highlightTags.Replace(html.EscapeString(m.Description))
+}
+
+// escapeLike escapes the LIKE wildcards in s so it is matched literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,90 @@
+package data
+
+import (
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestEventCursorRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		sort string
+		key  string
+		want []interface{}
+	}{
+		{
+			name: "date",
+			sort: SortByDate,
+			key:  `["2026-06-01T19:00:00+00:00", 42]`,
+			want: []interface{}{"2026-06-01T19:00:00+00:00", "42"},
+		},
+		{
+			name: "relevance keeps numbers as written",
+			sort: SortByRelevance,
+			key:  `[0.060792714, "2026-06-01T19:00:00+00:00", 9007199254740993]`,
+			want: []interface{}{"0.060792714", "2026-06-01T19:00:00+00:00", "9007199254740993"},
+		},
+		{
+			name: "price",
+			sort: SortByPrice,
+			key:  `[9223372036854775807, "2026-06-01T19:00:00+00:00", 7]`,
+			want: []interface{}{"9223372036854775807", "2026-06-01T19:00:00+00:00", "7"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cursor, err := encodeEventCursor(tt.sort, []byte(tt.key))
+			if err != nil {
+				t.Fatalf("encodeEventCursor() error = %v", err)
+			}
+
+			got, err := decodeEventCursor(cursor, tt.sort)
+			if err != nil {
+				t.Fatalf("decodeEventCursor() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeEventCursor() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeEventCursorInvalid(t *testing.T) {
+	encode := func(js string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(js))
+	}
+
+	dateCursor, err := encodeEventCursor(SortByDate, []byte(`["2026-06-01T19:00:00+00:00", 42]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"made for another sort", dateCursor},
+		{"not base64", "not a cursor!"},
+		{"padded base64", base64.URLEncoding.EncodeToString([]byte(`{"s":"newest","k":[1]}`))},
+		{"not json", encode("garbage")},
+		{"key not an array", encode(`{"s":"newest","k":{"id":1}}`)},
+		{"empty key", encode(`{"s":"newest","k":[]}`)},
+		{"missing key", encode(`{"s":"newest"}`)},
+		{"null value", encode(`{"s":"newest","k":[null,1]}`)},
+		{"nested value", encode(`{"s":"newest","k":[[1],2]}`)},
+		{"boolean value", encode(`{"s":"newest","k":[true,2]}`)},
+		{"empty", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeEventCursor(tt.cursor, SortByNewest)
+			if !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("decodeEventCursor(%q) error = %v, want ErrInvalidCursor", tt.cursor, err)
+			}
+		})
+	}
+}
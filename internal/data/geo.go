@@ -0,0 +1,79 @@
+package data
+
+import (
+	"math"
+
+	"github.com/AbrahamMayowa/ticketmania/internal/validator"
+)
+
+const (
+	earthRadiusKm = 6371.0
+
+	// kmPerDegree is the length of a degree of latitude, and of longitude at
+	// the equator.
+	kmPerDegree = earthRadiusKm * math.Pi / 180
+
+	// MaxRadiusKm caps how far from a point events are searched for.
+	MaxRadiusKm = 500
+)
+
+// GeoPoint is a position in decimal degrees.
+type GeoPoint struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// validateCoordinates checks an optional pair of coordinates, which must be
+// set together.
+func validateCoordinates(v *validator.Validator, latitude, longitude *float64) {
+	v.Check((latitude == nil) == (longitude == nil), "latitude", "must be sent together with longitude")
+	if latitude != nil {
+		v.Check(*latitude >= -90 && *latitude <= 90, "latitude", "must be between -90 and 90")
+	}
+	if longitude != nil {
+		v.Check(*longitude >= -180 && *longitude <= 180, "longitude", "must be between -180 and 180")
+	}
+}
+
+// distanceKm returns a haversine expression for the distance in kilometres
+// between events e and the point with the latitude and longitude
+// placeholders lat and lng. It is null for events without coordinates.
+func distanceKm(lat, lng string) string {
+	return `(2 * 6371.0 * asin(sqrt(LEAST(1.0,
+		power(sin(radians(e.latitude - ` + lat + `) / 2), 2)
+		+ cos(radians(` + lat + `)) * cos(radians(e.latitude)) * power(sin(radians(e.longitude - ` + lng + `) / 2), 2)
+	))))`
+}
+
+// boundingBox returns the latitude and longitude ranges around p holding
+// every point within radiusKm of it, for a cheap indexed prefilter before
+// distances are worked out. The longitude range can wrap around the
+// antimeridian, in which case minLng > maxLng. wholeLng is set when every
+// longitude is in range, near the poles or for very large radiuses.
+func boundingBox(p GeoPoint, radiusKm float64) (minLat, maxLat, minLng, maxLng float64, wholeLng bool) {
+	dLat := radiusKm / kmPerDegree
+	minLat = math.Max(p.Latitude-dLat, -90)
+	maxLat = math.Min(p.Latitude+dLat, 90)
+	if minLat == -90 || maxLat == 90 {
+		return minLat, maxLat, -180, 180, true
+	}
+
+	// Degrees of longitude are shortest at the box's edge furthest from the
+	// equator, so that edge decides the width
+	edge := math.Max(math.Abs(minLat), math.Abs(maxLat))
+	dLng := radiusKm / (kmPerDegree * math.Cos(edge*math.Pi/180))
+	if dLng >= 180 {
+		return minLat, maxLat, -180, 180, true
+	}
+
+	minLng = p.Longitude - dLng
+	if minLng < -180 {
+		minLng += 360
+	}
+	maxLng = p.Longitude + dLng
+	if maxLng > 180 {
+		maxLng -= 360
+	}
+
+	return minLat, maxLat, minLng, maxLng, false
+}
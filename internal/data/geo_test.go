@@ -0,0 +1,79 @@
+package data
+
+import (
+	"math"
+	"testing"
+)
+
+// destination returns the point distanceKm from p along the given bearing in
+// degrees, on a sphere the size of the Earth.
+func destination(p GeoPoint, bearing, distanceKm float64) GeoPoint {
+	const rad = math.Pi / 180
+	lat1, lng1, b := p.Latitude*rad, p.Longitude*rad, bearing*rad
+	d := distanceKm / earthRadiusKm
+
+	lat2 := math.Asin(math.Sin(lat1)*math.Cos(d) + math.Cos(lat1)*math.Sin(d)*math.Cos(b))
+	lng2 := lng1 + math.Atan2(math.Sin(b)*math.Sin(d)*math.Cos(lat1), math.Cos(d)-math.Sin(lat1)*math.Sin(lat2))
+
+	lng := math.Mod(lng2/rad+540, 360) - 180
+	return GeoPoint{Latitude: lat2 / rad, Longitude: lng}
+}
+
+func TestBoundingBox(t *testing.T) {
+	tests := []struct {
+		name      string
+		p         GeoPoint
+		radiusKm  float64
+		wantWrap  bool
+		wantWhole bool
+	}{
+		{"equator", GeoPoint{0, 0}, 100, false, false},
+		{"city", GeoPoint{6.5244, 3.3792}, 50, false, false},
+		{"small radius", GeoPoint{51.5, -0.12}, 1, false, false},
+		{"antimeridian from the east", GeoPoint{-17.7, 178.4}, 300, true, false},
+		{"antimeridian from the west", GeoPoint{64.2, -179.5}, 100, true, false},
+		{"on the antimeridian", GeoPoint{0, 180}, 10, true, false},
+		{"near the north pole", GeoPoint{89.5, 20}, 100, false, true},
+		{"near the south pole", GeoPoint{-89.8, -120}, 50, false, true},
+		{"high latitude large radius", GeoPoint{85, 10}, MaxRadiusKm, false, true},
+		{"high latitude small radius", GeoPoint{78.2, 15.6}, 20, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			minLat, maxLat, minLng, maxLng, wholeLng := boundingBox(tt.p, tt.radiusKm)
+
+			if wholeLng != tt.wantWhole {
+				t.Fatalf("wholeLng = %v, want %v", wholeLng, tt.wantWhole)
+			}
+			if wholeLng && (minLng != -180 || maxLng != 180) {
+				t.Errorf("whole longitude range = [%v, %v], want [-180, 180]", minLng, maxLng)
+			}
+			if wrap := minLng > maxLng; wrap != tt.wantWrap {
+				t.Errorf("wraps = %v (lng [%v, %v]), want %v", wrap, minLng, maxLng, tt.wantWrap)
+			}
+			if minLat < -90 || maxLat > 90 || minLat > maxLat {
+				t.Errorf("latitude range = [%v, %v]", minLat, maxLat)
+			}
+			if minLng < -180 || maxLng > 180 {
+				t.Errorf("longitude range = [%v, %v] outside [-180, 180]", minLng, maxLng)
+			}
+
+			inLng := func(lng float64) bool {
+				if minLng <= maxLng {
+					return lng >= minLng && lng <= maxLng
+				}
+				return lng >= minLng || lng <= maxLng
+			}
+
+			// Every point on the circle must be inside the box
+			for bearing := 0.0; bearing < 360; bearing += 5 {
+				q := destination(tt.p, bearing, tt.radiusKm*0.999)
+				if q.Latitude < minLat || q.Latitude > maxLat || !inLng(q.Longitude) {
+					t.Errorf("point %+v at bearing %v outside box lat [%v, %v] lng [%v, %v]",
+						q, bearing, minLat, maxLat, minLng, maxLng)
+				}
+			}
+		})
+	}
+}
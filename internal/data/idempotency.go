@@ -0,0 +1,121 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// IdempotencyKey is a stored Idempotency-Key and, once the first request has
+// finished, the response to replay for retries.
+type IdempotencyKey struct {
+	Key         string
+	Scope       string
+	RequestHash string
+
+	StatusCode   *int
+	ResponseBody []byte
+
+	CreatedAt   time.Time
+	CompletedAt *time.Time
+}
+
+// Completed reports whether the first request has stored its response.
+func (k *IdempotencyKey) Completed() bool {
+	return k.StatusCode != nil
+}
+
+type IdempotencyModel struct {
+	DB *sql.DB
+}
+
+// Begin claims key within scope for a request with the given body hash. It
+// returns nil when the key was free and the request should be processed,
+// otherwise the record left by the earlier request.
+func (m IdempotencyModel) Begin(ctx context.Context, scope, key, requestHash string) (*IdempotencyKey, error) {
+	insertQuery := `
+		INSERT INTO idempotency_keys (scope, key, request_hash)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (scope, key) DO NOTHING
+	`
+
+	res, err := m.DB.ExecContext(ctx, insertQuery, scope, key, requestHash)
+	if err != nil {
+		return nil, err
+	}
+
+	inserted, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if inserted == 1 {
+		return nil, nil
+	}
+
+	query := `
+		SELECT key, scope, request_hash, status_code, response_body, created_at, completed_at
+		FROM idempotency_keys
+		WHERE scope = $1 AND key = $2
+	`
+
+	var k IdempotencyKey
+	err = m.DB.QueryRowContext(ctx, query, scope, key).Scan(
+		&k.Key,
+		&k.Scope,
+		&k.RequestHash,
+		&k.StatusCode,
+		&k.ResponseBody,
+		&k.CreatedAt,
+		&k.CompletedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			// released by the first request between our insert and select
+			return nil, ErrIdempotencyKeyInUse
+		default:
+			return nil, err
+		}
+	}
+
+	return &k, nil
+}
+
+// Complete stores the response of the request that claimed the key.
+func (m IdempotencyModel) Complete(ctx context.Context, scope, key string, statusCode int, body []byte) error {
+	query := `
+		UPDATE idempotency_keys
+		SET status_code = $1, response_body = $2, completed_at = now()
+		WHERE scope = $3 AND key = $4
+	`
+
+	_, err := m.DB.ExecContext(ctx, query, statusCode, body, scope, key)
+	return err
+}
+
+// Release forgets a claimed key so the client can retry the request.
+func (m IdempotencyModel) Release(ctx context.Context, scope, key string) error {
+	query := `
+		DELETE FROM idempotency_keys
+		WHERE scope = $1 AND key = $2
+	`
+
+	_, err := m.DB.ExecContext(ctx, query, scope, key)
+	return err
+}
+
+// DeleteExpired removes keys created more than ttl ago.
+func (m IdempotencyModel) DeleteExpired(ctx context.Context, ttl time.Duration) (int64, error) {
+	query := `
+		DELETE FROM idempotency_keys
+		WHERE created_at < now() - make_interval(secs => $1)
+	`
+
+	res, err := m.DB.ExecContext(ctx, query, ttl.Seconds())
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
@@ -6,24 +6,76 @@ import (
 )
 
 var (
-	ErrRecordNotFound    = errors.New("Record not found")
-	ErrUserAlreadyExists = errors.New("User with given email already exists")
-	ErrTicketNotAvailable = errors.New("no tickets available for this ticket type")
-	ErrTicketNotFound = errors.New("Ticket or event not found")
+	ErrRecordNotFound         = errors.New("Record not found")
+	ErrUserAlreadyExists      = errors.New("User with given email already exists")
+	ErrTicketNotAvailable     = errors.New("no tickets available for this ticket type")
+	ErrTicketNotFound         = errors.New("Ticket or event not found")
+	ErrReservationNotActive   = errors.New("reservation is no longer active")
+	ErrPaymentRefunded        = errors.New("payment has been returned to the buyer")
+	ErrMixedCurrency          = errors.New("tickets in one purchase must use the same currency")
+	ErrIdempotencyKeyInUse    = errors.New("a request with this Idempotency-Key is still being processed")
+	ErrTicketAlreadyUsed      = errors.New("ticket has already been used")
+	ErrTicketCancelled        = errors.New("ticket has been cancelled")
+	ErrTicketNotPaid          = errors.New("ticket has not been paid for")
+	ErrTicketWrongEvent       = errors.New("ticket is for a different event")
+	ErrInvalidEventTransition = errors.New("event status change is not allowed")
+	ErrEditConflict           = errors.New("edit conflict")
+	ErrEventHasSales          = errors.New("event cannot be deleted once tickets have been sold; cancel it instead")
+	ErrTicketTypeNotOnSale    = errors.New("ticket type is not on sale")
+	ErrTotalBelowSold         = errors.New("total quantity cannot be less than the tickets already sold")
+	ErrTicketTypeHasSales     = errors.New("ticket type has sales and cannot be deleted; pause its sales instead")
+	ErrDuplicateTicketType    = errors.New("event already has a ticket type with this name")
+	ErrPurchaseLimit          = errors.New("purchase limit exceeded")
+	ErrInvalidPromoCode       = errors.New("promo code cannot be used")
+	ErrDuplicatePromoCode     = errors.New("event already has a promo code with this code")
+	ErrEventNotOnSale         = errors.New("event is not on sale")
+	ErrTicketsStillAvailable  = errors.New("tickets are still available; buy them instead")
+	ErrAlreadyWaitlisted      = errors.New("buyer is already on the waitlist for this ticket type")
+	ErrSeatNotAvailable       = errors.New("seat is not available")
+	ErrSeatsRequired          = errors.New("seats must be picked for this ticket type")
+	ErrSeatMapHasSales        = errors.New("seat map cannot change once its seats or ticket types have sales")
+	ErrInvalidCursor          = errors.New("cursor is invalid or was made for a different sort")
+	ErrNotInSeries            = errors.New("event is not part of a series")
+	ErrOverCapacity           = errors.New("tickets exceed the venue's capacity")
+	ErrVenueInUse             = errors.New("venue has events and cannot be deleted")
 )
 
 type Models struct {
-	Users       UserModel
-	Events      EventModel
-	Tickets     TicketModel
-	TicketTypes TicketTypeModel
+	Users        UserModel
+	Events       EventModel
+	Tickets      TicketModel
+	TicketTypes  TicketTypeModel
+	Reservations ReservationModel
+	Payments     PaymentModel
+	Orders       OrderModel
+	Idempotency  IdempotencyModel
+	CheckIns     CheckInModel
+	Refunds      RefundModel
+	PromoCodes   PromoCodeModel
+	Waitlist     WaitlistModel
+	Seats        SeatModel
+	Series       EventSeriesModel
+	Venues       VenueModel
+	Stats        StatsModel
 }
 
 func NewModels(db *sql.DB) Models {
 	return Models{
-		Users:       UserModel{DB: db},
-		Events:      EventModel{DB: db},
-		Tickets:     TicketModel{DB: db},
-		TicketTypes: TicketTypeModel{DB: db},
+		Users:        UserModel{DB: db},
+		Events:       EventModel{DB: db},
+		Tickets:      TicketModel{DB: db},
+		TicketTypes:  TicketTypeModel{DB: db},
+		Reservations: ReservationModel{DB: db},
+		Payments:     PaymentModel{DB: db},
+		Orders:       OrderModel{DB: db},
+		Idempotency:  IdempotencyModel{DB: db},
+		CheckIns:     CheckInModel{DB: db},
+		Refunds:      RefundModel{DB: db},
+		PromoCodes:   PromoCodeModel{DB: db},
+		Waitlist:     WaitlistModel{DB: db},
+		Seats:        SeatModel{DB: db},
+		Series:       EventSeriesModel{DB: db},
+		Venues:       VenueModel{DB: db},
+		Stats:        StatsModel{DB: db},
 	}
 }
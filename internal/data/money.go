@@ -0,0 +1,133 @@
+package data
+
+import (
+	"encoding/json"
+
+	"github.com/AbrahamMayowa/ticketmania/internal/money"
+	"github.com/AbrahamMayowa/ticketmania/internal/validator"
+)
+
+// Amounts are stored and sent as integers in the currency's smallest unit.
+// The types below also send a "formatted" object with the same amounts ready
+// to show to people, keyed by the name of the field they format.
+
+// validateCurrency checks that currency is a supported upper case ISO 4217
+// code.
+func validateCurrency(v *validator.Validator, key, currency string) {
+	if currency == "" {
+		v.AddError(key, "must be provided")
+		return
+	}
+	v.Check(money.Valid(currency), key, "must be a supported ISO 4217 currency code, such as NGN or USD")
+}
+
+// formatAmounts formats each named amount in currency.
+func formatAmounts(currency string, amounts map[string]int64) map[string]string {
+	formatted := make(map[string]string, len(amounts))
+	for name, amount := range amounts {
+		formatted[name] = money.Format(amount, currency)
+	}
+	return formatted
+}
+
+func (tt TicketType) MarshalJSON() ([]byte, error) {
+	type ticketType TicketType
+	return json.Marshal(struct {
+		ticketType
+		Formatted map[string]string `json:"formatted"`
+	}{ticketType(tt), formatAmounts(tt.Currency, map[string]int64{"price": tt.Price})})
+}
+
+func (s Seat) MarshalJSON() ([]byte, error) {
+	type seat Seat
+	return json.Marshal(struct {
+		seat
+		Formatted map[string]string `json:"formatted"`
+	}{seat(s), formatAmounts(s.Currency, map[string]int64{"price": s.Price})})
+}
+
+func (o Order) MarshalJSON() ([]byte, error) {
+	type order Order
+	return json.Marshal(struct {
+		order
+		Formatted map[string]string `json:"formatted"`
+	}{order(o), formatAmounts(o.Currency, map[string]int64{
+		"subtotal":     o.Subtotal,
+		"discount":     o.Discount,
+		"service_fee":  o.ServiceFee,
+		"absorbed_fee": o.AbsorbedFee,
+		"tax":          o.Tax,
+		"total":        o.Total,
+	})})
+}
+
+func (item OrderItem) MarshalJSON() ([]byte, error) {
+	type orderItem OrderItem
+	return json.Marshal(struct {
+		orderItem
+		Formatted map[string]string `json:"formatted"`
+	}{orderItem(item), formatAmounts(item.Currency, map[string]int64{
+		"unit_price":   item.UnitPrice,
+		"line_total":   item.LineTotal,
+		"discount":     item.Discount,
+		"service_fee":  item.ServiceFee,
+		"absorbed_fee": item.AbsorbedFee,
+		"tax":          item.Tax,
+	})})
+}
+
+func (q Quote) MarshalJSON() ([]byte, error) {
+	type quote Quote
+	return json.Marshal(struct {
+		quote
+		Formatted map[string]string `json:"formatted"`
+	}{quote(q), formatAmounts(q.Currency, map[string]int64{
+		"subtotal":     q.Subtotal,
+		"discount":     q.Discount,
+		"service_fee":  q.ServiceFee,
+		"absorbed_fee": q.AbsorbedFee,
+		"tax":          q.Tax,
+		"total":        q.Total,
+	})})
+}
+
+func (r Refund) MarshalJSON() ([]byte, error) {
+	type refund Refund
+	return json.Marshal(struct {
+		refund
+		Formatted map[string]string `json:"formatted"`
+	}{refund(r), formatAmounts(r.Currency, map[string]int64{"amount": r.Amount})})
+}
+
+func (s TicketTypeStats) MarshalJSON() ([]byte, error) {
+	type ticketTypeStats TicketTypeStats
+	return json.Marshal(struct {
+		ticketTypeStats
+		Formatted map[string]string `json:"formatted"`
+	}{ticketTypeStats(s), formatAmounts(s.Currency, map[string]int64{"price": s.Price})})
+}
+
+func (s RevenueStats) MarshalJSON() ([]byte, error) {
+	type revenueStats RevenueStats
+	return json.Marshal(struct {
+		revenueStats
+		Formatted map[string]string `json:"formatted"`
+	}{revenueStats(s), formatAmounts(s.Currency, map[string]int64{
+		"gross":    s.Gross,
+		"refunded": s.Refunded,
+		"net":      s.Net,
+	})})
+}
+
+// Only fixed discounts are amounts of money.
+func (p PromoCode) MarshalJSON() ([]byte, error) {
+	type promoCode PromoCode
+	formatted := map[string]string{}
+	if p.DiscountType == DiscountFixed && p.Currency != nil {
+		formatted = formatAmounts(*p.Currency, map[string]int64{"discount_value": p.DiscountValue})
+	}
+	return json.Marshal(struct {
+		promoCode
+		Formatted map[string]string `json:"formatted"`
+	}{promoCode(p), formatted})
+}
@@ -0,0 +1,283 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type OrderStatus string
+
+const (
+	OrderPending   OrderStatus = "pending"
+	OrderPaid      OrderStatus = "paid"
+	OrderCancelled OrderStatus = "cancelled"
+	OrderExpired   OrderStatus = "expired"
+	OrderRefunded  OrderStatus = "refunded"
+)
+
+// Order groups the tickets bought in one purchase. Prices are copied from
+// the ticket types when the order is placed.
+type Order struct {
+	ID            int64  `json:"id"`
+	OrderNumber   string `json:"order_number"`
+	EventID       int64  `json:"event_id"`
+	ReservationID *int64 `json:"reservation_id,omitempty"`
+	UserID        *int64 `json:"user_id,omitempty"`
+
+	BuyerEmail string  `json:"buyer_email"`
+	BuyerPhone *string `json:"buyer_phone,omitempty"`
+
+	Status OrderStatus `json:"status"`
+
+	Subtotal    int64  `json:"subtotal"` // amounts in smallest currency unit
+	Discount    int64  `json:"discount"`
+	ServiceFee  int64  `json:"service_fee"`  // fees paid by the buyer
+	AbsorbedFee int64  `json:"absorbed_fee"` // fees paid by the organizer
+	Tax         int64  `json:"tax"`
+	Total       int64  `json:"total"`
+	Currency    string `json:"currency"`
+
+	PromoCodeID *int64 `json:"promo_code_id,omitempty"`
+
+	Items   []*OrderItem `json:"items"`
+	Tickets []*Ticket    `json:"tickets,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type OrderItem struct {
+	ID           int64  `json:"id,omitempty"`
+	OrderID      int64  `json:"order_id,omitempty"`
+	TicketTypeID int64  `json:"ticket_type_id"`
+	Name         string `json:"name"`
+
+	UnitPrice int64  `json:"unit_price"`
+	Currency  string `json:"currency"`
+	Quantity  int    `json:"quantity"`
+	LineTotal int64  `json:"line_total"`
+	Discount  int64  `json:"discount"` // share of the order discount
+
+	ServiceFee  int64 `json:"service_fee"`
+	AbsorbedFee int64 `json:"absorbed_fee"`
+	Tax         int64 `json:"tax"`
+}
+
+type OrderModel struct {
+	DB *sql.DB
+}
+
+// orderNumberAlphabet leaves out characters that are easy to misread.
+const orderNumberAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// newOrderNumber returns a short human-readable reference like TM-7KQ2XF9A.
+func newOrderNumber() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	for i := range b {
+		b[i] = orderNumberAlphabet[int(b[i])%len(orderNumberAlphabet)]
+	}
+
+	return "TM-" + string(b), nil
+}
+
+// insertOrder stores an order and its items inside the purchase transaction.
+func insertOrder(ctx context.Context, tx *sql.Tx, o *Order) error {
+	orderNumber, err := newOrderNumber()
+	if err != nil {
+		return err
+	}
+	o.OrderNumber = orderNumber
+
+	query := `
+		INSERT INTO orders (order_number, event_id, reservation_id, user_id, buyer_email, buyer_phone, status,
+			subtotal, discount, total, currency, promo_code_id, service_fee, absorbed_fee, tax)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+		RETURNING id, created_at, updated_at
+	`
+	err = tx.QueryRowContext(ctx, query,
+		o.OrderNumber,
+		o.EventID,
+		o.ReservationID,
+		o.UserID,
+		o.BuyerEmail,
+		o.BuyerPhone,
+		o.Status,
+		o.Subtotal,
+		o.Discount,
+		o.Total,
+		o.Currency,
+		o.PromoCodeID,
+		o.ServiceFee,
+		o.AbsorbedFee,
+		o.Tax,
+	).Scan(&o.ID, &o.CreatedAt, &o.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	itemQuery := `
+		INSERT INTO order_items (order_id, ticket_type_id, name, unit_price, currency, quantity, line_total, discount,
+			service_fee, absorbed_fee, tax)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING id
+	`
+	for _, item := range o.Items {
+		item.OrderID = o.ID
+		err = tx.QueryRowContext(ctx, itemQuery,
+			item.OrderID,
+			item.TicketTypeID,
+			item.Name,
+			item.UnitPrice,
+			item.Currency,
+			item.Quantity,
+			item.LineTotal,
+			item.Discount,
+			item.ServiceFee,
+			item.AbsorbedFee,
+			item.Tax,
+		).Scan(&item.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Get returns an order with its line items and tickets.
+func (m OrderModel) Get(ctx context.Context, id int64) (*Order, error) {
+	o, err := m.getBy(ctx, "id", id)
+	if err != nil {
+		return nil, err
+	}
+
+	o.Items, err = m.items(ctx, o.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	o.Tickets, err = m.tickets(ctx, o.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return o, nil
+}
+
+// GetForReservation returns the order placed with a reservation, without its
+// line items and tickets.
+func (m OrderModel) GetForReservation(ctx context.Context, reservationID int64) (*Order, error) {
+	return m.getBy(ctx, "reservation_id", reservationID)
+}
+
+// getBy loads a single order row; column is always a constant from this file.
+func (m OrderModel) getBy(ctx context.Context, column string, value int64) (*Order, error) {
+	query := `
+		SELECT id, order_number, event_id, reservation_id, user_id, buyer_email, buyer_phone,
+		       status, subtotal, discount, total, currency, promo_code_id, service_fee, absorbed_fee, tax,
+		       created_at, updated_at
+		FROM orders
+		WHERE ` + column + ` = $1
+	`
+
+	var o Order
+	err := m.DB.QueryRowContext(ctx, query, value).Scan(
+		&o.ID,
+		&o.OrderNumber,
+		&o.EventID,
+		&o.ReservationID,
+		&o.UserID,
+		&o.BuyerEmail,
+		&o.BuyerPhone,
+		&o.Status,
+		&o.Subtotal,
+		&o.Discount,
+		&o.Total,
+		&o.Currency,
+		&o.PromoCodeID,
+		&o.ServiceFee,
+		&o.AbsorbedFee,
+		&o.Tax,
+		&o.CreatedAt,
+		&o.UpdatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &o, nil
+}
+
+func (m OrderModel) items(ctx context.Context, orderID int64) ([]*OrderItem, error) {
+	query := `
+		SELECT id, order_id, ticket_type_id, name, unit_price, currency, quantity, line_total, discount,
+		       service_fee, absorbed_fee, tax
+		FROM order_items
+		WHERE order_id = $1
+		ORDER BY id
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []*OrderItem{}
+	for rows.Next() {
+		var item OrderItem
+		err := rows.Scan(
+			&item.ID,
+			&item.OrderID,
+			&item.TicketTypeID,
+			&item.Name,
+			&item.UnitPrice,
+			&item.Currency,
+			&item.Quantity,
+			&item.LineTotal,
+			&item.Discount,
+			&item.ServiceFee,
+			&item.AbsorbedFee,
+			&item.Tax,
+		)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, &item)
+	}
+
+	return items, rows.Err()
+}
+
+func (m OrderModel) tickets(ctx context.Context, orderID int64) ([]*Ticket, error) {
+	query := `SELECT ` + ticketColumns + ` FROM tickets WHERE order_id = $1 ORDER BY id`
+
+	rows, err := m.DB.QueryContext(ctx, query, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tickets := []*Ticket{}
+	for rows.Next() {
+		t, err := scanTicket(rows)
+		if err != nil {
+			return nil, err
+		}
+		tickets = append(tickets, t)
+	}
+
+	return tickets, rows.Err()
+}
@@ -0,0 +1,272 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type PaymentStatus string
+
+const (
+	PaymentPending   PaymentStatus = "pending"
+	PaymentSucceeded PaymentStatus = "succeeded"
+	PaymentFailed    PaymentStatus = "failed"
+	PaymentRefunding PaymentStatus = "refunding"
+	PaymentRefunded  PaymentStatus = "refunded"
+)
+
+// Payment records a provider payment intent created for a reservation.
+type Payment struct {
+	ID            int64  `json:"id"`
+	ReservationID int64  `json:"reservation_id"`
+	Provider      string `json:"provider"`
+	ProviderRef   string `json:"provider_ref"`
+
+	Amount   int64  `json:"amount"` // amount in smallest currency unit
+	Currency string `json:"currency"`
+
+	Status PaymentStatus `json:"status"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type PaymentModel struct {
+	DB *sql.DB
+}
+
+func (m PaymentModel) Insert(ctx context.Context, p *Payment) error {
+	query := `
+		INSERT INTO payments (reservation_id, provider, provider_ref, amount, currency, status)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at, updated_at
+	`
+
+	return m.DB.QueryRowContext(ctx, query,
+		p.ReservationID,
+		p.Provider,
+		p.ProviderRef,
+		p.Amount,
+		p.Currency,
+		p.Status,
+	).Scan(&p.ID, &p.CreatedAt, &p.UpdatedAt)
+}
+
+func (m PaymentModel) Get(ctx context.Context, id int64) (*Payment, error) {
+	query := `
+		SELECT id, reservation_id, provider, provider_ref, amount, currency, status, created_at, updated_at
+		FROM payments
+		WHERE id = $1
+	`
+
+	var p Payment
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&p.ID,
+		&p.ReservationID,
+		&p.Provider,
+		&p.ProviderRef,
+		&p.Amount,
+		&p.Currency,
+		&p.Status,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &p, nil
+}
+
+func (m PaymentModel) GetByProviderRef(ctx context.Context, provider, providerRef string) (*Payment, error) {
+	query := `
+		SELECT id, reservation_id, provider, provider_ref, amount, currency, status, created_at, updated_at
+		FROM payments
+		WHERE provider = $1 AND provider_ref = $2
+	`
+
+	var p Payment
+	err := m.DB.QueryRowContext(ctx, query, provider, providerRef).Scan(
+		&p.ID,
+		&p.ReservationID,
+		&p.Provider,
+		&p.ProviderRef,
+		&p.Amount,
+		&p.Currency,
+		&p.Status,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &p, nil
+}
+
+func (m PaymentModel) UpdateStatus(ctx context.Context, id int64, status PaymentStatus) error {
+	query := `
+		UPDATE payments
+		SET status = $1, updated_at = now()
+		WHERE id = $2
+	`
+
+	_, err := m.DB.ExecContext(ctx, query, status, id)
+	return err
+}
+
+// MarkSucceeded records a successful payment: the reservation's held tickets
+// become paid and move from reserved_qty to sold_qty, and its order is paid.
+// Replaying it for an already successful payment is a no-op, so webhook
+// retries are safe.
+//
+// If the reservation was already released the payment is claimed as
+// refunding and ErrReservationNotActive returned: the caller must then return
+// the money and call UpdateStatus. Payments being or already returned fail
+// with ErrPaymentRefunded, so only one caller ever refunds a payment.
+func (m PaymentModel) MarkSucceeded(ctx context.Context, id int64) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	committed := false
+	defer func() {
+		if !committed {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var (
+		reservationID     int64
+		reservationStatus ReservationStatus
+		paymentStatus     PaymentStatus
+	)
+	err = tx.QueryRowContext(ctx, `
+		SELECT r.id, r.status, p.status
+		FROM payments p
+		JOIN reservations r ON r.id = p.reservation_id
+		WHERE p.id = $1
+		FOR UPDATE OF p, r
+	`, id).Scan(&reservationID, &reservationStatus, &paymentStatus)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+
+	switch paymentStatus {
+	case PaymentSucceeded:
+		return nil
+	case PaymentRefunding, PaymentRefunded:
+		return ErrPaymentRefunded
+	}
+
+	// A hold that ran out but was not swept yet still owns its tickets, so
+	// only reservations that were actually released are refused.
+	if reservationStatus != ReservationActive {
+		_, err = tx.ExecContext(ctx, `
+			UPDATE payments
+			SET status = 'refunding', updated_at = now()
+			WHERE id = $1
+		`, id)
+		if err != nil {
+			return err
+		}
+
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+		committed = true
+		return ErrReservationNotActive
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		SELECT id FROM ticket_types
+		WHERE id IN (
+			SELECT ticket_type_id FROM tickets
+			WHERE reservation_id = $1 AND status = 'reserved'
+		)
+		ORDER BY id
+		FOR UPDATE
+	`, reservationID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE ticket_types tt
+		SET reserved_qty = tt.reserved_qty - held.qty,
+		    sold_qty = tt.sold_qty + held.qty,
+		    updated_at = now()
+		FROM (
+			SELECT ticket_type_id, COUNT(*) AS qty
+			FROM tickets
+			WHERE reservation_id = $1 AND status = 'reserved'
+			GROUP BY ticket_type_id
+		) held
+		WHERE tt.id = held.ticket_type_id
+	`, reservationID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE tickets
+		SET status = 'paid', paid_at = now()
+		WHERE reservation_id = $1 AND status = 'reserved'
+	`, reservationID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE reservations
+		SET status = 'completed', updated_at = now()
+		WHERE id = $1
+	`, reservationID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE orders
+		SET status = 'paid', updated_at = now()
+		WHERE reservation_id = $1
+	`, reservationID)
+	if err != nil {
+		return err
+	}
+
+	if err = settleWaitlistOffers(ctx, tx, []int64{reservationID}, WaitlistPurchased); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE payments
+		SET status = 'succeeded', updated_at = now()
+		WHERE id = $1
+	`, id)
+	if err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	committed = true
+	return nil
+}
@@ -0,0 +1,83 @@
+package data
+
+import (
+	"github.com/AbrahamMayowa/ticketmania/internal/validator"
+)
+
+// Pricing holds an event's service fee and tax settings. Fees are charged per
+// ticket as ServiceFeeFlat plus ServiceFeeBps of the discounted ticket price,
+// and are either added to what the buyer pays or absorbed by the organizer.
+// Tax is charged on top of the ticket price and any fee the buyer pays.
+type Pricing struct {
+	ServiceFeeFlat int64 `json:"service_fee_flat"` // per ticket, in smallest currency unit
+	ServiceFeeBps  int   `json:"service_fee_bps"`  // basis points, 250 is 2.5%
+	FeesAbsorbed   bool  `json:"fees_absorbed"`
+	TaxRateBps     int   `json:"tax_rate_bps"`
+}
+
+// Quote is the price breakdown of a purchase before it is placed.
+type Quote struct {
+	EventID int64        `json:"event_id"`
+	Items   []*OrderItem `json:"items"`
+
+	Subtotal    int64  `json:"subtotal"` // amounts in smallest currency unit
+	Discount    int64  `json:"discount"`
+	ServiceFee  int64  `json:"service_fee"`
+	AbsorbedFee int64  `json:"absorbed_fee"`
+	Tax         int64  `json:"tax"`
+	Total       int64  `json:"total"`
+	Currency    string `json:"currency"`
+}
+
+func newQuote(o *Order) *Quote {
+	return &Quote{
+		EventID:     o.EventID,
+		Items:       o.Items,
+		Subtotal:    o.Subtotal,
+		Discount:    o.Discount,
+		ServiceFee:  o.ServiceFee,
+		AbsorbedFee: o.AbsorbedFee,
+		Tax:         o.Tax,
+		Total:       o.Total,
+		Currency:    o.Currency,
+	}
+}
+
+func ValidatePricing(v *validator.Validator, p *Pricing) {
+	v.Check(p.ServiceFeeFlat >= 0, "service_fee_flat", "must be >= 0")
+	v.Check(p.ServiceFeeBps >= 0 && p.ServiceFeeBps <= 10000, "service_fee_bps", "must be between 0 and 10000")
+	v.Check(p.TaxRateBps >= 0 && p.TaxRateBps <= 10000, "tax_rate_bps", "must be between 0 and 10000")
+}
+
+// Apply works out the service fee and tax of every line of a discounted
+// order and sets the order totals. Lines that cost nothing after the
+// discount carry no fee.
+func (p Pricing) Apply(o *Order) {
+	o.ServiceFee, o.AbsorbedFee, o.Tax = 0, 0, 0
+
+	for _, item := range o.Items {
+		item.ServiceFee, item.AbsorbedFee, item.Tax = 0, 0, 0
+
+		net := item.LineTotal - item.Discount
+		if net > 0 {
+			fee := p.ServiceFeeFlat*int64(item.Quantity) + basisPoints(net, p.ServiceFeeBps)
+			if p.FeesAbsorbed {
+				item.AbsorbedFee = fee
+			} else {
+				item.ServiceFee = fee
+			}
+		}
+		item.Tax = basisPoints(net+item.ServiceFee, p.TaxRateBps)
+
+		o.ServiceFee += item.ServiceFee
+		o.AbsorbedFee += item.AbsorbedFee
+		o.Tax += item.Tax
+	}
+
+	o.Total = o.Subtotal - o.Discount + o.ServiceFee + o.Tax
+}
+
+// basisPoints returns bps/10000 of amount, rounded half up.
+func basisPoints(amount int64, bps int) int64 {
+	return (amount*int64(bps) + 5000) / 10000
+}
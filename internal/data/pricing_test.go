@@ -0,0 +1,128 @@
+package data
+
+import "testing"
+
+func TestBasisPoints(t *testing.T) {
+	tests := []struct {
+		amount int64
+		bps    int
+		want   int64
+	}{
+		{0, 250, 0},
+		{10_000, 0, 0},
+		{10_000, 250, 250},
+		{12_345, 10_000, 12_345},
+		{199, 250, 5},      // 4.975
+		{1, 5_000, 1},      // 0.5 rounds up
+		{1, 4_999, 0},      // 0.4999 rounds down
+		{2, 2_500, 1},      // 0.5 rounds up
+		{10_450, 750, 784}, // 783.75
+		{10_020, 750, 752}, // 751.5
+	}
+
+	for _, tt := range tests {
+		if got := basisPoints(tt.amount, tt.bps); got != tt.want {
+			t.Errorf("basisPoints(%d, %d) = %d, want %d", tt.amount, tt.bps, got, tt.want)
+		}
+	}
+}
+
+func TestPricingApply(t *testing.T) {
+	type line struct {
+		lineTotal, discount int64
+		quantity            int
+	}
+	type fees struct {
+		serviceFee, absorbedFee, tax int64
+	}
+
+	tests := []struct {
+		name     string
+		pricing  Pricing
+		lines    []line
+		wantLine []fees
+		want     fees
+		total    int64
+	}{
+		{
+			name:     "no fees or tax",
+			lines:    []line{{10_000, 0, 2}},
+			wantLine: []fees{{0, 0, 0}},
+			total:    10_000,
+		},
+		{
+			name:     "buyer pays fee and tax on it",
+			pricing:  Pricing{ServiceFeeFlat: 100, ServiceFeeBps: 250, TaxRateBps: 750},
+			lines:    []line{{10_000, 0, 2}},
+			wantLine: []fees{{450, 0, 784}},
+			want:     fees{450, 0, 784},
+			total:    11_234,
+		},
+		{
+			name:     "organizer absorbs fee and buyer pays no tax on it",
+			pricing:  Pricing{ServiceFeeFlat: 100, ServiceFeeBps: 250, FeesAbsorbed: true, TaxRateBps: 750},
+			lines:    []line{{10_000, 0, 2}},
+			wantLine: []fees{{0, 450, 750}},
+			want:     fees{0, 450, 750},
+			total:    10_750,
+		},
+		{
+			name:     "fee charged on the discounted price",
+			pricing:  Pricing{ServiceFeeBps: 1_000, TaxRateBps: 1_000},
+			lines:    []line{{10_000, 2_500, 1}},
+			wantLine: []fees{{750, 0, 825}},
+			want:     fees{750, 0, 825},
+			total:    10_000 - 2_500 + 750 + 825,
+		},
+		{
+			name:     "free line carries no fee",
+			pricing:  Pricing{ServiceFeeFlat: 100, ServiceFeeBps: 250, TaxRateBps: 750},
+			lines:    []line{{5_000, 5_000, 1}, {3_000, 0, 1}},
+			wantLine: []fees{{0, 0, 0}, {175, 0, 238}},
+			want:     fees{175, 0, 238},
+			total:    8_000 - 5_000 + 175 + 238,
+		},
+		{
+			name:     "lines rounded separately",
+			pricing:  Pricing{ServiceFeeBps: 250},
+			lines:    []line{{199, 0, 1}, {199, 0, 1}},
+			wantLine: []fees{{5, 0, 0}, {5, 0, 0}},
+			want:     fees{10, 0, 0},
+			total:    398 + 10,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Start from stale values to check Apply replaces them
+			o := &Order{ServiceFee: 1, AbsorbedFee: 1, Tax: 1}
+			for _, l := range tt.lines {
+				o.Items = append(o.Items, &OrderItem{
+					Quantity:    l.quantity,
+					LineTotal:   l.lineTotal,
+					Discount:    l.discount,
+					ServiceFee:  1,
+					AbsorbedFee: 1,
+					Tax:         1,
+				})
+				o.Subtotal += l.lineTotal
+				o.Discount += l.discount
+			}
+
+			tt.pricing.Apply(o)
+
+			for i, item := range o.Items {
+				got := fees{item.ServiceFee, item.AbsorbedFee, item.Tax}
+				if got != tt.wantLine[i] {
+					t.Errorf("line %d fees = %+v, want %+v", i, got, tt.wantLine[i])
+				}
+			}
+			if got := (fees{o.ServiceFee, o.AbsorbedFee, o.Tax}); got != tt.want {
+				t.Errorf("order fees = %+v, want %+v", got, tt.want)
+			}
+			if o.Total != tt.total {
+				t.Errorf("order total = %d, want %d", o.Total, tt.total)
+			}
+		})
+	}
+}
@@ -0,0 +1,355 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/AbrahamMayowa/ticketmania/internal/validator"
+	"github.com/lib/pq"
+)
+
+type DiscountType string
+
+const (
+	DiscountPercent DiscountType = "percent"
+	DiscountFixed   DiscountType = "fixed"
+)
+
+// PromoCode is a discount buyers can apply to one order for an event. An
+// empty TicketTypeIDs applies it to every ticket type of the event.
+type PromoCode struct {
+	ID      int64  `json:"id"`
+	EventID int64  `json:"event_id"`
+	Code    string `json:"code"`
+
+	DiscountType  DiscountType `json:"discount_type"`
+	DiscountValue int64        `json:"discount_value"` // percent, or amount in smallest currency unit
+	Currency      *string      `json:"currency,omitempty"`
+
+	TicketTypeIDs []int64 `json:"ticket_type_ids"`
+
+	MaxUses   *int `json:"max_uses"`
+	UsedCount int  `json:"used_count"`
+
+	ValidFrom  *time.Time `json:"valid_from"`
+	ValidUntil *time.Time `json:"valid_until"`
+	Active     bool       `json:"active"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type PromoCodeModel struct {
+	DB *sql.DB
+}
+
+// promoCodeColumns lists the columns read by promoCodeFields, in order.
+const promoCodeColumns = `id, event_id, code, discount_type, discount_value, currency, ticket_type_ids,
+	max_uses, used_count, valid_from, valid_until, active, created_at, updated_at`
+
+func promoCodeFields(p *PromoCode) []interface{} {
+	return []interface{}{
+		&p.ID,
+		&p.EventID,
+		&p.Code,
+		&p.DiscountType,
+		&p.DiscountValue,
+		&p.Currency,
+		(*pq.Int64Array)(&p.TicketTypeIDs),
+		&p.MaxUses,
+		&p.UsedCount,
+		&p.ValidFrom,
+		&p.ValidUntil,
+		&p.Active,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+	}
+}
+
+func ValidatePromoCode(v *validator.Validator, p *PromoCode) {
+	v.Check(p.Code != "", "code", "must be provided")
+	v.Check(len(p.Code) <= 64, "code", "must not be more than 64 bytes")
+	v.Check(!strings.ContainsAny(p.Code, " \t\n"), "code", "must not contain spaces")
+
+	switch p.DiscountType {
+	case DiscountPercent:
+		v.Check(p.DiscountValue >= 1 && p.DiscountValue <= 100, "discount_value", "must be between 1 and 100")
+	case DiscountFixed:
+		v.Check(p.DiscountValue > 0, "discount_value", "must be greater than zero")
+		if p.Currency == nil {
+			v.AddError("currency", "must be provided for fixed discounts")
+		} else {
+			validateCurrency(v, "currency", *p.Currency)
+		}
+	default:
+		v.AddError("discount_type", "must be percent or fixed")
+	}
+
+	if p.MaxUses != nil {
+		v.Check(*p.MaxUses > 0, "max_uses", "must be greater than zero")
+		v.Check(*p.MaxUses >= p.UsedCount, "max_uses", "must not be below the times the code was already used")
+	}
+	if p.ValidFrom != nil && p.ValidUntil != nil {
+		v.Check(p.ValidFrom.Before(*p.ValidUntil), "valid_until", "must be after valid_from")
+	}
+}
+
+// AppliesTo reports whether the code discounts the given ticket type.
+func (p *PromoCode) AppliesTo(ticketTypeID int64) bool {
+	if len(p.TicketTypeIDs) == 0 {
+		return true
+	}
+	for _, id := range p.TicketTypeIDs {
+		if id == ticketTypeID {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRedeemable returns an error wrapping ErrInvalidPromoCode if the code
+// cannot be used at now.
+func (p *PromoCode) checkRedeemable(now time.Time) error {
+	switch {
+	case !p.Active:
+		return fmt.Errorf("promo code %s is no longer active: %w", p.Code, ErrInvalidPromoCode)
+	case p.ValidFrom != nil && now.Before(*p.ValidFrom):
+		return fmt.Errorf("promo code %s is not valid yet: %w", p.Code, ErrInvalidPromoCode)
+	case p.ValidUntil != nil && !now.Before(*p.ValidUntil):
+		return fmt.Errorf("promo code %s has expired: %w", p.Code, ErrInvalidPromoCode)
+	case p.MaxUses != nil && p.UsedCount >= *p.MaxUses:
+		return fmt.Errorf("promo code %s has been used up: %w", p.Code, ErrInvalidPromoCode)
+	}
+	return nil
+}
+
+// applyPromoCode discounts the order's eligible items with the event's promo
+// code. Purchases lock the code until redeemPromoCode counts the redemption
+// in the same transaction, so max_uses holds under concurrent purchases.
+func (c *checkout) applyPromoCode(ctx context.Context, q queryRower, code string, order *Order) error {
+	var p PromoCode
+	err := q.QueryRowContext(ctx, `
+		SELECT `+promoCodeColumns+`
+		FROM promo_codes
+		WHERE event_id = $1 AND upper(code) = upper($2)
+		`+c.forLock("FOR UPDATE"), order.EventID, code).Scan(promoCodeFields(&p)...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("promo code %s does not exist: %w", code, ErrInvalidPromoCode)
+		}
+		return err
+	}
+
+	if err = p.checkRedeemable(time.Now()); err != nil {
+		return err
+	}
+
+	return p.discount(order)
+}
+
+// redeemPromoCode counts a use of a promo code applied to an order.
+func redeemPromoCode(ctx context.Context, tx *sql.Tx, id int64) error {
+	_, err := tx.ExecContext(ctx, `
+		UPDATE promo_codes SET used_count = used_count + 1, updated_at = now() WHERE id = $1
+	`, id)
+	return err
+}
+
+// discount spreads the code's discount over the order's eligible items and
+// updates the order totals. A fixed discount never exceeds what the eligible
+// items cost.
+func (p *PromoCode) discount(order *Order) error {
+	var eligible int64
+	for _, item := range order.Items {
+		if p.AppliesTo(item.TicketTypeID) {
+			eligible += item.LineTotal
+		}
+	}
+
+	if eligible == 0 {
+		return fmt.Errorf("promo code %s does not apply to the selected tickets: %w", p.Code, ErrInvalidPromoCode)
+	}
+
+	var total int64
+	switch p.DiscountType {
+	case DiscountPercent:
+		total = eligible * p.DiscountValue / 100
+	case DiscountFixed:
+		if p.Currency == nil || *p.Currency != order.Currency {
+			return fmt.Errorf("promo code %s cannot be used with %s prices: %w", p.Code, order.Currency, ErrInvalidPromoCode)
+		}
+		total = p.DiscountValue
+		if total > eligible {
+			total = eligible
+		}
+	}
+
+	// Split in proportion to each line; the last eligible line takes the
+	// rounding remainder
+	remaining := total
+	var last *OrderItem
+	for _, item := range order.Items {
+		if !p.AppliesTo(item.TicketTypeID) {
+			continue
+		}
+		item.Discount = total * item.LineTotal / eligible
+		remaining -= item.Discount
+		last = item
+	}
+	last.Discount += remaining
+
+	order.PromoCodeID = &p.ID
+	order.Discount = total
+	order.Total = order.Subtotal - total
+	return nil
+}
+
+// releasePromoCodes gives back the redemptions of orders that were never
+// paid, so abandoned checkouts do not use up a capped code.
+func releasePromoCodes(ctx context.Context, tx *sql.Tx, reservationIDs []int64) error {
+	_, err := tx.ExecContext(ctx, `
+		UPDATE promo_codes p
+		SET used_count = p.used_count - o.uses, updated_at = now()
+		FROM (
+			SELECT promo_code_id, COUNT(*) AS uses
+			FROM orders
+			WHERE reservation_id = ANY($1) AND status = 'pending' AND promo_code_id IS NOT NULL
+			GROUP BY promo_code_id
+		) o
+		WHERE p.id = o.promo_code_id
+	`, pq.Array(reservationIDs))
+	return err
+}
+
+func (m PromoCodeModel) Insert(ctx context.Context, p *PromoCode) error {
+	query := `
+		INSERT INTO promo_codes
+			(event_id, code, discount_type, discount_value, currency, ticket_type_ids, max_uses, valid_from, valid_until, active)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id, created_at, updated_at
+	`
+
+	err := m.DB.QueryRowContext(ctx, query,
+		p.EventID,
+		p.Code,
+		p.DiscountType,
+		p.DiscountValue,
+		p.Currency,
+		pq.Array(p.TicketTypeIDs),
+		p.MaxUses,
+		p.ValidFrom,
+		p.ValidUntil,
+		p.Active,
+	).Scan(&p.ID, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		if pgErr, ok := err.(*pq.Error); ok && pgErr.Code == "23505" {
+			return ErrDuplicatePromoCode
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (m PromoCodeModel) Get(ctx context.Context, id int64) (*PromoCode, error) {
+	query := `SELECT ` + promoCodeColumns + ` FROM promo_codes WHERE id = $1`
+
+	var p PromoCode
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(promoCodeFields(&p)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &p, nil
+}
+
+func (m PromoCodeModel) ListForEvent(ctx context.Context, eventID int64) ([]*PromoCode, error) {
+	query := `SELECT ` + promoCodeColumns + ` FROM promo_codes WHERE event_id = $1 ORDER BY id`
+
+	rows, err := m.DB.QueryContext(ctx, query, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	codes := []*PromoCode{}
+	for rows.Next() {
+		var p PromoCode
+		if err := rows.Scan(promoCodeFields(&p)...); err != nil {
+			return nil, err
+		}
+		codes = append(codes, &p)
+	}
+
+	return codes, rows.Err()
+}
+
+// Update saves a promo code's settings. used_count is only ever changed by
+// purchases.
+func (m PromoCodeModel) Update(ctx context.Context, p *PromoCode) error {
+	query := `
+		UPDATE promo_codes
+		SET code = $2, discount_type = $3, discount_value = $4, currency = $5, ticket_type_ids = $6,
+		    max_uses = $7, valid_from = $8, valid_until = $9, active = $10, updated_at = now()
+		WHERE id = $1
+		RETURNING used_count, updated_at
+	`
+
+	err := m.DB.QueryRowContext(ctx, query,
+		p.ID,
+		p.Code,
+		p.DiscountType,
+		p.DiscountValue,
+		p.Currency,
+		pq.Array(p.TicketTypeIDs),
+		p.MaxUses,
+		p.ValidFrom,
+		p.ValidUntil,
+		p.Active,
+	).Scan(&p.UsedCount, &p.UpdatedAt)
+	if err != nil {
+		if pgErr, ok := err.(*pq.Error); ok {
+			switch pgErr.Code {
+			case "23505":
+				return ErrDuplicatePromoCode
+			case "23514":
+				// A purchase used the code in the meantime
+				return ErrEditConflict
+			}
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Delete removes a promo code. Orders that used it keep their discount.
+func (m PromoCodeModel) Delete(ctx context.Context, id int64) error {
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM promo_codes WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,362 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type RefundStatus string
+
+const (
+	RefundPending   RefundStatus = "pending"
+	RefundSucceeded RefundStatus = "succeeded"
+	RefundFailed    RefundStatus = "failed"
+)
+
+// Refund records the money returned for tickets cancelled together from one
+// order. A zero amount means the refund policy returned nothing.
+type Refund struct {
+	ID        int64  `json:"id"`
+	OrderID   *int64 `json:"order_id,omitempty"`
+	PaymentID *int64 `json:"payment_id,omitempty"`
+
+	Amount   int64  `json:"amount"` // amount in smallest currency unit
+	Currency string `json:"currency"`
+	Reason   string `json:"reason,omitempty"`
+
+	Status      RefundStatus `json:"status"`
+	ProviderRef *string      `json:"provider_ref,omitempty"`
+	RequestedBy *int64       `json:"requested_by,omitempty"`
+
+	TicketIDs  []int64 `json:"ticket_ids"`
+	BuyerEmail string  `json:"-"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// CancelRequest asks for paid tickets of one event to be cancelled.
+type CancelRequest struct {
+	EventID     int64
+	TicketIDs   []int64
+	RequestedBy int64
+	Reason      string
+
+	// FullRefund returns the full price regardless of the event's refund
+	// policy, for cancellations made by the organizer.
+	FullRefund bool
+}
+
+type RefundModel struct {
+	DB *sql.DB
+}
+
+// cancelledTicket is a locked ticket, the price its buyer paid including
+// tax, and their share of the service fee.
+type cancelledTicket struct {
+	id         int64
+	eventID    int64
+	orderID    *int64
+	status     TicketStatus
+	buyerEmail string
+	price      int64
+	fee        int64
+	currency   string
+}
+
+// CancelTickets cancels paid tickets, returns their quantity to sold_qty and
+// records one refund per order they were bought in. The refunds are stored as
+// pending when there is money to return; the caller settles them with the
+// payment provider and calls MarkSucceeded or MarkFailed. Either every ticket
+// is cancelled or none is.
+func (m RefundModel) CancelTickets(ctx context.Context, req CancelRequest) ([]*Refund, error) {
+	if len(req.TicketIDs) == 0 {
+		return []*Refund{}, nil
+	}
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	committed := false
+	defer func() {
+		if !committed {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var event Event
+	err = tx.QueryRowContext(ctx, `SELECT `+eventColumns+` FROM events e WHERE e.id = $1`, req.EventID).Scan(eventFields(&event)...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	refunds, err := cancelTickets(ctx, tx, &event, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	committed = true
+
+	return refunds, nil
+}
+
+// lineShare returns an expression for the share of amount owed to the ticket
+// numbered n, from 0, of an order line of quantity tickets. The shares of a
+// line's tickets differ by at most one and always add up to amount, however
+// the tickets are cancelled.
+func lineShare(amount, n, quantity string) string {
+	return `((` + amount + `) * (` + n + ` + 1) / ` + quantity + ` - (` + amount + `) * ` + n + ` / ` + quantity + `)`
+}
+
+// cancelTickets does the work of CancelTickets inside tx.
+func cancelTickets(ctx context.Context, tx *sql.Tx, event *Event, req CancelRequest) ([]*Refund, error) {
+	// Prices come from the order the ticket was bought in, less its share of
+	// any discount and plus its share of tax, or the ticket type for tickets
+	// sold before orders existed. Tickets are numbered within their order
+	// line by id so the shares do not depend on which are cancelled first.
+	rows, err := tx.QueryContext(ctx, `
+		WITH numbered AS (
+			SELECT id, ROW_NUMBER() OVER (PARTITION BY order_id, ticket_type_id ORDER BY id) - 1 AS n
+			FROM tickets
+			WHERE (order_id, ticket_type_id) IN (SELECT order_id, ticket_type_id FROM tickets WHERE id = ANY($1))
+		)
+		SELECT t.id, t.event_id, t.order_id, t.status, COALESCE(o.buyer_email, t.buyer_email, ''),
+		       COALESCE(`+lineShare("oi.line_total - oi.discount + oi.tax", "n.n", "oi.quantity")+`, tt.price),
+		       COALESCE(`+lineShare("oi.service_fee", "n.n", "oi.quantity")+`, 0),
+		       COALESCE(oi.currency, tt.currency)
+		FROM tickets t
+		JOIN ticket_types tt ON tt.id = t.ticket_type_id
+		LEFT JOIN orders o ON o.id = t.order_id
+		LEFT JOIN order_items oi ON oi.order_id = t.order_id AND oi.ticket_type_id = t.ticket_type_id
+		LEFT JOIN numbered n ON n.id = t.id
+		WHERE t.id = ANY($1)
+		ORDER BY t.id
+		FOR UPDATE OF t
+	`, pq.Array(req.TicketIDs))
+	if err != nil {
+		return nil, err
+	}
+
+	tickets := []*cancelledTicket{}
+	for rows.Next() {
+		var t cancelledTicket
+		err := rows.Scan(&t.id, &t.eventID, &t.orderID, &t.status, &t.buyerEmail, &t.price, &t.fee, &t.currency)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		tickets = append(tickets, &t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(tickets) != len(uniqueIDs(req.TicketIDs)) {
+		return nil, ErrTicketNotFound
+	}
+
+	for _, t := range tickets {
+		switch {
+		case t.eventID != req.EventID:
+			return nil, ErrTicketWrongEvent
+		case t.status == TicketUsed:
+			return nil, ErrTicketAlreadyUsed
+		case t.status == TicketCancelled:
+			return nil, ErrTicketCancelled
+		case t.status != TicketPaid:
+			return nil, ErrTicketNotPaid
+		}
+	}
+
+	// Group the tickets by order; tickets without one share the zero key
+	groups := map[int64][]*cancelledTicket{}
+	orderIDs := []int64{}
+	for _, t := range tickets {
+		var key int64
+		if t.orderID != nil {
+			key = *t.orderID
+		}
+		if _, ok := groups[key]; !ok {
+			orderIDs = append(orderIDs, key)
+		}
+		groups[key] = append(groups[key], t)
+	}
+	sort.Slice(orderIDs, func(i, j int) bool { return orderIDs[i] < orderIDs[j] })
+
+	now := time.Now()
+	refunds := make([]*Refund, 0, len(orderIDs))
+
+	for _, orderID := range orderIDs {
+		group := groups[orderID]
+
+		refund := &Refund{
+			Currency:    group[0].currency,
+			Reason:      req.Reason,
+			RequestedBy: &req.RequestedBy,
+			BuyerEmail:  group[0].buyerEmail,
+			TicketIDs:   make([]int64, 0, len(group)),
+		}
+
+		var paid, fees int64
+		for _, t := range group {
+			paid += t.price
+			fees += t.fee
+			refund.TicketIDs = append(refund.TicketIDs, t.id)
+		}
+
+		// Service fees are only returned when the organizer cancels
+		if req.FullRefund {
+			refund.Amount = paid + fees
+		} else {
+			refund.Amount = event.RefundFor(paid, now)
+		}
+
+		refund.Status = RefundPending
+		if refund.Amount == 0 {
+			refund.Status = RefundSucceeded
+		}
+
+		if orderID != 0 {
+			refund.OrderID = group[0].orderID
+
+			var paymentID int64
+			err = tx.QueryRowContext(ctx, `
+				SELECT p.id
+				FROM payments p
+				JOIN orders o ON o.reservation_id = p.reservation_id
+				WHERE o.id = $1 AND p.status = 'succeeded'
+				ORDER BY p.id DESC
+				LIMIT 1
+			`, orderID).Scan(&paymentID)
+			switch {
+			case err == nil:
+				refund.PaymentID = &paymentID
+			case !errors.Is(err, sql.ErrNoRows):
+				return nil, err
+			}
+		}
+
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO refunds (order_id, payment_id, amount, currency, reason, status, requested_by)
+			VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7)
+			RETURNING id, created_at, updated_at
+		`, refund.OrderID, refund.PaymentID, refund.Amount, refund.Currency, refund.Reason, refund.Status, refund.RequestedBy,
+		).Scan(&refund.ID, &refund.CreatedAt, &refund.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE tickets
+			SET status = 'cancelled', cancelled_at = now(), refund_id = $2
+			WHERE id = ANY($1)
+		`, pq.Array(refund.TicketIDs), refund.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		refunds = append(refunds, refund)
+	}
+
+	if err = restoreSoldQty(ctx, tx, req.TicketIDs); err != nil {
+		return nil, err
+	}
+
+	// Orders whose every ticket is now cancelled are closed
+	_, err = tx.ExecContext(ctx, `
+		UPDATE orders o
+		SET status = CASE
+		        WHEN (SELECT COALESCE(SUM(amount), 0) FROM refunds WHERE order_id = o.id) > 0 THEN 'refunded'::order_status
+		        ELSE 'cancelled'::order_status
+		    END,
+		    updated_at = now()
+		WHERE o.id = ANY($1)
+		  AND NOT EXISTS (
+		      SELECT 1 FROM tickets t WHERE t.order_id = o.id AND t.status <> 'cancelled'
+		  )
+	`, pq.Array(orderIDs))
+	if err != nil {
+		return nil, err
+	}
+
+	return refunds, nil
+}
+
+// restoreSoldQty returns the quantity of the given cancelled tickets to their
+// ticket types, locking the types in id order like InsertTickets does.
+func restoreSoldQty(ctx context.Context, tx *sql.Tx, ticketIDs []int64) error {
+	_, err := tx.ExecContext(ctx, `
+		SELECT id FROM ticket_types
+		WHERE id IN (SELECT ticket_type_id FROM tickets WHERE id = ANY($1))
+		ORDER BY id
+		FOR UPDATE
+	`, pq.Array(ticketIDs))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE ticket_types tt
+		SET sold_qty = tt.sold_qty - c.qty,
+		    updated_at = now()
+		FROM (
+			SELECT ticket_type_id, COUNT(*) AS qty
+			FROM tickets
+			WHERE id = ANY($1)
+			GROUP BY ticket_type_id
+		) c
+		WHERE tt.id = c.ticket_type_id
+	`, pq.Array(ticketIDs))
+	return err
+}
+
+// MarkSucceeded records that the provider returned the money.
+func (m RefundModel) MarkSucceeded(ctx context.Context, id int64, providerRef string) error {
+	query := `
+		UPDATE refunds
+		SET status = 'succeeded', provider_ref = $2, updated_at = now()
+		WHERE id = $1
+	`
+
+	_, err := m.DB.ExecContext(ctx, query, id, providerRef)
+	return err
+}
+
+// MarkFailed records that the money could not be returned automatically. The
+// tickets stay cancelled; the refund has to be settled by hand.
+func (m RefundModel) MarkFailed(ctx context.Context, id int64) error {
+	query := `
+		UPDATE refunds
+		SET status = 'failed', updated_at = now()
+		WHERE id = $1
+	`
+
+	_, err := m.DB.ExecContext(ctx, query, id)
+	return err
+}
+
+func uniqueIDs(ids []int64) []int64 {
+	seen := make(map[int64]bool, len(ids))
+	unique := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
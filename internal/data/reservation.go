@@ -0,0 +1,268 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type ReservationStatus string
+
+const (
+	ReservationActive    ReservationStatus = "active"
+	ReservationCompleted ReservationStatus = "completed"
+	ReservationExpired   ReservationStatus = "expired"
+	ReservationCancelled ReservationStatus = "cancelled"
+)
+
+// Reservation is a time-limited hold on tickets while the buyer checks out.
+type Reservation struct {
+	ID      int64  `json:"id"`
+	EventID int64  `json:"event_id"`
+	UserID  *int64 `json:"user_id,omitempty"`
+
+	Status    ReservationStatus `json:"status"`
+	ExpiresAt time.Time         `json:"expires_at"`
+
+	// Secret proves a reservation made without signing in belongs to the
+	// caller. It is only known when the reservation is made; the hash of it
+	// is stored.
+	Secret     string `json:"secret,omitempty"`
+	secretHash []byte
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// newReservationSecret returns a random secret and the hash stored for it.
+func newReservationSecret() (string, []byte, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, err
+	}
+
+	secret := base64.RawURLEncoding.EncodeToString(b)
+	hash := sha256.Sum256([]byte(secret))
+	return secret, hash[:], nil
+}
+
+// MatchesSecret reports whether secret is the one handed out when the
+// reservation was made.
+func (r *Reservation) MatchesSecret(secret string) bool {
+	if len(r.secretHash) == 0 || secret == "" {
+		return false
+	}
+
+	hash := sha256.Sum256([]byte(secret))
+	return subtle.ConstantTimeCompare(hash[:], r.secretHash) == 1
+}
+
+type ReservationModel struct {
+	DB *sql.DB
+}
+
+func (m ReservationModel) Get(ctx context.Context, id int64) (*Reservation, error) {
+	query := `
+		SELECT id, event_id, user_id, status, expires_at, secret_hash, created_at, updated_at
+		FROM reservations
+		WHERE id = $1
+	`
+
+	var r Reservation
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&r.ID,
+		&r.EventID,
+		&r.UserID,
+		&r.Status,
+		&r.ExpiresAt,
+		&r.secretHash,
+		&r.CreatedAt,
+		&r.UpdatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &r, nil
+}
+
+// Cancel releases an active reservation straight away.
+func (m ReservationModel) Cancel(ctx context.Context, id int64) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	committed := false
+	defer func() {
+		if !committed {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var status ReservationStatus
+	err = tx.QueryRowContext(ctx, `SELECT status FROM reservations WHERE id = $1 FOR UPDATE`, id).Scan(&status)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+
+	if status != ReservationActive {
+		return ErrReservationNotActive
+	}
+
+	if err = releaseReservations(ctx, tx, []int64{id}, ReservationCancelled); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	committed = true
+	return nil
+}
+
+// ReleaseExpired expires active reservations whose hold has run out, deletes
+// their reserved tickets and returns the quantity to the ticket types. It
+// processes at most limit reservations and returns how many were released.
+func (m ReservationModel) ReleaseExpired(ctx context.Context, limit int) (int, error) {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	committed := false
+	defer func() {
+		if !committed {
+			_ = tx.Rollback()
+		}
+	}()
+
+	// SKIP LOCKED lets several API instances sweep at the same time
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id
+		FROM reservations
+		WHERE status = 'active' AND expires_at <= now()
+		ORDER BY expires_at
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	`, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	if err = releaseReservations(ctx, tx, ids, ReservationExpired); err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	committed = true
+
+	return len(ids), nil
+}
+
+// releaseReservations returns the held quantity of the given (already locked)
+// reservations to their ticket types, deletes the held tickets and moves the
+// reservations to status.
+func releaseReservations(ctx context.Context, tx *sql.Tx, ids []int64, status ReservationStatus) error {
+	// Lock the affected ticket types in id order, like InsertTickets does
+	_, err := tx.ExecContext(ctx, `
+		SELECT id FROM ticket_types
+		WHERE id IN (
+			SELECT ticket_type_id FROM tickets
+			WHERE reservation_id = ANY($1) AND status = 'reserved'
+		)
+		ORDER BY id
+		FOR UPDATE
+	`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE ticket_types tt
+		SET reserved_qty = tt.reserved_qty - held.qty,
+		    updated_at = now()
+		FROM (
+			SELECT ticket_type_id, COUNT(*) AS qty
+			FROM tickets
+			WHERE reservation_id = ANY($1) AND status = 'reserved'
+			GROUP BY ticket_type_id
+		) held
+		WHERE tt.id = held.ticket_type_id
+	`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM tickets
+		WHERE reservation_id = ANY($1) AND status = 'reserved'
+	`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE reservations
+		SET status = $2, updated_at = now()
+		WHERE id = ANY($1)
+	`, pq.Array(ids), status)
+	if err != nil {
+		return err
+	}
+
+	if err = releasePromoCodes(ctx, tx, ids); err != nil {
+		return err
+	}
+
+	if err = settleWaitlistOffers(ctx, tx, ids, WaitlistExpired); err != nil {
+		return err
+	}
+
+	orderStatus := OrderExpired
+	if status == ReservationCancelled {
+		orderStatus = OrderCancelled
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE orders
+		SET status = $2, updated_at = now()
+		WHERE reservation_id = ANY($1) AND status = 'pending'
+	`, pq.Array(ids), orderStatus)
+	return err
+}
@@ -0,0 +1,360 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/AbrahamMayowa/ticketmania/internal/validator"
+	"github.com/lib/pq"
+)
+
+// maxSeatsPerEvent caps the size of a seat map.
+const maxSeatsPerEvent = 20000
+
+type SeatStatus string
+
+const (
+	SeatAvailable SeatStatus = "available"
+	SeatHeld      SeatStatus = "held"
+	SeatSold      SeatStatus = "sold"
+)
+
+// Seat is one assigned seat of an event. Its ticket type sets the price.
+type Seat struct {
+	ID           int64      `json:"id"`
+	Section      string     `json:"-"`
+	Row          string     `json:"-"`
+	Number       string     `json:"number"`
+	TicketTypeID int64      `json:"ticket_type_id"`
+	Price        int64      `json:"price"`
+	Currency     string     `json:"currency"`
+	Status       SeatStatus `json:"status"`
+}
+
+type SeatRow struct {
+	Label string  `json:"label"`
+	Seats []*Seat `json:"seats"`
+}
+
+type SeatSection struct {
+	Name string     `json:"name"`
+	Rows []*SeatRow `json:"rows"`
+}
+
+// SeatMap is an event's seats grouped by section and row, in the order the
+// organizer laid them out.
+type SeatMap struct {
+	EventID   int64          `json:"event_id"`
+	Total     int            `json:"total"`
+	Available int            `json:"available"`
+	Sections  []*SeatSection `json:"sections"`
+}
+
+type SeatModel struct {
+	DB *sql.DB
+}
+
+func ValidateSeats(v *validator.Validator, seats []*Seat) {
+	v.Check(len(seats) <= maxSeatsPerEvent, "sections", fmt.Sprintf("must not contain more than %d seats", maxSeatsPerEvent))
+
+	seen := make(map[[3]string]bool, len(seats))
+	for _, s := range seats {
+		v.Check(s.Section != "", "sections", "every section must have a name")
+		v.Check(s.Row != "", "sections", "every row must have a label")
+		v.Check(s.Number != "", "sections", "every seat must have a number")
+		v.Check(s.TicketTypeID != 0, "sections", "every seat must have a ticket type")
+
+		key := [3]string{s.Section, s.Row, s.Number}
+		v.Check(!seen[key], "sections", fmt.Sprintf("seat %s %s%s is listed twice", s.Section, s.Row, s.Number))
+		seen[key] = true
+	}
+}
+
+// Replace swaps an event's seat map for seats and sets the total_qty of each
+// seated ticket type to its number of seats. The map can only change while
+// none of its seats or ticket types have been sold or held.
+func (m SeatModel) Replace(ctx context.Context, eventID int64, seats []*Seat) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	committed := false
+	defer func() {
+		if !committed {
+			_ = tx.Rollback()
+		}
+	}()
+
+	// Locking the event keeps purchases, which share-lock it, out until the
+	// new map is in place
+	var lockedID int64
+	err = tx.QueryRowContext(ctx, `SELECT id FROM events WHERE id = $1 FOR UPDATE`, eventID).Scan(&lockedID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+
+	var seatsTaken bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM tickets t
+			JOIN seats s ON s.id = t.seat_id
+			WHERE s.event_id = $1 AND t.status IN ('reserved', 'paid', 'used')
+		)
+	`, eventID).Scan(&seatsTaken)
+	if err != nil {
+		return err
+	}
+
+	if seatsTaken {
+		return ErrSeatMapHasSales
+	}
+
+	ticketTypeIDs := uniqueIDs(seatTicketTypeIDs(seats))
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, sold_qty + reserved_qty
+		FROM ticket_types
+		WHERE id = ANY($1) AND event_id = $2
+		ORDER BY id
+		FOR UPDATE
+	`, pq.Array(ticketTypeIDs), eventID)
+	if err != nil {
+		return err
+	}
+
+	found := 0
+	for rows.Next() {
+		var id int64
+		var taken int
+		if err := rows.Scan(&id, &taken); err != nil {
+			rows.Close()
+			return err
+		}
+		if taken > 0 {
+			rows.Close()
+			return fmt.Errorf("ticket type %d already has sales: %w", id, ErrSeatMapHasSales)
+		}
+		found++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if found != len(ticketTypeIDs) {
+		return fmt.Errorf("seat map uses a ticket type of another event: %w", ErrTicketNotFound)
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM seats WHERE event_id = $1`, eventID)
+	if err != nil {
+		return err
+	}
+
+	if len(seats) > 0 {
+		sections := make([]string, len(seats))
+		seatRows := make([]string, len(seats))
+		numbers := make([]string, len(seats))
+		types := make([]int64, len(seats))
+		for i, s := range seats {
+			sections[i], seatRows[i], numbers[i], types[i] = s.Section, s.Row, s.Number, s.TicketTypeID
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO seats (event_id, section, row_label, number, ticket_type_id)
+			SELECT $1, section, row_label, number, ticket_type_id
+			FROM unnest($2::text[], $3::text[], $4::text[], $5::bigint[]) AS s(section, row_label, number, ticket_type_id)
+		`, eventID, pq.Array(sections), pq.Array(seatRows), pq.Array(numbers), pq.Array(types))
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE ticket_types tt
+		SET total_qty = s.seats, updated_at = now()
+		FROM (
+			SELECT ticket_type_id, COUNT(*) AS seats
+			FROM seats
+			WHERE event_id = $1
+			GROUP BY ticket_type_id
+		) s
+		WHERE tt.id = s.ticket_type_id
+	`, eventID)
+	if err != nil {
+		return err
+	}
+
+	err = checkVenueCapacity(ctx, tx, eventID)
+	if err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	committed = true
+	return nil
+}
+
+// GetMap returns an event's seats with their live status. Events without
+// seats get an empty map.
+func (m SeatModel) GetMap(ctx context.Context, eventID int64) (*SeatMap, error) {
+	query := `
+		SELECT s.id, s.section, s.row_label, s.number, s.ticket_type_id, tt.price, tt.currency,
+		       CASE
+		           WHEN t.status = 'reserved' THEN 'held'
+		           WHEN t.status IS NOT NULL THEN 'sold'
+		           ELSE 'available'
+		       END
+		FROM seats s
+		JOIN ticket_types tt ON tt.id = s.ticket_type_id
+		LEFT JOIN tickets t ON t.seat_id = s.id AND t.status IN ('reserved', 'paid', 'used')
+		WHERE s.event_id = $1
+		ORDER BY s.id
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	seatMap := &SeatMap{EventID: eventID, Sections: []*SeatSection{}}
+	var section *SeatSection
+	var row *SeatRow
+	for rows.Next() {
+		var s Seat
+		err := rows.Scan(&s.ID, &s.Section, &s.Row, &s.Number, &s.TicketTypeID, &s.Price, &s.Currency, &s.Status)
+		if err != nil {
+			return nil, err
+		}
+
+		if section == nil || section.Name != s.Section {
+			section = &SeatSection{Name: s.Section}
+			seatMap.Sections = append(seatMap.Sections, section)
+			row = nil
+		}
+		if row == nil || row.Label != s.Row {
+			row = &SeatRow{Label: s.Row}
+			section.Rows = append(section.Rows, row)
+		}
+		row.Seats = append(row.Seats, &s)
+
+		seatMap.Total++
+		if s.Status == SeatAvailable {
+			seatMap.Available++
+		}
+	}
+
+	return seatMap, rows.Err()
+}
+
+// checkSeats checks each seat picked in a purchase is free and belongs to the
+// item's ticket type, locking the seats for purchases. Ticket types with a
+// seat map cannot be bought without picking seats.
+func (c *checkout) checkSeats(ctx context.Context, q queryer, eventID int64, items []*TicketPurchaseItem) error {
+	ticketTypeIDs := []int64{}
+	seatTypes := map[int64]int64{}
+	for _, item := range items {
+		ticketTypeIDs = append(ticketTypeIDs, *item.TicketTypeID)
+		for _, seatID := range item.SeatIDs {
+			if _, ok := seatTypes[seatID]; ok {
+				return fmt.Errorf("seat %d was picked twice: %w", seatID, ErrSeatNotAvailable)
+			}
+			seatTypes[seatID] = *item.TicketTypeID
+		}
+	}
+
+	seated, err := queryIDs(ctx, q, `
+		SELECT DISTINCT ticket_type_id FROM seats WHERE ticket_type_id = ANY($1)
+	`, pq.Array(ticketTypeIDs))
+	if err != nil {
+		return err
+	}
+
+	isSeated := make(map[int64]bool, len(seated))
+	for _, id := range seated {
+		isSeated[id] = true
+	}
+
+	for _, item := range items {
+		if isSeated[*item.TicketTypeID] && len(item.SeatIDs) == 0 {
+			return fmt.Errorf("ticket type %d: %w", *item.TicketTypeID, ErrSeatsRequired)
+		}
+		if !isSeated[*item.TicketTypeID] && len(item.SeatIDs) > 0 {
+			return fmt.Errorf("ticket type %d has no seat map: %w", *item.TicketTypeID, ErrSeatNotAvailable)
+		}
+	}
+
+	if len(seatTypes) == 0 {
+		return nil
+	}
+
+	seatIDs := make([]int64, 0, len(seatTypes))
+	for id := range seatTypes {
+		seatIDs = append(seatIDs, id)
+	}
+
+	// Seats are locked in id order so overlapping purchases cannot deadlock
+	rows, err := q.QueryContext(ctx, `
+		SELECT s.id, s.ticket_type_id, s.section, s.row_label, s.number,
+		       EXISTS (
+		           SELECT 1 FROM tickets t
+		           WHERE t.seat_id = s.id AND t.status IN ('reserved', 'paid', 'used')
+		       )
+		FROM seats s
+		WHERE s.id = ANY($1) AND s.event_id = $2
+		ORDER BY s.id
+		`+c.forLock("FOR UPDATE OF s"), pq.Array(seatIDs), eventID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	found := 0
+	for rows.Next() {
+		var s Seat
+		var taken bool
+		if err := rows.Scan(&s.ID, &s.TicketTypeID, &s.Section, &s.Row, &s.Number, &taken); err != nil {
+			return err
+		}
+		found++
+
+		switch {
+		case s.TicketTypeID != seatTypes[s.ID]:
+			return fmt.Errorf("seat %s %s%s is not sold as ticket type %d: %w",
+				s.Section, s.Row, s.Number, seatTypes[s.ID], ErrSeatNotAvailable)
+		case taken:
+			return fmt.Errorf("seat %s %s%s is taken: %w", s.Section, s.Row, s.Number, ErrSeatNotAvailable)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if found != len(seatIDs) {
+		return fmt.Errorf("some seats do not exist for this event: %w", ErrSeatNotAvailable)
+	}
+
+	return nil
+}
+
+// ticketTypeHasSeats reports whether a ticket type is sold by seat.
+func ticketTypeHasSeats(ctx context.Context, q queryRower, ticketTypeID int64) (bool, error) {
+	var seated bool
+	err := q.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM seats WHERE ticket_type_id = $1)`, ticketTypeID).Scan(&seated)
+	return seated, err
+}
+
+func seatTicketTypeIDs(seats []*Seat) []int64 {
+	ids := make([]int64, len(seats))
+	for i, s := range seats {
+		ids[i] = s.TicketTypeID
+	}
+	return ids
+}
@@ -0,0 +1,255 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/AbrahamMayowa/ticketmania/internal/rrule"
+	"github.com/AbrahamMayowa/ticketmania/internal/validator"
+	"github.com/lib/pq"
+)
+
+// maxSeriesOccurrences caps how many events one series can create.
+const maxSeriesOccurrences = 366
+
+// EventSeries is a recurring event. Its occurrences are ordinary events
+// created from a template event on each date of RRule, with their own copy of
+// the template's ticket types. Once created, every occurrence can be edited,
+// sold and cancelled on its own.
+type EventSeries struct {
+	ID     int64 `json:"id"`
+	UserID int64 `json:"user_id"`
+
+	// RRule is a recurrence rule such as "FREQ=WEEKLY;BYDAY=FR;COUNT=10",
+	// starting from the template's date. ExDates are dates it skips, as
+	// YYYY-MM-DD.
+	RRule   string   `json:"rrule"`
+	ExDates []string `json:"exdates"`
+
+	Occurrences []*Event `json:"occurrences"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type EventSeriesModel struct {
+	DB *sql.DB
+}
+
+// ValidateEventSeries checks the rule and exceptions of a series whose first
+// occurrence is on start.
+func ValidateEventSeries(v *validator.Validator, s *EventSeries, start time.Time) {
+	for _, d := range s.ExDates {
+		if _, err := validator.ParseDate(d); err != nil {
+			v.AddError("exdates", "must be dates such as 2026-12-25")
+			return
+		}
+	}
+
+	dates, err := s.dates(start)
+	switch {
+	case errors.Is(err, rrule.ErrTooManyOccurrences):
+		v.AddError("rrule", fmt.Sprintf("must not produce more than %d events", maxSeriesOccurrences))
+	case err != nil:
+		v.AddError("rrule", err.Error())
+	default:
+		v.Check(len(dates) > 0, "rrule", "must produce at least one date that is not excluded")
+	}
+}
+
+// dates returns the dates of the series' occurrences.
+func (s *EventSeries) dates(start time.Time) ([]time.Time, error) {
+	rule, err := rrule.Parse(s.RRule)
+	if err != nil {
+		return nil, err
+	}
+
+	except := make([]time.Time, 0, len(s.ExDates))
+	for _, d := range s.ExDates {
+		t, err := validator.ParseDate(d)
+		if err != nil {
+			return nil, err
+		}
+		except = append(except, t)
+	}
+
+	return rule.Dates(start, except, maxSeriesOccurrences)
+}
+
+// Insert creates a series and an occurrence of template, with a copy of
+// ticketTypes, on each of its dates. The rule is stored in canonical form.
+// Occurrences keep the template's times, timezone and length in days.
+func (m EventSeriesModel) Insert(ctx context.Context, s *EventSeries, template *Event, ticketTypes []*TicketType) error {
+	rule, err := rrule.Parse(s.RRule)
+	if err != nil {
+		return err
+	}
+	dates, err := s.dates(template.Date)
+	if err != nil {
+		return err
+	}
+	s.RRule = rule.String()
+	if s.ExDates == nil {
+		s.ExDates = []string{}
+	}
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	committed := false
+	defer func() {
+		if !committed {
+			_ = tx.Rollback()
+		}
+	}()
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO event_series (user_id, rrule, exdates)
+		VALUES ($1, $2, $3::date[])
+		RETURNING id, created_at, updated_at
+	`, s.UserID, s.RRule, pq.Array(s.ExDates)).Scan(&s.ID, &s.CreatedAt, &s.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	days := int(template.EndDate.Sub(template.Date).Hours() / 24)
+
+	s.Occurrences = make([]*Event, 0, len(dates))
+	for _, date := range dates {
+		shift := int(date.Sub(template.Date).Hours() / 24)
+
+		e := *template
+		e.SeriesID = &s.ID
+		e.Date = date
+		e.EndDate = date.AddDate(0, 0, days)
+
+		// Each occurrence sells its own tickets, in sales windows that
+		// move with its date
+		types := make([]*TicketType, len(ticketTypes))
+		for i, tt := range ticketTypes {
+			clone := *tt
+			clone.SalesStart = shiftDays(tt.SalesStart, shift)
+			clone.SalesEnd = shiftDays(tt.SalesEnd, shift)
+			types[i] = &clone
+		}
+
+		err = insertEvent(ctx, tx, &e, types)
+		if err != nil {
+			return err
+		}
+		s.Occurrences = append(s.Occurrences, &e)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	committed = true
+
+	return nil
+}
+
+// Get returns a series with its occurrences in date order.
+func (m EventSeriesModel) Get(ctx context.Context, id int64) (*EventSeries, error) {
+	s := EventSeries{ID: id}
+	err := m.DB.QueryRowContext(ctx, `
+		SELECT user_id, rrule, exdates::text[], created_at, updated_at
+		FROM event_series
+		WHERE id = $1
+	`, id).Scan(&s.UserID, &s.RRule, pq.Array(&s.ExDates), &s.CreatedAt, &s.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	s.Occurrences, err = queryEvents(ctx, m.DB, `
+		SELECT `+eventColumns+` FROM events e WHERE e.series_id = $1 ORDER BY e.date
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// Following returns e and the later occurrences of its series that can
+// still be edited, in date order.
+func (m EventSeriesModel) Following(ctx context.Context, e *Event) ([]*Event, error) {
+	if e.SeriesID == nil {
+		return nil, ErrNotInSeries
+	}
+
+	return queryEvents(ctx, m.DB, `
+		SELECT `+eventColumns+` FROM events e
+		WHERE e.series_id = $1 AND e.date >= $2 AND e.status IN ('draft', 'published')
+		ORDER BY e.date
+	`, *e.SeriesID, e.Date)
+}
+
+// UpdateAll saves the editable fields of several occurrences together. If
+// any of them changed since it was read, going by its version, none are
+// saved and ErrEditConflict is returned.
+func (m EventSeriesModel) UpdateAll(ctx context.Context, events []*Event) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	committed := false
+	defer func() {
+		if !committed {
+			_ = tx.Rollback()
+		}
+	}()
+
+	for _, e := range events {
+		err = updateEvent(ctx, tx, e)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	committed = true
+
+	return nil
+}
+
+// shiftDays returns t moved by days, or nil if t is nil.
+func shiftDays(t *time.Time, days int) *time.Time {
+	if t == nil {
+		return nil
+	}
+	shifted := t.AddDate(0, 0, days)
+	return &shifted
+}
+
+// queryEvents runs a query selecting eventColumns.
+func queryEvents(ctx context.Context, db *sql.DB, query string, args ...interface{}) ([]*Event, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*Event{}
+	for rows.Next() {
+		var e Event
+		if err := rows.Scan(eventFields(&e)...); err != nil {
+			return nil, err
+		}
+		events = append(events, &e)
+	}
+
+	return events, rows.Err()
+}
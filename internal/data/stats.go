@@ -0,0 +1,304 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+)
+
+// Sizes of the sales over time buckets.
+const (
+	BucketHour = "hour"
+	BucketDay  = "day"
+)
+
+// EventStats is an organizer's view of an event's sales and attendance.
+type EventStats struct {
+	EventID     int64              `json:"event_id"`
+	TicketTypes []*TicketTypeStats `json:"ticket_types"`
+
+	// Revenue has one entry per currency the event sold tickets in.
+	Revenue []*RevenueStats `json:"revenue"`
+
+	Sales         SalesOverTime     `json:"sales"`
+	CheckIns      CheckInStats      `json:"check_ins"`
+	Cancellations CancellationStats `json:"cancellations"`
+
+	GeneratedAt time.Time `json:"generated_at"`
+}
+
+// TicketTypeStats is the inventory of a ticket type. Sold counts tickets
+// paid for and not cancelled, Reserved those held by unexpired reservations.
+type TicketTypeStats struct {
+	ID        int64  `json:"id"`
+	Name      string `json:"name"`
+	Price     int64  `json:"price"`
+	Currency  string `json:"currency"`
+	TotalQty  int    `json:"total_qty"`
+	Sold      int    `json:"sold"`
+	Reserved  int    `json:"reserved"`
+	Remaining int    `json:"remaining"`
+	CheckedIn int    `json:"checked_in"`
+}
+
+// RevenueStats sums the orders paid in one currency, whatever happened to
+// them since. Gross is what buyers paid, fees and tax included; Refunded what
+// was or is being paid back.
+type RevenueStats struct {
+	Currency string `json:"currency"`
+	Orders   int    `json:"orders"`
+	Gross    int64  `json:"gross"`
+	Refunded int64  `json:"refunded"`
+	Net      int64  `json:"net"`
+}
+
+// SalesOverTime counts sales in buckets of one hour or day, local to the
+// event's timezone. Buckets without sales are left out.
+type SalesOverTime struct {
+	Bucket   string         `json:"bucket"`
+	Timezone string         `json:"timezone"`
+	Buckets  []*SalesBucket `json:"buckets"`
+}
+
+// SalesBucket holds the tickets first paid for in the bucket starting at
+// Start, and the totals of the orders they were bought in, per currency.
+type SalesBucket struct {
+	Start   time.Time        `json:"start"`
+	Tickets int              `json:"tickets"`
+	Gross   map[string]int64 `json:"gross"`
+}
+
+// CheckInStats counts admitted tickets and the scans reported by door
+// scanners.
+type CheckInStats struct {
+	CheckedIn    int `json:"checked_in"`
+	NotCheckedIn int `json:"not_checked_in"`
+	Accepted     int `json:"scans_accepted"`
+	Duplicate    int `json:"scans_duplicate"`
+	Rejected     int `json:"scans_rejected"`
+}
+
+// CancellationStats counts paid tickets that were cancelled, by who asked
+// for it, and the refunds that returned money for them.
+type CancellationStats struct {
+	Tickets     int `json:"tickets"`
+	ByHolder    int `json:"by_holder"`
+	ByOrganizer int `json:"by_organizer"`
+	Refunds     int `json:"refunds"`
+}
+
+type StatsModel struct {
+	DB *sql.DB
+}
+
+// ForEvent returns the stats of an event, with sales in buckets of bucket.
+func (m StatsModel) ForEvent(ctx context.Context, e *Event, bucket string) (*EventStats, error) {
+	stats := &EventStats{
+		EventID: e.ID,
+		Sales: SalesOverTime{
+			Bucket:   bucket,
+			Timezone: e.Timezone,
+			Buckets:  []*SalesBucket{},
+		},
+		GeneratedAt: time.Now().UTC(),
+	}
+
+	var err error
+	stats.TicketTypes, err = m.ticketTypes(ctx, e.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	stats.Revenue, err = m.revenue(ctx, e.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	stats.Sales.Buckets, err = m.sales(ctx, e, bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.DB.QueryRowContext(ctx, `
+		SELECT
+			(SELECT COUNT(*) FROM tickets WHERE event_id = $1 AND status = 'used'),
+			(SELECT COUNT(*) FROM tickets WHERE event_id = $1 AND status = 'paid'),
+			COUNT(*) FILTER (WHERE result = 'accepted'),
+			COUNT(*) FILTER (WHERE result = 'duplicate'),
+			COUNT(*) FILTER (WHERE result = 'rejected')
+		FROM check_in_scans
+		WHERE event_id = $1
+	`, e.ID).Scan(
+		&stats.CheckIns.CheckedIn,
+		&stats.CheckIns.NotCheckedIn,
+		&stats.CheckIns.Accepted,
+		&stats.CheckIns.Duplicate,
+		&stats.CheckIns.Rejected,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Cancellations the organizer asked for include cancelling the event
+	err = m.DB.QueryRowContext(ctx, `
+		SELECT
+			COUNT(*),
+			COUNT(*) FILTER (WHERE r.requested_by <> $2),
+			COUNT(*) FILTER (WHERE r.requested_by = $2),
+			COUNT(DISTINCT t.refund_id) FILTER (WHERE r.amount > 0)
+		FROM tickets t
+		LEFT JOIN refunds r ON r.id = t.refund_id
+		WHERE t.event_id = $1 AND t.status = 'cancelled' AND t.paid_at IS NOT NULL
+	`, e.ID, e.UserID).Scan(
+		&stats.Cancellations.Tickets,
+		&stats.Cancellations.ByHolder,
+		&stats.Cancellations.ByOrganizer,
+		&stats.Cancellations.Refunds,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+func (m StatsModel) ticketTypes(ctx context.Context, eventID int64) ([]*TicketTypeStats, error) {
+	rows, err := m.DB.QueryContext(ctx, `
+		SELECT tt.id, tt.name, tt.price, tt.currency, tt.total_qty, tt.sold_qty, tt.reserved_qty,
+		       (SELECT COUNT(*) FROM tickets t WHERE t.ticket_type_id = tt.id AND t.status = 'used')
+		FROM ticket_types tt
+		WHERE tt.event_id = $1
+		ORDER BY tt.created_at, tt.id
+	`, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	types := []*TicketTypeStats{}
+	for rows.Next() {
+		var s TicketTypeStats
+		err := rows.Scan(&s.ID, &s.Name, &s.Price, &s.Currency, &s.TotalQty, &s.Sold, &s.Reserved, &s.CheckedIn)
+		if err != nil {
+			return nil, err
+		}
+		s.Remaining = s.TotalQty - s.Sold - s.Reserved
+		types = append(types, &s)
+	}
+
+	return types, rows.Err()
+}
+
+// revenue sums paid orders and the refunds of the event's tickets per
+// currency. An order counts as paid once any of its tickets was, so orders
+// later refunded or cancelled without a refund keep their revenue. Failed
+// refunds are left out.
+func (m StatsModel) revenue(ctx context.Context, eventID int64) ([]*RevenueStats, error) {
+	rows, err := m.DB.QueryContext(ctx, `
+		WITH paid AS (
+			SELECT currency, COUNT(*) AS orders, SUM(total) AS gross
+			FROM orders o
+			WHERE o.event_id = $1
+			  AND EXISTS (SELECT 1 FROM tickets t WHERE t.order_id = o.id AND t.paid_at IS NOT NULL)
+			GROUP BY currency
+		), refunded AS (
+			SELECT currency, SUM(amount) AS amount
+			FROM refunds
+			WHERE status <> 'failed'
+			  AND id IN (SELECT refund_id FROM tickets WHERE event_id = $1 AND refund_id IS NOT NULL)
+			GROUP BY currency
+		)
+		SELECT COALESCE(p.currency, r.currency), COALESCE(p.orders, 0), COALESCE(p.gross, 0), COALESCE(r.amount, 0)
+		FROM paid p
+		FULL JOIN refunded r ON r.currency = p.currency
+		ORDER BY 1
+	`, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revenue := []*RevenueStats{}
+	for rows.Next() {
+		var s RevenueStats
+		if err := rows.Scan(&s.Currency, &s.Orders, &s.Gross, &s.Refunded); err != nil {
+			return nil, err
+		}
+		s.Net = s.Gross - s.Refunded
+		revenue = append(revenue, &s)
+	}
+
+	return revenue, rows.Err()
+}
+
+// sales puts tickets in buckets by when they were paid for, and orders by
+// when their first ticket was, in the event's timezone.
+func (m StatsModel) sales(ctx context.Context, e *Event, bucket string) ([]*SalesBucket, error) {
+	buckets := map[time.Time]*SalesBucket{}
+	get := func(start time.Time) *SalesBucket {
+		start = start.In(e.location())
+		b, ok := buckets[start.UTC()]
+		if !ok {
+			b = &SalesBucket{Start: start, Gross: map[string]int64{}}
+			buckets[start.UTC()] = b
+		}
+		return b
+	}
+
+	rows, err := m.DB.QueryContext(ctx, `
+		SELECT date_trunc($2, paid_at, $3), COUNT(*)
+		FROM tickets
+		WHERE event_id = $1 AND paid_at IS NOT NULL
+		GROUP BY 1
+	`, e.ID, bucket, e.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var start time.Time
+		var tickets int
+		if err := rows.Scan(&start, &tickets); err != nil {
+			return nil, err
+		}
+		get(start).Tickets = tickets
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = m.DB.QueryContext(ctx, `
+		SELECT date_trunc($2, paid.at, $3), o.currency, SUM(o.total)
+		FROM orders o
+		JOIN LATERAL (SELECT MIN(t.paid_at) AS at FROM tickets t WHERE t.order_id = o.id) paid ON paid.at IS NOT NULL
+		WHERE o.event_id = $1
+		GROUP BY 1, 2
+	`, e.ID, bucket, e.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var start time.Time
+		var currency string
+		var gross int64
+		if err := rows.Scan(&start, &currency, &gross); err != nil {
+			return nil, err
+		}
+		get(start).Gross[currency] = gross
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sales := make([]*SalesBucket, 0, len(buckets))
+	for _, b := range buckets {
+		sales = append(sales, b)
+	}
+	sort.Slice(sales, func(i, j int) bool { return sales[i].Start.Before(sales[j].Start) })
+
+	return sales, nil
+}
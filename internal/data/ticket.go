@@ -1,10 +1,16 @@
 package data
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
+
 	"github.com/AbrahamMayowa/ticketmania/internal/validator"
+	"github.com/lib/pq"
 )
 
 type TicketStatus string
@@ -19,45 +25,163 @@ const (
 
 type Ticket struct {
 	ID           int64  `json:"id"`
-	EventID      *int64  `json:"event_id"`
+	EventID      *int64 `json:"event_id"`
 	TicketTypeID *int64 `json:"ticket_type_id"`
 
-	UserID *int64 `json:"user_id,omitempty"`
+	UserID        *int64 `json:"user_id,omitempty"`
+	ReservationID *int64 `json:"reservation_id,omitempty"`
+	OrderID       *int64 `json:"order_id,omitempty"`
 
 	Status TicketStatus `json:"status"`
 
 	PaidAt *time.Time `json:"paid_at,omitempty"`
 	UsedAt *time.Time `json:"used_at,omitempty"`
 
+	CancelledAt *time.Time `json:"cancelled_at,omitempty"`
+	RefundID    *int64     `json:"refund_id,omitempty"`
+
+	// SeatID is the assigned seat for ticket types with a seat map.
+	SeatID *int64 `json:"seat_id,omitempty"`
+
 	CreatedAt time.Time `json:"created_at"`
 
 	BuyerEmail *string `json:"buyer_email"`
 	BuyerPhone *string `json:"buyer_phone"`
+
+	// Code is the signed code scanned at the door and SignedToken the
+	// Ed25519 token scanners can verify offline. Both are only filled in for
+	// paid or used tickets shown to their buyer.
+	Code        string `json:"code,omitempty"`
+	SignedToken string `json:"signed_token,omitempty"`
+}
+
+// Admitted reports whether the ticket has been paid for and can be used.
+func (t *Ticket) Admitted() bool {
+	return t.Status == TicketPaid || t.Status == TicketUsed
 }
 
 type TicketModel struct {
 	DB *sql.DB
 }
 
+// ticketColumns lists the columns read by scanTicket, in order.
+const ticketColumns = `id, event_id, ticket_type_id, user_id, reservation_id, order_id, status,
+	paid_at, used_at, created_at, buyer_email, buyer_phone, cancelled_at, refund_id, seat_id`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanTicket(row rowScanner) (*Ticket, error) {
+	var t Ticket
+	err := row.Scan(
+		&t.ID,
+		&t.EventID,
+		&t.TicketTypeID,
+		&t.UserID,
+		&t.ReservationID,
+		&t.OrderID,
+		&t.Status,
+		&t.PaidAt,
+		&t.UsedAt,
+		&t.CreatedAt,
+		&t.BuyerEmail,
+		&t.BuyerPhone,
+		&t.CancelledAt,
+		&t.RefundID,
+		&t.SeatID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (m TicketModel) Get(ctx context.Context, id int64) (*Ticket, error) {
+	query := `SELECT ` + ticketColumns + ` FROM tickets WHERE id = $1`
+
+	t, err := scanTicket(m.DB.QueryRowContext(ctx, query, id))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return t, nil
+}
+
+// CheckIn admits a paid ticket to eventID, marking it used and recording the
+// scan against deviceID. The status check and update happen in one statement,
+// so a ticket can only be admitted once even when scanned at two doors at the
+// same time.
+func (m TicketModel) CheckIn(ctx context.Context, ticketID, eventID int64, deviceID string) (*Ticket, error) {
+	query := `
+		WITH admitted AS (
+			UPDATE tickets
+			SET status = 'used', used_at = now()
+			WHERE id = $1 AND event_id = $2 AND status = 'paid'
+			RETURNING ` + ticketColumns + `
+		), scan AS (
+			INSERT INTO check_in_scans (event_id, ticket_id, device_id, scanned_at, result)
+			SELECT event_id, id, $3, used_at, 'accepted' FROM admitted
+		)
+		SELECT ` + ticketColumns + ` FROM admitted`
+
+	t, err := scanTicket(m.DB.QueryRowContext(ctx, query, ticketID, eventID, deviceID))
+	if err == nil {
+		return t, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	// Nothing was updated; work out why
+	t, err = m.Get(ctx, ticketID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case *t.EventID != eventID:
+		return nil, ErrTicketWrongEvent
+	case t.Status == TicketUsed:
+		return t, ErrTicketAlreadyUsed
+	case t.Status == TicketCancelled:
+		return t, ErrTicketCancelled
+	default:
+		return t, ErrTicketNotPaid
+	}
+}
+
 func ValidateTicket(v *validator.Validator, t *TicketPurchaseItem) {
 	v.Check(t.TicketTypeID != nil, "ticket type", "must be provided")
 	v.Check(t.BuyerEmail != "", "buyer_email", "must be provided")
 	v.Check(t.BuyerPhone != "", "buyer_phone", "must be provided")
 	v.Check(t.Quantity != 0, "quantity", "must be provided")
+	v.Check(t.Quantity >= 0, "quantity", "must not be negative")
+	v.Check(len(t.SeatIDs) == 0 || len(t.SeatIDs) == t.Quantity, "seatIds", "must contain one seat per ticket")
 }
 
-
-// TicketPurchaseResult contains the created tickets
+// TicketPurchaseResult contains the created tickets, the reservation
+// holding them and the order they belong to.
 type TicketPurchaseResult struct {
-	Tickets []*Ticket
+	Tickets     []*Ticket    `json:"tickets"`
+	Reservation *Reservation `json:"reservation"`
+	Order       *Order       `json:"order"`
 }
 
-
 type TicketPurchaseItem struct {
 	TicketTypeID *int64
 	Quantity     int
 	BuyerEmail   string
 	BuyerPhone   string
+
+	// SeatIDs picks the seats for ticket types with a seat map, one per
+	// ticket.
+	SeatIDs []int64
 }
 
 // TicketPurchaseRequest represents the entire purchase request
@@ -65,20 +189,30 @@ type TicketPurchaseRequest struct {
 	EventID *int64
 	UserID  *int64
 	Items   []*TicketPurchaseItem
+
+	// PromoCode is an optional discount code for the event.
+	PromoCode string
+
+	// HoldFor is how long the tickets stay reserved waiting for payment.
+	// Unpaid holds are released by ReservationModel.ReleaseExpired.
+	HoldFor time.Duration
 }
 
+// InsertTickets reserves the requested tickets under a new reservation. The
+// tickets become paid once PaymentModel.MarkSucceeded runs for it.
 func (m TicketModel) InsertTickets(tickets *TicketPurchaseRequest) (*TicketPurchaseResult, error) {
-	for i, item := range tickets.Items {
-    if item != nil {
-        fmt.Printf("Item %d: %+v\n", i, *item)
-    }
-}
+	if tickets.HoldFor <= 0 {
+		return nil, errors.New("a hold duration is required to reserve tickets")
+	}
+
+	ctx := context.Background()
+
 	// Start a transaction
-	tx, err := m.DB.Begin()
+	tx, err := m.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, err
 	}
-	
+
 	committed := false
 	defer func() {
 		if !committed {
@@ -86,61 +220,283 @@ func (m TicketModel) InsertTickets(tickets *TicketPurchaseRequest) (*TicketPurch
 		}
 	}()
 
-	result := &TicketPurchaseResult{
-		Tickets: make([]*Ticket, 0),
+	c, err := prepareCheckout(ctx, tx, tickets, true)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := holdTickets(ctx, tx, tickets, c)
+	if err != nil {
+		return nil, err
+	}
+
+	// Commit the transaction
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	committed = true
+
+	return result, nil
+}
+
+// Quote prices a purchase exactly as InsertTickets would, running the same
+// checks, without reserving anything. Promo codes are checked but not used.
+// Quotes take no locks, so they cannot hold up purchases; what they read may
+// have changed by the time the purchase is made, which checks again.
+func (m TicketModel) Quote(ctx context.Context, tickets *TicketPurchaseRequest) (*Quote, error) {
+	c, err := prepareCheckout(ctx, m.DB, tickets, false)
+	if err != nil {
+		return nil, err
+	}
+
+	order, err := c.buildOrder(ctx, m.DB, tickets)
+	if err != nil {
+		return nil, err
+	}
+
+	return newQuote(order), nil
+}
+
+// checkout is a purchase checked against its event and ticket types.
+type checkout struct {
+	pricing       Pricing
+	ticketTypeIDs []int64 // sorted
+	ticketTypes   map[int64]*TicketType
+	quantities    map[int64]int
+	currency      string
+
+	// locked is set when the rows read were locked for a purchase.
+	locked bool
+}
+
+// forLock returns clause when a checkout locks the rows it reads, and
+// nothing for quotes.
+func (c *checkout) forLock(clause string) string {
+	if !c.locked {
+		return ""
+	}
+	return clause
+}
+
+// prepareCheckout checks that a purchase can go ahead. With lock set it locks
+// the event, ticket types and picked seats until tx ends, as purchases must;
+// without it the same checks run on plain reads.
+func prepareCheckout(ctx context.Context, q queryer, tickets *TicketPurchaseRequest, lock bool) (*checkout, error) {
+	c := &checkout{
+		ticketTypes: make(map[int64]*TicketType),
+		quantities:  make(map[int64]int),
+		locked:      lock,
+	}
+
+	// Share-lock the event so it cannot be cancelled while tickets are
+	// being reserved
+	var eventStatus EventStatus
+	err := q.QueryRowContext(ctx, `
+		SELECT status, service_fee_flat, service_fee_bps, fees_absorbed, tax_rate_bps
+		FROM events
+		WHERE id = $1
+		`+c.forLock("FOR SHARE"), tickets.EventID).Scan(
+		&eventStatus,
+		&c.pricing.ServiceFeeFlat,
+		&c.pricing.ServiceFeeBps,
+		&c.pricing.FeesAbsorbed,
+		&c.pricing.TaxRateBps,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("event %d not found: %w", *tickets.EventID, ErrTicketNotFound)
+		}
+		return nil, err
+	}
+
+	if eventStatus != EventPublished {
+		return nil, ErrEventNotOnSale
 	}
 
 	// Group items by ticket type to get total quantities needed
-	ticketTypeQuantities := make(map[*int64]int)
+	buyerEmails := make(map[int64][]string)
 	for _, item := range tickets.Items {
-		ticketTypeQuantities[item.TicketTypeID] += item.Quantity
+		c.quantities[*item.TicketTypeID] += item.Quantity
+		buyerEmails[*item.TicketTypeID] = append(buyerEmails[*item.TicketTypeID], strings.ToLower(item.BuyerEmail))
 	}
 
-	fmt.Println(ticketTypeQuantities)
+	// Lock ticket types in a stable order so concurrent purchases of the
+	// same types cannot deadlock each other.
+	for ticketTypeID := range c.quantities {
+		c.ticketTypeIDs = append(c.ticketTypeIDs, ticketTypeID)
+	}
+	sort.Slice(c.ticketTypeIDs, func(i, j int) bool { return c.ticketTypeIDs[i] < c.ticketTypeIDs[j] })
 
 	// Lock all ticket types and verify availability
-	ticketTypes := make(map[int64]*TicketType)
-	for ticketTypeID, totalQty := range ticketTypeQuantities {
+	for _, ticketTypeID := range c.ticketTypeIDs {
+		totalQty := c.quantities[ticketTypeID]
+
 		var tt TicketType
-		query := `
-			SELECT id, event_id, name, price, currency, total_qty, sold_qty, created_at, updated_at
-			FROM ticket_types
-			WHERE id = $1 AND event_id = $2
-			FOR UPDATE
-		`
-	
-		err = tx.QueryRow(query, ticketTypeID, tickets.EventID).Scan(
-			&tt.ID,
-			&tt.EventID,
-			&tt.Name,
-			&tt.Price,
-			&tt.Currency,
-			&tt.TotalQty,
-			&tt.SoldQty,
-			&tt.CreatedAt,
-			&tt.UpdatedAt,
-		)
+		query := `SELECT ` + ticketTypeColumns + ` FROM ticket_types WHERE id = $1 AND event_id = $2 ` + c.forLock("FOR UPDATE")
+
+		err = q.QueryRowContext(ctx, query, ticketTypeID, tickets.EventID).Scan(ticketTypeFields(&tt)...)
 		if err != nil {
 			if err == sql.ErrNoRows {
-				return nil, fmt.Errorf("ticket type %d not found: %w", *ticketTypeID, ErrTicketNotFound)
+				return nil, fmt.Errorf("ticket type %d not found: %w", ticketTypeID, ErrTicketNotFound)
+			}
+			return nil, err
+		}
+
+		if err = tt.CheckOnSale(time.Now()); err != nil {
+			return nil, err
+		}
+
+		if err = tt.CheckOrderQuantity(totalQty); err != nil {
+			return nil, err
+		}
+
+		if tt.MaxPerBuyer != nil {
+			err = checkBuyerLimit(ctx, q, &tt, totalQty, tickets.UserID, buyerEmails[ticketTypeID])
+			if err != nil {
+				return nil, err
 			}
+		}
+
+		// A reservation is paid with a single payment
+		if c.currency != "" && tt.Currency != c.currency {
+			return nil, fmt.Errorf("%s and %s: %w", c.currency, tt.Currency, ErrMixedCurrency)
+		}
+		c.currency = tt.Currency
+
+		// Tickets freed while buyers are waiting for them go to the waitlist
+		// first, so they are kept from the public
+		var waiting int
+		waiting, err = waitlistedQty(ctx, q, ticketTypeID)
+		if err != nil {
 			return nil, err
 		}
 
 		// Check availability
-		availableQty := tt.TotalQty - tt.SoldQty
+		availableQty := max(tt.Available()-waiting, 0)
 		if availableQty < totalQty {
-			return nil, fmt.Errorf("insufficient tickets for type %s: requested %d, available %d: %w", 
+			return nil, fmt.Errorf("insufficient tickets for type %s: requested %d, available %d: %w",
 				tt.Name, totalQty, availableQty, ErrTicketNotAvailable)
 		}
 
-		ticketTypes[*ticketTypeID] = &tt
+		c.ticketTypes[ticketTypeID] = &tt
 	}
 
+	err = c.checkSeats(ctx, q, *tickets.EventID, tickets.Items)
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// buildOrder prices the purchase: line items at the ticket type prices, then
+// the promo code discount, then service fees and tax. The promo code is not
+// redeemed here; see redeemPromoCode.
+func (c *checkout) buildOrder(ctx context.Context, q queryer, tickets *TicketPurchaseRequest) (*Order, error) {
+	// The order snapshots the prices charged for this purchase
+	order := &Order{
+		EventID:    *tickets.EventID,
+		UserID:     tickets.UserID,
+		BuyerEmail: tickets.Items[0].BuyerEmail,
+		BuyerPhone: &tickets.Items[0].BuyerPhone,
+		Status:     OrderPending,
+		Currency:   c.currency,
+	}
+
+	for _, ticketTypeID := range c.ticketTypeIDs {
+		tt := c.ticketTypes[ticketTypeID]
+		qty := c.quantities[ticketTypeID]
+
+		item := &OrderItem{
+			TicketTypeID: tt.ID,
+			Name:         tt.Name,
+			UnitPrice:    tt.Price,
+			Currency:     tt.Currency,
+			Quantity:     qty,
+			LineTotal:    tt.Price * int64(qty),
+		}
+		order.Items = append(order.Items, item)
+		order.Subtotal += item.LineTotal
+	}
+	order.Total = order.Subtotal
+
+	if tickets.PromoCode != "" {
+		err := c.applyPromoCode(ctx, q, tickets.PromoCode, order)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	c.pricing.Apply(order)
+
+	return order, nil
+}
+
+// holdTickets creates the reservation, order and reserved tickets for a
+// checked purchase and moves the quantities to reserved_qty.
+func holdTickets(ctx context.Context, tx *sql.Tx, tickets *TicketPurchaseRequest, c *checkout) (*TicketPurchaseResult, error) {
+	result := &TicketPurchaseResult{
+		Tickets: make([]*Ticket, 0),
+	}
+
+	reservation := &Reservation{
+		EventID: *tickets.EventID,
+		UserID:  tickets.UserID,
+		Status:  ReservationActive,
+	}
+
+	// Anyone could pay for a reservation made without signing in, so its
+	// buyer is handed a secret to prove it is theirs
+	if reservation.UserID == nil {
+		var err error
+		reservation.Secret, reservation.secretHash, err = newReservationSecret()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	reservationQuery := `
+		INSERT INTO reservations (event_id, user_id, status, expires_at, secret_hash)
+		VALUES ($1, $2, $3, now() + make_interval(secs => $4), $5)
+		RETURNING id, expires_at, created_at, updated_at
+	`
+	err := tx.QueryRowContext(ctx,
+		reservationQuery,
+		reservation.EventID,
+		reservation.UserID,
+		reservation.Status,
+		tickets.HoldFor.Seconds(),
+		reservation.secretHash,
+	).Scan(&reservation.ID, &reservation.ExpiresAt, &reservation.CreatedAt, &reservation.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create reservation: %w", err)
+	}
+
+	result.Reservation = reservation
+
+	order, err := c.buildOrder(ctx, tx, tickets)
+	if err != nil {
+		return nil, err
+	}
+	order.ReservationID = &reservation.ID
+
+	if order.PromoCodeID != nil {
+		if err = redeemPromoCode(ctx, tx, *order.PromoCodeID); err != nil {
+			return nil, err
+		}
+	}
+
+	err = insertOrder(ctx, tx, order)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create order: %w", err)
+	}
+
+	result.Order = order
+
 	// Insert tickets for each item
 	insertQuery := `
-		INSERT INTO tickets (event_id, ticket_type_id, user_id, status, paid_at, used_at, buyer_email, buyer_phone, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		INSERT INTO tickets (event_id, ticket_type_id, user_id, reservation_id, order_id, status, paid_at, used_at, buyer_email, buyer_phone, created_at, seat_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
 		RETURNING id, created_at
 	`
 
@@ -150,7 +506,7 @@ func (m TicketModel) InsertTickets(tickets *TicketPurchaseRequest) (*TicketPurch
 			ticket := &Ticket{
 				EventID:      tickets.EventID,
 				TicketTypeID: item.TicketTypeID,
-				Status:       TicketPaid, 
+				Status:       TicketReserved,
 				BuyerEmail:   &item.BuyerEmail,
 				BuyerPhone:   &item.BuyerPhone,
 			}
@@ -159,19 +515,32 @@ func (m TicketModel) InsertTickets(tickets *TicketPurchaseRequest) (*TicketPurch
 				ticket.UserID = tickets.UserID
 			}
 
-			err = tx.QueryRow(
+			ticket.ReservationID = &reservation.ID
+			ticket.OrderID = &order.ID
+
+			if len(item.SeatIDs) > 0 {
+				ticket.SeatID = &item.SeatIDs[i]
+			}
+
+			err = tx.QueryRowContext(ctx,
 				insertQuery,
 				ticket.EventID,
 				ticket.TicketTypeID,
 				ticket.UserID,
+				ticket.ReservationID,
+				ticket.OrderID,
 				ticket.Status,
 				ticket.PaidAt,
 				ticket.UsedAt,
 				ticket.BuyerEmail,
 				ticket.BuyerPhone,
 				time.Now(),
+				ticket.SeatID,
 			).Scan(&ticket.ID, &ticket.CreatedAt)
 			if err != nil {
+				if pgErr, ok := err.(*pq.Error); ok && pgErr.Code == "23505" {
+					return nil, fmt.Errorf("seat %d: %w", *ticket.SeatID, ErrSeatNotAvailable)
+				}
 				return nil, fmt.Errorf("failed to insert ticket: %w", err)
 			}
 
@@ -179,27 +548,48 @@ func (m TicketModel) InsertTickets(tickets *TicketPurchaseRequest) (*TicketPurch
 		}
 	}
 
-	// Update sold_qty for each ticket type
+	// Hold the quantity on each ticket type until the reservation is paid
 	updateQuery := `
 		UPDATE ticket_types
-		SET sold_qty = sold_qty + $1,
+		SET reserved_qty = reserved_qty + $1,
 		    updated_at = $2
 		WHERE id = $3
 	`
 
-	for ticketTypeID, qty := range ticketTypeQuantities {
-		_, err = tx.Exec(updateQuery, qty, time.Now(), ticketTypeID)
+	for _, ticketTypeID := range c.ticketTypeIDs {
+		_, err = tx.ExecContext(ctx, updateQuery, c.quantities[ticketTypeID], time.Now(), ticketTypeID)
 		if err != nil {
-			return nil, fmt.Errorf("failed to update sold quantity: %w", err)
+			return nil, fmt.Errorf("failed to update ticket quantity: %w", err)
 		}
 	}
 
-	// Commit the transaction
-	if err = tx.Commit(); err != nil {
-		return nil, err
-	}
-	committed = true
-
 	return result, nil
 }
 
+// checkBuyerLimit counts the tickets of a (locked) ticket type the buyer
+// already holds, matching on user ID or any of the buyer emails, and refuses
+// the purchase if qty more would go over MaxPerBuyer. Released and cancelled
+// tickets do not count.
+func checkBuyerLimit(ctx context.Context, q queryRower, tt *TicketType, qty int, userID *int64, emails []string) error {
+	var held int
+	err := q.QueryRowContext(ctx, `
+		SELECT COUNT(*)
+		FROM tickets
+		WHERE ticket_type_id = $1
+		  AND status IN ('reserved', 'paid', 'used')
+		  AND (user_id = $2 OR lower(buyer_email) = ANY($3))
+	`, tt.ID, userID, pq.Array(emails)).Scan(&held)
+	if err != nil {
+		return err
+	}
+
+	if held+qty > *tt.MaxPerBuyer {
+		if held == 0 {
+			return fmt.Errorf("%s is limited to %d tickets per buyer: %w", tt.Name, *tt.MaxPerBuyer, ErrPurchaseLimit)
+		}
+		return fmt.Errorf("%s is limited to %d tickets per buyer and %d are already yours: %w",
+			tt.Name, *tt.MaxPerBuyer, held, ErrPurchaseLimit)
+	}
+
+	return nil
+}
@@ -0,0 +1,302 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type TicketTypeModel struct {
+	DB *sql.DB
+}
+
+// ticketTypeColumns lists the columns read by ticketTypeFields, in order.
+const ticketTypeColumns = `id, event_id, name, price, currency, total_qty, sold_qty, reserved_qty,
+	sales_start, sales_end, sales_paused, min_per_order, max_per_order, max_per_buyer, created_at, updated_at`
+
+// ticketTypeFields returns scan destinations matching ticketTypeColumns.
+func ticketTypeFields(tt *TicketType) []interface{} {
+	return []interface{}{
+		&tt.ID,
+		&tt.EventID,
+		&tt.Name,
+		&tt.Price,
+		&tt.Currency,
+		&tt.TotalQty,
+		&tt.SoldQty,
+		&tt.ReservedQty,
+		&tt.SalesStart,
+		&tt.SalesEnd,
+		&tt.SalesPaused,
+		&tt.MinPerOrder,
+		&tt.MaxPerOrder,
+		&tt.MaxPerBuyer,
+		&tt.CreatedAt,
+		&tt.UpdatedAt,
+	}
+}
+
+// CheckOnSale returns an error wrapping ErrTicketTypeNotOnSale if tickets of
+// this type cannot be bought at now.
+func (tt *TicketType) CheckOnSale(now time.Time) error {
+	switch {
+	case tt.SalesPaused:
+		return fmt.Errorf("sales for %s are paused: %w", tt.Name, ErrTicketTypeNotOnSale)
+	case tt.SalesStart != nil && now.Before(*tt.SalesStart):
+		return fmt.Errorf("sales for %s open at %s: %w", tt.Name, tt.SalesStart.UTC().Format(time.RFC3339), ErrTicketTypeNotOnSale)
+	case tt.SalesEnd != nil && !now.Before(*tt.SalesEnd):
+		return fmt.Errorf("sales for %s closed at %s: %w", tt.Name, tt.SalesEnd.UTC().Format(time.RFC3339), ErrTicketTypeNotOnSale)
+	}
+	return nil
+}
+
+// CheckOrderQuantity returns an error wrapping ErrPurchaseLimit if qty
+// tickets cannot be bought in one order.
+func (tt *TicketType) CheckOrderQuantity(qty int) error {
+	switch {
+	case qty < tt.MinPerOrder:
+		return fmt.Errorf("%s must be bought at least %d at a time: %w", tt.Name, tt.MinPerOrder, ErrPurchaseLimit)
+	case tt.MaxPerOrder != nil && qty > *tt.MaxPerOrder:
+		return fmt.Errorf("at most %d %s tickets can be bought per order: %w", *tt.MaxPerOrder, tt.Name, ErrPurchaseLimit)
+	}
+	return nil
+}
+
+// queryRower is satisfied by both *sql.DB and *sql.Tx.
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Tx.
+type queryer interface {
+	queryRower
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func insertTicketType(ctx context.Context, q queryRower, tt *TicketType) error {
+	query := `
+		INSERT INTO ticket_types
+			(event_id, name, price, currency, total_qty, sold_qty, sales_start, sales_end, sales_paused,
+			 min_per_order, max_per_order, max_per_buyer)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		RETURNING id, created_at, updated_at
+	`
+
+	err := q.QueryRowContext(ctx, query,
+		tt.EventID,
+		tt.Name,
+		tt.Price,
+		tt.Currency,
+		tt.TotalQty,
+		tt.SoldQty,
+		tt.SalesStart,
+		tt.SalesEnd,
+		tt.SalesPaused,
+		tt.MinPerOrder,
+		tt.MaxPerOrder,
+		tt.MaxPerBuyer,
+	).Scan(&tt.ID, &tt.CreatedAt, &tt.UpdatedAt)
+	if err != nil {
+		if pgErr, ok := err.(*pq.Error); ok && pgErr.Code == "23505" {
+			return ErrDuplicateTicketType
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Insert adds a ticket type to an existing event. It fails with
+// ErrOverCapacity if the event's tickets would no longer fit its venue.
+func (m TicketTypeModel) Insert(ctx context.Context, tt *TicketType) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	committed := false
+	defer func() {
+		if !committed {
+			_ = tx.Rollback()
+		}
+	}()
+
+	err = insertTicketType(ctx, tx, tt)
+	if err != nil {
+		return err
+	}
+
+	err = checkVenueCapacity(ctx, tx, tt.EventID)
+	if err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	committed = true
+	return nil
+}
+
+func (m TicketTypeModel) Get(ctx context.Context, id int64) (*TicketType, error) {
+	query := `SELECT ` + ticketTypeColumns + ` FROM ticket_types WHERE id = $1`
+
+	var tt TicketType
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(ticketTypeFields(&tt)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &tt, nil
+}
+
+// ListForEvent returns an event's ticket types in the order they were added.
+func (m TicketTypeModel) ListForEvent(ctx context.Context, eventID int64) ([]*TicketType, error) {
+	query := `SELECT ` + ticketTypeColumns + ` FROM ticket_types WHERE event_id = $1 ORDER BY created_at, id`
+
+	rows, err := m.DB.QueryContext(ctx, query, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ticketTypes := []*TicketType{}
+	for rows.Next() {
+		var tt TicketType
+		if err := rows.Scan(ticketTypeFields(&tt)...); err != nil {
+			return nil, err
+		}
+		ticketTypes = append(ticketTypes, &tt)
+	}
+
+	return ticketTypes, rows.Err()
+}
+
+// Update saves a ticket type's settings. The new total_qty is checked against
+// the sold and held quantity under the row lock, so it can never drop below
+// what buyers already have, and against the capacity of the event's venue.
+func (m TicketTypeModel) Update(ctx context.Context, tt *TicketType) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	committed := false
+	defer func() {
+		if !committed {
+			_ = tx.Rollback()
+		}
+	}()
+
+	query := `
+		UPDATE ticket_types
+		SET name = $2, price = $3, currency = $4, total_qty = $5,
+		    sales_start = $6, sales_end = $7, sales_paused = $8,
+		    min_per_order = $9, max_per_order = $10, max_per_buyer = $11, updated_at = now()
+		WHERE id = $1 AND $5 >= sold_qty + reserved_qty
+		RETURNING sold_qty, reserved_qty, updated_at
+	`
+
+	err = tx.QueryRowContext(ctx, query,
+		tt.ID,
+		tt.Name,
+		tt.Price,
+		tt.Currency,
+		tt.TotalQty,
+		tt.SalesStart,
+		tt.SalesEnd,
+		tt.SalesPaused,
+		tt.MinPerOrder,
+		tt.MaxPerOrder,
+		tt.MaxPerBuyer,
+	).Scan(&tt.SoldQty, &tt.ReservedQty, &tt.UpdatedAt)
+	if err != nil {
+		if pgErr, ok := err.(*pq.Error); ok && pgErr.Code == "23505" {
+			return ErrDuplicateTicketType
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		// Either the type is gone or the quantity was too low
+		current, err := m.Get(ctx, tt.ID)
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("total_qty %d is below the %d tickets sold or held: %w",
+			tt.TotalQty, current.SoldQty+current.ReservedQty, ErrTotalBelowSold)
+	}
+
+	err = checkVenueCapacity(ctx, tx, tt.EventID)
+	if err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	committed = true
+	return nil
+}
+
+// Delete removes a ticket type nobody has bought or held. Types with sales
+// should be paused instead so their tickets and orders are kept.
+func (m TicketTypeModel) Delete(ctx context.Context, id int64) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	committed := false
+	defer func() {
+		if !committed {
+			_ = tx.Rollback()
+		}
+	}()
+
+	// Lock the type first so a purchase cannot slip in between the check and
+	// the delete
+	var lockedID int64
+	err = tx.QueryRowContext(ctx, `SELECT id FROM ticket_types WHERE id = $1 FOR UPDATE`, id).Scan(&lockedID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	var hasSales bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM tickets WHERE ticket_type_id = $1)
+		    OR EXISTS (SELECT 1 FROM order_items WHERE ticket_type_id = $1)
+	`, id).Scan(&hasSales)
+	if err != nil {
+		return err
+	}
+
+	if hasSales {
+		return ErrTicketTypeHasSales
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM ticket_types WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	committed = true
+	return nil
+}
@@ -0,0 +1,277 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/AbrahamMayowa/ticketmania/internal/validator"
+	"github.com/lib/pq"
+)
+
+// Venue is a place events are held at. Any organizer can host events at a
+// venue; only the user who added it can change it. The ticket types of an
+// event at a venue can hold at most Capacity tickets between them.
+type Venue struct {
+	ID      int64  `json:"id"`
+	UserID  int64  `json:"user_id"`
+	Name    string `json:"name"`
+	Address string `json:"address"`
+
+	// Coordinates in decimal degrees, either both set or neither.
+	Latitude  *float64 `json:"latitude"`
+	Longitude *float64 `json:"longitude"`
+
+	// Timezone is the IANA name of the venue's timezone, used by default
+	// for its events.
+	Timezone string `json:"timezone"`
+	Capacity int    `json:"capacity"`
+
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type VenueModel struct {
+	DB *sql.DB
+}
+
+// venueColumns lists the columns read by venueFields, in order.
+const venueColumns = `id, user_id, name, address, latitude, longitude, timezone, capacity, version, created_at, updated_at`
+
+func venueFields(v *Venue) []interface{} {
+	return []interface{}{
+		&v.ID,
+		&v.UserID,
+		&v.Name,
+		&v.Address,
+		&v.Latitude,
+		&v.Longitude,
+		&v.Timezone,
+		&v.Capacity,
+		&v.Version,
+		&v.CreatedAt,
+		&v.UpdatedAt,
+	}
+}
+
+func ValidateVenue(v *validator.Validator, venue *Venue) {
+	v.Check(venue.Name != "", "name", "must be provided")
+	v.Check(len(venue.Name) <= 255, "name", "must not be more than 255 bytes")
+	v.Check(len(venue.Address) <= 500, "address", "must not be more than 500 bytes")
+	v.Check(validTimezone(venue.Timezone), "timezone", "must be an IANA timezone, such as Africa/Lagos")
+	v.Check(venue.Capacity > 0, "capacity", "must be greater than zero")
+	v.Check(venue.Capacity <= 10_000_000, "capacity", "must not be more than 10000000")
+	validateCoordinates(v, venue.Latitude, venue.Longitude)
+}
+
+func (m VenueModel) Insert(ctx context.Context, venue *Venue) error {
+	query := `
+		INSERT INTO venues (user_id, name, address, latitude, longitude, timezone, capacity)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, version, created_at, updated_at
+	`
+
+	return m.DB.QueryRowContext(ctx, query,
+		venue.UserID,
+		venue.Name,
+		venue.Address,
+		venue.Latitude,
+		venue.Longitude,
+		venue.Timezone,
+		venue.Capacity,
+	).Scan(&venue.ID, &venue.Version, &venue.CreatedAt, &venue.UpdatedAt)
+}
+
+func (m VenueModel) Get(ctx context.Context, id int64) (*Venue, error) {
+	query := `SELECT ` + venueColumns + ` FROM venues WHERE id = $1`
+
+	var venue Venue
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(venueFields(&venue)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &venue, nil
+}
+
+// List returns a page of venues by name, only those whose name or address
+// contains query when it is set.
+func (m VenueModel) List(ctx context.Context, query string, page, perPage int) ([]*Venue, PaginationMeta, error) {
+	where := `($1 = '' OR name ILIKE '%' || $1 || '%' OR address ILIKE '%' || $1 || '%')`
+	pattern := escapeLike(query)
+
+	var total int
+	err := m.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM venues WHERE `+where, pattern).Scan(&total)
+	if err != nil {
+		return nil, PaginationMeta{}, err
+	}
+
+	rows, err := m.DB.QueryContext(ctx, `
+		SELECT `+venueColumns+` FROM venues
+		WHERE `+where+`
+		ORDER BY lower(name), id
+		LIMIT $2 OFFSET $3
+	`, pattern, perPage, (page-1)*perPage)
+	if err != nil {
+		return nil, PaginationMeta{}, err
+	}
+	defer rows.Close()
+
+	venues := []*Venue{}
+	for rows.Next() {
+		var venue Venue
+		if err := rows.Scan(venueFields(&venue)...); err != nil {
+			return nil, PaginationMeta{}, err
+		}
+		venues = append(venues, &venue)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, PaginationMeta{}, err
+	}
+
+	totalPages := int(math.Ceil(float64(total) / float64(perPage)))
+	meta := PaginationMeta{
+		CurrentPage: page,
+		PerPage:     perPage,
+		Total:       &total,
+		TotalPages:  &totalPages,
+	}
+
+	return venues, meta, nil
+}
+
+// Update saves a venue's details. It fails with ErrEditConflict if the venue
+// changed since it was read, and with ErrOverCapacity if an upcoming event at
+// the venue has more tickets than the new capacity.
+func (m VenueModel) Update(ctx context.Context, venue *Venue) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	committed := false
+	defer func() {
+		if !committed {
+			_ = tx.Rollback()
+		}
+	}()
+
+	err = tx.QueryRowContext(ctx, `
+		UPDATE venues
+		SET name = $3, address = $4, latitude = $5, longitude = $6, timezone = $7, capacity = $8,
+		    version = version + 1, updated_at = now()
+		WHERE id = $1 AND version = $2
+		RETURNING version, updated_at
+	`,
+		venue.ID,
+		venue.Version,
+		venue.Name,
+		venue.Address,
+		venue.Latitude,
+		venue.Longitude,
+		venue.Timezone,
+		venue.Capacity,
+	).Scan(&venue.Version, &venue.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	// The venue row stays locked until commit, so no event can add tickets
+	// while they are being counted
+	var title string
+	var tickets int
+	err = tx.QueryRowContext(ctx, `
+		SELECT e.title, SUM(tt.total_qty)
+		FROM events e
+		JOIN ticket_types tt ON tt.event_id = e.id
+		WHERE e.venue_id = $1 AND e.status IN ('draft', 'published')
+		GROUP BY e.id
+		HAVING SUM(tt.total_qty) > $2
+		ORDER BY e.starts_at
+		LIMIT 1
+	`, venue.ID, venue.Capacity).Scan(&title, &tickets)
+	switch {
+	case err == nil:
+		return fmt.Errorf("%q has %d tickets, more than a capacity of %d: %w", title, tickets, venue.Capacity, ErrOverCapacity)
+	case !errors.Is(err, sql.ErrNoRows):
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	committed = true
+
+	return nil
+}
+
+// Delete removes a venue no event is held at.
+func (m VenueModel) Delete(ctx context.Context, id int64) error {
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM venues WHERE id = $1`, id)
+	if err != nil {
+		if pgErr, ok := err.(*pq.Error); ok && pgErr.Code == "23503" {
+			return ErrVenueInUse
+		}
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// checkVenueCapacity fails with ErrOverCapacity if the ticket types of an
+// event held at a venue add up to more tickets than the venue holds. It locks
+// the venue until tx ends so concurrent changes are checked one at a time.
+func checkVenueCapacity(ctx context.Context, tx *sql.Tx, eventID int64) error {
+	var capacity int
+	err := tx.QueryRowContext(ctx, `
+		SELECT v.capacity
+		FROM events e
+		JOIN venues v ON v.id = e.venue_id
+		WHERE e.id = $1
+		FOR UPDATE OF v
+	`, eventID).Scan(&capacity)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil // not held at a venue
+		default:
+			return err
+		}
+	}
+
+	var tickets int
+	err = tx.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(total_qty), 0) FROM ticket_types WHERE event_id = $1
+	`, eventID).Scan(&tickets)
+	if err != nil {
+		return err
+	}
+
+	if tickets > capacity {
+		return fmt.Errorf("ticket types add up to %d tickets, more than the venue's capacity of %d: %w", tickets, capacity, ErrOverCapacity)
+	}
+
+	return nil
+}
@@ -0,0 +1,414 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/AbrahamMayowa/ticketmania/internal/validator"
+	"github.com/lib/pq"
+)
+
+type WaitlistStatus string
+
+const (
+	WaitlistWaiting   WaitlistStatus = "waiting"
+	WaitlistOffered   WaitlistStatus = "offered"
+	WaitlistPurchased WaitlistStatus = "purchased"
+	WaitlistExpired   WaitlistStatus = "expired"
+	WaitlistCancelled WaitlistStatus = "cancelled"
+)
+
+// WaitlistEntry is a buyer's place in line for a sold out ticket type. When
+// tickets free up the entry is offered a reservation holding Quantity
+// tickets, which the buyer pays for like any other reservation.
+type WaitlistEntry struct {
+	ID           int64  `json:"id"`
+	EventID      int64  `json:"event_id"`
+	TicketTypeID int64  `json:"ticket_type_id"`
+	UserID       *int64 `json:"user_id,omitempty"`
+
+	Email    string `json:"email"`
+	Phone    string `json:"phone"`
+	Quantity int    `json:"quantity"`
+
+	Status WaitlistStatus `json:"status"`
+
+	// Position counts the waiting entries up to and including this one. It
+	// is only filled in when the entry is created.
+	Position int `json:"position,omitempty"`
+
+	ReservationID  *int64     `json:"reservation_id,omitempty"`
+	OfferedAt      *time.Time `json:"offered_at,omitempty"`
+	OfferExpiresAt *time.Time `json:"offer_expires_at,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// WaitlistOffer is a hold made for a waitlist entry, with what the buyer
+// needs to be told about it.
+type WaitlistOffer struct {
+	Entry      *WaitlistEntry
+	EventTitle string
+	TicketType *TicketType
+	Order      *Order
+
+	// ReservationSecret is needed to pay for offers to buyers who joined
+	// without signing in.
+	ReservationSecret string
+}
+
+type WaitlistModel struct {
+	DB *sql.DB
+}
+
+// waitlistColumns lists the columns read by waitlistFields, in order.
+const waitlistColumns = `id, event_id, ticket_type_id, user_id, email, phone, quantity, status,
+	reservation_id, offered_at, offer_expires_at, created_at, updated_at`
+
+func waitlistFields(w *WaitlistEntry) []interface{} {
+	return []interface{}{
+		&w.ID,
+		&w.EventID,
+		&w.TicketTypeID,
+		&w.UserID,
+		&w.Email,
+		&w.Phone,
+		&w.Quantity,
+		&w.Status,
+		&w.ReservationID,
+		&w.OfferedAt,
+		&w.OfferExpiresAt,
+		&w.CreatedAt,
+		&w.UpdatedAt,
+	}
+}
+
+func ValidateWaitlistEntry(v *validator.Validator, w *WaitlistEntry) {
+	v.Check(w.Email != "", "buyer_email", "must be provided")
+	v.Check(validator.Matches(w.Email, validator.EmailRegex), "buyer_email", "must be a valid email address")
+	v.Check(w.Phone != "", "buyer_phone", "must be provided")
+	v.Check(w.Quantity > 0, "quantity", "must be greater than zero")
+}
+
+// Join puts a buyer in line for a ticket type. Buyers can only join while the
+// type is on sale but cannot cover the quantity they want; otherwise they
+// should simply buy.
+func (m WaitlistModel) Join(ctx context.Context, w *WaitlistEntry) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	committed := false
+	defer func() {
+		if !committed {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var eventStatus EventStatus
+	err = tx.QueryRowContext(ctx, `
+		SELECT e.status
+		FROM events e
+		JOIN ticket_types tt ON tt.event_id = e.id
+		WHERE tt.id = $1
+		FOR SHARE OF e
+	`, w.TicketTypeID).Scan(&eventStatus)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+
+	if eventStatus != EventPublished {
+		return ErrEventNotOnSale
+	}
+
+	var tt TicketType
+	err = tx.QueryRowContext(ctx, `SELECT `+ticketTypeColumns+` FROM ticket_types WHERE id = $1 FOR SHARE`,
+		w.TicketTypeID).Scan(ticketTypeFields(&tt)...)
+	if err != nil {
+		return err
+	}
+
+	if err = tt.CheckOnSale(time.Now()); err != nil {
+		return err
+	}
+
+	if err = tt.CheckOrderQuantity(w.Quantity); err != nil {
+		return err
+	}
+
+	// Offers are made without picking seats, so seated types have no waitlist
+	seated, err := ticketTypeHasSeats(ctx, tx, tt.ID)
+	if err != nil {
+		return err
+	}
+	if seated {
+		return fmt.Errorf("%s has reserved seating and no waitlist: %w", tt.Name, ErrTicketTypeNotOnSale)
+	}
+
+	waiting, err := waitlistedQty(ctx, tx, tt.ID)
+	if err != nil {
+		return err
+	}
+
+	if available := tt.Available() - waiting; available >= w.Quantity {
+		return fmt.Errorf("%d %s tickets are still available: %w", available, tt.Name, ErrTicketsStillAvailable)
+	}
+
+	w.EventID = tt.EventID
+	w.Status = WaitlistWaiting
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO waitlist_entries (event_id, ticket_type_id, user_id, email, phone, quantity, status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at, updated_at
+	`, w.EventID, w.TicketTypeID, w.UserID, w.Email, w.Phone, w.Quantity, w.Status).Scan(&w.ID, &w.CreatedAt, &w.UpdatedAt)
+	if err != nil {
+		if pgErr, ok := err.(*pq.Error); ok && pgErr.Code == "23505" {
+			return ErrAlreadyWaitlisted
+		}
+		return err
+	}
+
+	err = tx.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM waitlist_entries
+		WHERE ticket_type_id = $1 AND status = 'waiting' AND id <= $2
+	`, w.TicketTypeID, w.ID).Scan(&w.Position)
+	if err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	committed = true
+	return nil
+}
+
+// OfferableTicketTypes returns up to limit ticket types that have buyers
+// waiting and tickets free to offer them.
+func (m WaitlistModel) OfferableTicketTypes(ctx context.Context, limit int) ([]int64, error) {
+	query := `
+		SELECT tt.id
+		FROM ticket_types tt
+		JOIN events e ON e.id = tt.event_id
+		WHERE e.status = 'published'
+		  AND NOT tt.sales_paused
+		  AND tt.total_qty - tt.sold_qty - tt.reserved_qty > 0
+		  AND EXISTS (SELECT 1 FROM waitlist_entries w WHERE w.ticket_type_id = tt.id AND w.status = 'waiting')
+		ORDER BY tt.id
+		LIMIT $1
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// Offer hands the free tickets of a ticket type to the buyers waiting for it,
+// first come first served. Each buyer gets a reservation held for holdFor.
+// Offers stop at the first buyer whose quantity does not fit, so nobody is
+// overtaken by a later, smaller request.
+func (m WaitlistModel) Offer(ctx context.Context, ticketTypeID int64, holdFor time.Duration) ([]*WaitlistOffer, error) {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	committed := false
+	defer func() {
+		if !committed {
+			_ = tx.Rollback()
+		}
+	}()
+
+	// Same lock order as InsertTickets: event, then ticket type
+	var (
+		eventStatus EventStatus
+		eventTitle  string
+		pricing     Pricing
+	)
+	err = tx.QueryRowContext(ctx, `
+		SELECT e.status, e.title, e.service_fee_flat, e.service_fee_bps, e.fees_absorbed, e.tax_rate_bps
+		FROM events e
+		JOIN ticket_types tt ON tt.event_id = e.id
+		WHERE tt.id = $1
+		FOR SHARE OF e
+	`, ticketTypeID).Scan(&eventStatus, &eventTitle,
+		&pricing.ServiceFeeFlat, &pricing.ServiceFeeBps, &pricing.FeesAbsorbed, &pricing.TaxRateBps)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if eventStatus != EventPublished {
+		return nil, nil
+	}
+
+	var tt TicketType
+	err = tx.QueryRowContext(ctx, `SELECT `+ticketTypeColumns+` FROM ticket_types WHERE id = $1 FOR UPDATE`,
+		ticketTypeID).Scan(ticketTypeFields(&tt)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Buyers keep their place while sales are paused or closed
+	if tt.CheckOnSale(time.Now()) != nil {
+		return nil, nil
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT `+waitlistColumns+`
+		FROM waitlist_entries
+		WHERE ticket_type_id = $1 AND status = 'waiting'
+		ORDER BY id
+		FOR UPDATE
+	`, ticketTypeID)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []*WaitlistEntry{}
+	for rows.Next() {
+		var w WaitlistEntry
+		if err := rows.Scan(waitlistFields(&w)...); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		entries = append(entries, &w)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	offers := []*WaitlistOffer{}
+	available := tt.Available()
+	for _, w := range entries {
+		if w.Quantity > available {
+			break
+		}
+
+		// The buyer may have bought tickets elsewhere since joining
+		if tt.MaxPerBuyer != nil {
+			err = checkBuyerLimit(ctx, tx, &tt, w.Quantity, w.UserID, []string{strings.ToLower(w.Email)})
+			if errors.Is(err, ErrPurchaseLimit) {
+				err = setWaitlistStatus(ctx, tx, w, WaitlistCancelled)
+				if err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		purchase := &TicketPurchaseRequest{
+			EventID: &w.EventID,
+			UserID:  w.UserID,
+			Items: []*TicketPurchaseItem{{
+				TicketTypeID: &w.TicketTypeID,
+				Quantity:     w.Quantity,
+				BuyerEmail:   w.Email,
+				BuyerPhone:   w.Phone,
+			}},
+			HoldFor: holdFor,
+		}
+
+		result, err := holdTickets(ctx, tx, purchase, &checkout{
+			pricing:       pricing,
+			ticketTypeIDs: []int64{tt.ID},
+			ticketTypes:   map[int64]*TicketType{tt.ID: &tt},
+			quantities:    map[int64]int{tt.ID: w.Quantity},
+			currency:      tt.Currency,
+			locked:        true,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		err = tx.QueryRowContext(ctx, `
+			UPDATE waitlist_entries
+			SET status = 'offered', reservation_id = $2, offered_at = now(), offer_expires_at = $3, updated_at = now()
+			WHERE id = $1
+			RETURNING status, offered_at, offer_expires_at, updated_at
+		`, w.ID, result.Reservation.ID, result.Reservation.ExpiresAt).Scan(&w.Status, &w.OfferedAt, &w.OfferExpiresAt, &w.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		w.ReservationID = &result.Reservation.ID
+
+		offers = append(offers, &WaitlistOffer{
+			Entry:             w,
+			EventTitle:        eventTitle,
+			TicketType:        &tt,
+			Order:             result.Order,
+			ReservationSecret: result.Reservation.Secret,
+		})
+		available -= w.Quantity
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	committed = true
+
+	return offers, nil
+}
+
+// waitlistedQty returns how many tickets the buyers waiting for a ticket type
+// want between them. Buyers already offered tickets are not counted, as their
+// reservations hold them.
+func waitlistedQty(ctx context.Context, q queryRower, ticketTypeID int64) (int, error) {
+	var qty int
+	err := q.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(quantity), 0) FROM waitlist_entries WHERE ticket_type_id = $1 AND status = 'waiting'
+	`, ticketTypeID).Scan(&qty)
+	return qty, err
+}
+
+func setWaitlistStatus(ctx context.Context, tx *sql.Tx, w *WaitlistEntry, status WaitlistStatus) error {
+	err := tx.QueryRowContext(ctx, `
+		UPDATE waitlist_entries SET status = $2, updated_at = now() WHERE id = $1 RETURNING updated_at
+	`, w.ID, status).Scan(&w.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	w.Status = status
+	return nil
+}
+
+// settleWaitlistOffers moves the entries offered the given reservations to
+// status once the reservations are paid for or released.
+func settleWaitlistOffers(ctx context.Context, tx *sql.Tx, reservationIDs []int64, status WaitlistStatus) error {
+	_, err := tx.ExecContext(ctx, `
+		UPDATE waitlist_entries
+		SET status = $2, updated_at = now()
+		WHERE reservation_id = ANY($1) AND status = 'offered'
+	`, pq.Array(reservationIDs), status)
+	return err
+}
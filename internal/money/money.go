@@ -0,0 +1,182 @@
+// Package money knows the ISO 4217 currencies tickets can be sold in and
+// turns amounts, always kept as integers in the currency's smallest unit,
+// into text for people.
+package money
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Currency is an ISO 4217 currency. MinorUnits is the number of decimal
+// places between the smallest unit and the main unit, 2 for cents.
+type Currency struct {
+	Code       string `json:"code"`
+	MinorUnits int    `json:"minor_units"`
+	Symbol     string `json:"symbol"`
+}
+
+// currencies is the registry of supported currencies, keyed by code.
+var currencies = map[string]Currency{}
+
+func init() {
+	for _, c := range []Currency{
+		{"AED", 2, "د.إ"},
+		{"ARS", 2, "$"},
+		{"AUD", 2, "A$"},
+		{"BDT", 2, "৳"},
+		{"BHD", 3, "BD"},
+		{"BRL", 2, "R$"},
+		{"BWP", 2, "P"},
+		{"CAD", 2, "CA$"},
+		{"CHF", 2, "CHF"},
+		{"CLP", 0, "$"},
+		{"CNY", 2, "¥"},
+		{"COP", 2, "$"},
+		{"CZK", 2, "Kč"},
+		{"DKK", 2, "kr"},
+		{"DZD", 2, "DA"},
+		{"EGP", 2, "E£"},
+		{"ETB", 2, "Br"},
+		{"EUR", 2, "€"},
+		{"GBP", 2, "£"},
+		{"GHS", 2, "GH₵"},
+		{"GMD", 2, "D"},
+		{"HKD", 2, "HK$"},
+		{"HUF", 2, "Ft"},
+		{"IDR", 2, "Rp"},
+		{"ILS", 2, "₪"},
+		{"INR", 2, "₹"},
+		{"ISK", 0, "kr"},
+		{"JOD", 3, "JD"},
+		{"JPY", 0, "¥"},
+		{"KES", 2, "KSh"},
+		{"KRW", 0, "₩"},
+		{"KWD", 3, "KD"},
+		{"LRD", 2, "L$"},
+		{"MAD", 2, "DH"},
+		{"MUR", 2, "₨"},
+		{"MWK", 2, "MK"},
+		{"MXN", 2, "MX$"},
+		{"MYR", 2, "RM"},
+		{"MZN", 2, "MT"},
+		{"NAD", 2, "N$"},
+		{"NGN", 2, "₦"},
+		{"NOK", 2, "kr"},
+		{"NZD", 2, "NZ$"},
+		{"OMR", 3, "RO"},
+		{"PHP", 2, "₱"},
+		{"PKR", 2, "₨"},
+		{"PLN", 2, "zł"},
+		{"QAR", 2, "QR"},
+		{"RWF", 0, "FRw"},
+		{"SAR", 2, "SR"},
+		{"SEK", 2, "kr"},
+		{"SGD", 2, "S$"},
+		{"SLE", 2, "Le"},
+		{"THB", 2, "฿"},
+		{"TND", 3, "DT"},
+		{"TRY", 2, "₺"},
+		{"TWD", 2, "NT$"},
+		{"TZS", 2, "TSh"},
+		{"UAH", 2, "₴"},
+		{"UGX", 0, "USh"},
+		{"USD", 2, "$"},
+		{"VND", 0, "₫"},
+		{"XAF", 0, "FCFA"},
+		{"XOF", 0, "CFA"},
+		{"ZAR", 2, "R"},
+		{"ZMW", 2, "ZK"},
+	} {
+		currencies[c.Code] = c
+	}
+}
+
+// Lookup returns the registered currency for an ISO 4217 code. Codes are
+// matched without regard to case.
+func Lookup(code string) (Currency, bool) {
+	c, ok := currencies[strings.ToUpper(code)]
+	return c, ok
+}
+
+// Valid reports whether code is a supported currency. Only the upper case
+// form is accepted, as that is how codes are stored.
+func Valid(code string) bool {
+	_, ok := currencies[code]
+	return ok
+}
+
+// Currencies returns every supported currency, sorted by code.
+func Currencies() []Currency {
+	list := make([]Currency, 0, len(currencies))
+	for _, c := range currencies {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Code < list[j].Code })
+	return list
+}
+
+// Money is an amount in the smallest unit of a currency, for showing to
+// people. Stored amounts stay int64 next to their currency code.
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+func New(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// String formats m for people, e.g. "₦25,000.00", "¥1,500" or "CHF 12.50".
+func (m Money) String() string {
+	return Format(m.Amount, m.Currency)
+}
+
+// Format renders an amount in the currency's smallest unit with its symbol,
+// thousands separators and the currency's number of decimal places.
+// Unknown currencies are shown with their code and two decimal places.
+func Format(amount int64, code string) string {
+	c, ok := Lookup(code)
+	if !ok {
+		c = Currency{Code: code, MinorUnits: 2, Symbol: code}
+	}
+
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+
+	scale := int64(1)
+	for i := 0; i < c.MinorUnits; i++ {
+		scale *= 10
+	}
+
+	number := group(amount / scale)
+	if c.MinorUnits > 0 {
+		number += fmt.Sprintf(".%0*d", c.MinorUnits, amount%scale)
+	}
+
+	// Symbols made of letters, like CHF or KSh, read better with a space
+	symbol := c.Symbol
+	if r := []rune(symbol); len(r) > 1 && unicode.IsLetter(r[len(r)-1]) {
+		symbol += " "
+	}
+
+	return sign + symbol + number
+}
+
+// group inserts a comma between every three digits of n.
+func group(n int64) string {
+	digits := fmt.Sprintf("%d", n)
+	var b strings.Builder
+	for i, d := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(d)
+	}
+	return b.String()
+}
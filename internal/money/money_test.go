@@ -0,0 +1,77 @@
+package money
+
+import "testing"
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		amount int64
+		code   string
+		want   string
+	}{
+		{"two minor units", 2_500_000, "NGN", "₦25,000.00"},
+		{"cents padded", 1_205, "USD", "$12.05"},
+		{"below one main unit", 7, "EUR", "€0.07"},
+		{"zero", 0, "GBP", "£0.00"},
+		{"no minor units", 1_500, "JPY", "¥1,500"},
+		{"no minor units millions", 12_345_678, "KRW", "₩12,345,678"},
+		{"three minor units", 12_345, "KWD", "KD 12.345"},
+		{"three minor units padded", 1_005, "BHD", "BD 1.005"},
+		{"letter symbol gets a space", 1_250, "CHF", "CHF 12.50"},
+		{"symbol ending in a sign has no space", 1_000, "GHS", "GH₵10.00"},
+		{"lower case code", 1_000, "usd", "$10.00"},
+		{"negative", -123_456, "USD", "-$1,234.56"},
+		{"unknown code", 1_250, "XYZ", "XYZ 12.50"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Format(tt.amount, tt.code); got != tt.want {
+				t.Errorf("Format(%d, %q) = %q, want %q", tt.amount, tt.code, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		code       string
+		ok         bool
+		valid      bool
+		minorUnits int
+	}{
+		{"USD", true, true, 2},
+		{"usd", true, false, 2},
+		{"JPY", true, true, 0},
+		{"KWD", true, true, 3},
+		{"XYZ", false, false, 0},
+		{"", false, false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			c, ok := Lookup(tt.code)
+			if ok != tt.ok {
+				t.Fatalf("Lookup(%q) ok = %v, want %v", tt.code, ok, tt.ok)
+			}
+			if ok && c.MinorUnits != tt.minorUnits {
+				t.Errorf("Lookup(%q).MinorUnits = %d, want %d", tt.code, c.MinorUnits, tt.minorUnits)
+			}
+			if got := Valid(tt.code); got != tt.valid {
+				t.Errorf("Valid(%q) = %v, want %v", tt.code, got, tt.valid)
+			}
+		})
+	}
+}
+
+func TestCurrenciesSorted(t *testing.T) {
+	list := Currencies()
+	if len(list) != len(currencies) {
+		t.Fatalf("Currencies() returned %d currencies, want %d", len(list), len(currencies))
+	}
+	for i := 1; i < len(list); i++ {
+		if list[i-1].Code >= list[i].Code {
+			t.Fatalf("Currencies() not sorted: %q before %q", list[i-1].Code, list[i].Code)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// FakeSignatureHeader carries the hex HMAC-SHA256 of a fake webhook body.
+const FakeSignatureHeader = "Fake-Signature"
+
+// FakeProvider is an in-process provider for development and tests. It never
+// moves money, hands out sequential ids and signs webhooks with a shared secret.
+type FakeProvider struct {
+	secret []byte
+
+	mu       sync.Mutex
+	seq      int
+	intents  map[string]*Intent
+	refunded map[string]int64
+}
+
+func NewFakeProvider(webhookSecret string) *FakeProvider {
+	return &FakeProvider{
+		secret:   []byte(webhookSecret),
+		intents:  make(map[string]*Intent),
+		refunded: make(map[string]int64),
+	}
+}
+
+func (p *FakeProvider) Name() string {
+	return "fake"
+}
+
+func (p *FakeProvider) CreateIntent(ctx context.Context, amount int64, currency, reference string) (*Intent, error) {
+	if amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.seq++
+	id := fmt.Sprintf("fake_pi_%06d", p.seq)
+	intent := &Intent{
+		ID:           id,
+		Amount:       amount,
+		Currency:     currency,
+		Reference:    reference,
+		Status:       IntentRequiresPayment,
+		ClientSecret: id + "_secret",
+	}
+	p.intents[id] = intent
+
+	copied := *intent
+	return &copied, nil
+}
+
+func (p *FakeProvider) Capture(ctx context.Context, intentID string) (*Intent, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	intent, ok := p.intents[intentID]
+	if !ok {
+		return nil, ErrIntentNotFound
+	}
+
+	switch intent.Status {
+	case IntentSucceeded:
+		// capturing twice is a no-op
+	case IntentFailed:
+		return nil, fmt.Errorf("cannot capture failed intent %s", intentID)
+	default:
+		intent.Status = IntentSucceeded
+	}
+
+	copied := *intent
+	return &copied, nil
+}
+
+func (p *FakeProvider) Refund(ctx context.Context, intentID string, amount int64) (*Refund, error) {
+	if amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	intent, ok := p.intents[intentID]
+	if !ok {
+		return nil, ErrIntentNotFound
+	}
+
+	if intent.Status != IntentSucceeded {
+		return nil, fmt.Errorf("cannot refund intent %s with status %s", intentID, intent.Status)
+	}
+
+	if p.refunded[intentID]+amount > intent.Amount {
+		return nil, ErrRefundTooLarge
+	}
+	p.refunded[intentID] += amount
+
+	p.seq++
+	return &Refund{
+		ID:       fmt.Sprintf("fake_re_%06d", p.seq),
+		IntentID: intentID,
+		Amount:   amount,
+		Currency: intent.Currency,
+	}, nil
+}
+
+func (p *FakeProvider) VerifyWebhook(payload []byte, header http.Header) (*WebhookEvent, error) {
+	signature, err := hex.DecodeString(header.Get(FakeSignatureHeader))
+	if err != nil || !hmac.Equal(signature, p.sign(payload)) {
+		return nil, ErrInvalidSignature
+	}
+
+	var event WebhookEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("invalid webhook payload: %w", err)
+	}
+
+	// Keep the in-memory intent in step with what the webhook reports
+	p.mu.Lock()
+	if intent, ok := p.intents[event.IntentID]; ok {
+		switch event.Type {
+		case EventPaymentAuthorized:
+			intent.Status = IntentAuthorized
+		case EventPaymentSucceeded:
+			intent.Status = IntentSucceeded
+		case EventPaymentFailed:
+			intent.Status = IntentFailed
+		}
+	}
+	p.mu.Unlock()
+
+	return &event, nil
+}
+
+// Sign returns the signature header value for payload, so developers and
+// tests can simulate webhooks.
+func (p *FakeProvider) Sign(payload []byte) string {
+	return hex.EncodeToString(p.sign(payload))
+}
+
+func (p *FakeProvider) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, p.secret)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
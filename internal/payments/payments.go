@@ -0,0 +1,71 @@
+// Package payments defines the interface the API uses to collect money from
+// buyers, so the concrete payment gateway can be swapped through configuration.
+package payments
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+var (
+	ErrIntentNotFound   = errors.New("payment intent not found")
+	ErrInvalidAmount    = errors.New("payment amount must be greater than zero")
+	ErrInvalidSignature = errors.New("webhook signature is invalid")
+	ErrRefundTooLarge   = errors.New("refund exceeds the captured amount")
+)
+
+type IntentStatus string
+
+const (
+	IntentRequiresPayment IntentStatus = "requires_payment"
+	IntentAuthorized      IntentStatus = "authorized"
+	IntentSucceeded       IntentStatus = "succeeded"
+	IntentFailed          IntentStatus = "failed"
+)
+
+// Intent is a request to collect Amount (in the currency's smallest unit) from
+// the buyer. ClientSecret is handed to the client to complete the payment.
+type Intent struct {
+	ID           string       `json:"id"`
+	Amount       int64        `json:"amount"`
+	Currency     string       `json:"currency"`
+	Reference    string       `json:"reference"`
+	Status       IntentStatus `json:"status"`
+	ClientSecret string       `json:"client_secret"`
+}
+
+type Refund struct {
+	ID       string `json:"id"`
+	IntentID string `json:"intent_id"`
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+type EventType string
+
+const (
+	// EventPaymentAuthorized means funds are held and must be captured.
+	EventPaymentAuthorized EventType = "payment.authorized"
+	EventPaymentSucceeded  EventType = "payment.succeeded"
+	EventPaymentFailed     EventType = "payment.failed"
+)
+
+// WebhookEvent is a verified notification sent by the provider.
+type WebhookEvent struct {
+	ID       string    `json:"id"`
+	Type     EventType `json:"type"`
+	IntentID string    `json:"intent_id"`
+	Amount   int64     `json:"amount"`
+	Currency string    `json:"currency"`
+}
+
+type Provider interface {
+	// Name identifies the provider in stored payment records.
+	Name() string
+	CreateIntent(ctx context.Context, amount int64, currency, reference string) (*Intent, error)
+	Capture(ctx context.Context, intentID string) (*Intent, error)
+	Refund(ctx context.Context, intentID string, amount int64) (*Refund, error)
+	// VerifyWebhook authenticates a raw webhook body and decodes it.
+	VerifyWebhook(payload []byte, header http.Header) (*WebhookEvent, error)
+}
@@ -0,0 +1,317 @@
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StripeSignatureHeader carries Stripe's timestamped webhook signatures.
+const StripeSignatureHeader = "Stripe-Signature"
+
+const (
+	stripeBaseURL = "https://api.stripe.com"
+
+	// stripeAPIVersion pins the shape of API responses and webhook payloads.
+	stripeAPIVersion = "2024-06-20"
+
+	// stripeWebhookTolerance is how far a webhook's signing time may be from
+	// now before it is refused as a replay.
+	stripeWebhookTolerance = 5 * time.Minute
+)
+
+// StripeProvider collects payments with Stripe PaymentIntents. Buyers
+// complete the payment with the intent's client secret and Stripe.js; the
+// result arrives by webhook.
+type StripeProvider struct {
+	apiKey        string
+	webhookSecret []byte
+	baseURL       string
+	client        *http.Client
+	now           func() time.Time
+}
+
+// NewStripeProvider uses the secret API key apiKey and verifies webhooks
+// with the endpoint's signing secret (whsec_...).
+func NewStripeProvider(apiKey, webhookSecret string) *StripeProvider {
+	return &StripeProvider{
+		apiKey:        apiKey,
+		webhookSecret: []byte(webhookSecret),
+		baseURL:       stripeBaseURL,
+		client:        &http.Client{Timeout: 15 * time.Second},
+		now:           time.Now,
+	}
+}
+
+func (p *StripeProvider) Name() string {
+	return "stripe"
+}
+
+// stripeIntent is the part of a Stripe PaymentIntent the API uses.
+type stripeIntent struct {
+	ID           string            `json:"id"`
+	Amount       int64             `json:"amount"`
+	Currency     string            `json:"currency"`
+	Status       string            `json:"status"`
+	ClientSecret string            `json:"client_secret"`
+	Metadata     map[string]string `json:"metadata"`
+}
+
+func (i *stripeIntent) intent() *Intent {
+	status := IntentRequiresPayment
+	switch i.Status {
+	case "requires_capture":
+		status = IntentAuthorized
+	case "succeeded":
+		status = IntentSucceeded
+	case "canceled":
+		status = IntentFailed
+	}
+
+	return &Intent{
+		ID:           i.ID,
+		Amount:       i.Amount,
+		Currency:     strings.ToUpper(i.Currency),
+		Reference:    i.Metadata["reference"],
+		Status:       status,
+		ClientSecret: i.ClientSecret,
+	}
+}
+
+// stripeError is the error object Stripe returns with failed requests.
+type stripeError struct {
+	Error struct {
+		Type    string `json:"type"`
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (p *StripeProvider) CreateIntent(ctx context.Context, amount int64, currency, reference string) (*Intent, error) {
+	if amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+
+	form := url.Values{}
+	form.Set("amount", strconv.FormatInt(amount, 10))
+	form.Set("currency", strings.ToLower(currency))
+	form.Set("metadata[reference]", reference)
+	form.Set("automatic_payment_methods[enabled]", "true")
+
+	var intent stripeIntent
+	if err := p.do(ctx, http.MethodPost, "/v1/payment_intents", form, &intent); err != nil {
+		return nil, err
+	}
+
+	return intent.intent(), nil
+}
+
+func (p *StripeProvider) Capture(ctx context.Context, intentID string) (*Intent, error) {
+	path := "/v1/payment_intents/" + url.PathEscape(intentID)
+
+	var intent stripeIntent
+	err := p.do(ctx, http.MethodPost, path+"/capture", nil, &intent)
+	if err != nil {
+		// Stripe refuses to capture twice; like the fake provider, treat
+		// capturing an intent that already succeeded as a no-op
+		var stateErr *stripeStateError
+		if !errors.As(err, &stateErr) {
+			return nil, err
+		}
+		if err := p.do(ctx, http.MethodGet, path, nil, &intent); err != nil {
+			return nil, err
+		}
+		if intent.Status != "succeeded" {
+			return nil, fmt.Errorf("cannot capture intent %s with status %s", intentID, intent.Status)
+		}
+	}
+
+	return intent.intent(), nil
+}
+
+func (p *StripeProvider) Refund(ctx context.Context, intentID string, amount int64) (*Refund, error) {
+	if amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+
+	form := url.Values{}
+	form.Set("payment_intent", intentID)
+	form.Set("amount", strconv.FormatInt(amount, 10))
+
+	var refund struct {
+		ID            string `json:"id"`
+		Amount        int64  `json:"amount"`
+		Currency      string `json:"currency"`
+		PaymentIntent string `json:"payment_intent"`
+	}
+	if err := p.do(ctx, http.MethodPost, "/v1/refunds", form, &refund); err != nil {
+		return nil, err
+	}
+
+	return &Refund{
+		ID:       refund.ID,
+		IntentID: refund.PaymentIntent,
+		Amount:   refund.Amount,
+		Currency: strings.ToUpper(refund.Currency),
+	}, nil
+}
+
+// VerifyWebhook checks the Stripe-Signature header, an HMAC-SHA256 of the
+// signing time and body, and decodes PaymentIntent events. Other event types
+// are returned without an intent so they are acknowledged and ignored.
+func (p *StripeProvider) VerifyWebhook(payload []byte, header http.Header) (*WebhookEvent, error) {
+	if err := p.verifySignature(payload, header.Get(StripeSignatureHeader)); err != nil {
+		return nil, err
+	}
+
+	var event struct {
+		ID   string `json:"id"`
+		Type string `json:"type"`
+		Data struct {
+			Object json.RawMessage `json:"object"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("invalid webhook payload: %w", err)
+	}
+
+	var eventType EventType
+	switch event.Type {
+	case "payment_intent.amount_capturable_updated":
+		eventType = EventPaymentAuthorized
+	case "payment_intent.succeeded":
+		eventType = EventPaymentSucceeded
+	case "payment_intent.payment_failed":
+		eventType = EventPaymentFailed
+	default:
+		return &WebhookEvent{ID: event.ID, Type: EventType(event.Type)}, nil
+	}
+
+	var intent stripeIntent
+	if err := json.Unmarshal(event.Data.Object, &intent); err != nil {
+		return nil, fmt.Errorf("invalid webhook payload: %w", err)
+	}
+
+	return &WebhookEvent{
+		ID:       event.ID,
+		Type:     eventType,
+		IntentID: intent.ID,
+		Amount:   intent.Amount,
+		Currency: strings.ToUpper(intent.Currency),
+	}, nil
+}
+
+// verifySignature checks a header like "t=1700000000,v1=<hex>,v1=<hex>". Any
+// v1 signature may match, as Stripe sends one per active secret while they
+// are rolled.
+func (p *StripeProvider) verifySignature(payload []byte, header string) error {
+	var (
+		timestamp  string
+		signatures [][]byte
+	)
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			if signature, err := hex.DecodeString(value); err == nil {
+				signatures = append(signatures, signature)
+			}
+		}
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return ErrInvalidSignature
+	}
+
+	age := p.now().Sub(time.Unix(seconds, 0))
+	if age > stripeWebhookTolerance || age < -stripeWebhookTolerance {
+		return ErrInvalidSignature
+	}
+
+	mac := hmac.New(sha256.New, p.webhookSecret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	expected := mac.Sum(nil)
+
+	for _, signature := range signatures {
+		if hmac.Equal(signature, expected) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+// stripeStateError is returned when an object is not in a state that allows
+// the request, e.g. capturing an intent that already succeeded.
+type stripeStateError struct {
+	message string
+}
+
+func (e *stripeStateError) Error() string {
+	return "stripe: " + e.message
+}
+
+// do sends a form encoded request to the Stripe API and decodes the JSON
+// response into dst.
+func (p *StripeProvider) do(ctx context.Context, method, path string, form url.Values, dst interface{}) error {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, p.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	req.Header.Set("Stripe-Version", stripeAPIVersion)
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	js, err := io.ReadAll(io.LimitReader(res.Body, 1_048_576))
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode >= 400 {
+		var e stripeError
+		if err := json.Unmarshal(js, &e); err != nil || e.Error.Message == "" {
+			return fmt.Errorf("stripe: unexpected status %d", res.StatusCode)
+		}
+
+		switch e.Error.Code {
+		case "resource_missing":
+			return ErrIntentNotFound
+		case "amount_too_large", "charge_already_refunded":
+			return ErrRefundTooLarge
+		case "payment_intent_unexpected_state":
+			return &stripeStateError{message: e.Error.Message}
+		}
+		return fmt.Errorf("stripe: %s", e.Error.Message)
+	}
+
+	return json.Unmarshal(js, dst)
+}
@@ -0,0 +1,192 @@
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func stripeSignature(secret string, at time.Time, payload string) string {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + payload))
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestStripeVerifyWebhook(t *testing.T) {
+	now := time.Unix(1_790_000_000, 0)
+	p := NewStripeProvider("sk_test", "whsec_test")
+	p.now = func() time.Time { return now }
+
+	succeeded := `{"id":"evt_1","type":"payment_intent.succeeded","data":{"object":{"id":"pi_1","amount":50000,"currency":"ngn","status":"succeeded"}}}`
+	failed := `{"id":"evt_2","type":"payment_intent.payment_failed","data":{"object":{"id":"pi_2","amount":700,"currency":"usd"}}}`
+	other := `{"id":"evt_3","type":"charge.refunded","data":{"object":{"id":"ch_1"}}}`
+
+	tests := []struct {
+		name      string
+		payload   string
+		signature string
+		want      *WebhookEvent
+		wantErr   error
+	}{
+		{
+			name:      "payment succeeded",
+			payload:   succeeded,
+			signature: stripeSignature("whsec_test", now, succeeded),
+			want:      &WebhookEvent{ID: "evt_1", Type: EventPaymentSucceeded, IntentID: "pi_1", Amount: 50000, Currency: "NGN"},
+		},
+		{
+			name:      "payment failed",
+			payload:   failed,
+			signature: stripeSignature("whsec_test", now.Add(-time.Minute), failed),
+			want:      &WebhookEvent{ID: "evt_2", Type: EventPaymentFailed, IntentID: "pi_2", Amount: 700, Currency: "USD"},
+		},
+		{
+			name:      "other events carry no intent",
+			payload:   other,
+			signature: stripeSignature("whsec_test", now, other),
+			want:      &WebhookEvent{ID: "evt_3", Type: "charge.refunded"},
+		},
+		{
+			name:      "one of several signatures matches",
+			payload:   succeeded,
+			signature: stripeSignature("whsec_old", now, succeeded) + ",v1=" + stripeSignature("whsec_test", now, succeeded)[len("t=1790000000,v1="):],
+			want:      &WebhookEvent{ID: "evt_1", Type: EventPaymentSucceeded, IntentID: "pi_1", Amount: 50000, Currency: "NGN"},
+		},
+		{
+			name:      "wrong secret",
+			payload:   succeeded,
+			signature: stripeSignature("whsec_other", now, succeeded),
+			wantErr:   ErrInvalidSignature,
+		},
+		{
+			name:      "body changed",
+			payload:   failed,
+			signature: stripeSignature("whsec_test", now, succeeded),
+			wantErr:   ErrInvalidSignature,
+		},
+		{
+			name:      "too old",
+			payload:   succeeded,
+			signature: stripeSignature("whsec_test", now.Add(-10*time.Minute), succeeded),
+			wantErr:   ErrInvalidSignature,
+		},
+		{
+			name:      "no timestamp",
+			payload:   succeeded,
+			signature: "v1=00",
+			wantErr:   ErrInvalidSignature,
+		},
+		{
+			name:    "no header",
+			payload: succeeded,
+			wantErr: ErrInvalidSignature,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.signature != "" {
+				header.Set(StripeSignatureHeader, tt.signature)
+			}
+
+			got, err := p.VerifyWebhook([]byte(tt.payload), header)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("VerifyWebhook() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.want != nil && *got != *tt.want {
+				t.Errorf("VerifyWebhook() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripeRequests(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer sk_test" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":{"type":"invalid_request_error","message":"Invalid API Key"}}`))
+			return
+		}
+
+		switch r.Method + " " + r.URL.Path {
+		case "POST /v1/payment_intents":
+			if r.FormValue("amount") != "50000" || r.FormValue("currency") != "ngn" || r.FormValue("metadata[reference]") != "TM-1" {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error":{"type":"invalid_request_error","message":"bad intent"}}`))
+				return
+			}
+			w.Write([]byte(`{"id":"pi_1","amount":50000,"currency":"ngn","status":"requires_payment_method","client_secret":"pi_1_secret_x","metadata":{"reference":"TM-1"}}`))
+		case "POST /v1/payment_intents/pi_1/capture":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":{"type":"invalid_request_error","code":"payment_intent_unexpected_state","message":"already succeeded"}}`))
+		case "GET /v1/payment_intents/pi_1":
+			w.Write([]byte(`{"id":"pi_1","amount":50000,"currency":"ngn","status":"succeeded"}`))
+		case "POST /v1/refunds":
+			if r.FormValue("amount") != "20000" {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error":{"type":"invalid_request_error","code":"amount_too_large","message":"too large"}}`))
+				return
+			}
+			w.Write([]byte(`{"id":"re_1","amount":20000,"currency":"ngn","payment_intent":"pi_1","status":"succeeded"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":{"type":"invalid_request_error","code":"resource_missing","message":"No such payment_intent"}}`))
+		}
+	}))
+	defer server.Close()
+
+	p := NewStripeProvider("sk_test", "whsec_test")
+	p.baseURL = server.URL
+	ctx := context.Background()
+
+	intent, err := p.CreateIntent(ctx, 50000, "NGN", "TM-1")
+	if err != nil {
+		t.Fatalf("CreateIntent() error = %v", err)
+	}
+	want := Intent{ID: "pi_1", Amount: 50000, Currency: "NGN", Reference: "TM-1", Status: IntentRequiresPayment, ClientSecret: "pi_1_secret_x"}
+	if *intent != want {
+		t.Errorf("CreateIntent() = %+v, want %+v", intent, want)
+	}
+
+	if _, err := p.CreateIntent(ctx, 0, "NGN", "TM-1"); !errors.Is(err, ErrInvalidAmount) {
+		t.Errorf("CreateIntent(0) error = %v, want ErrInvalidAmount", err)
+	}
+
+	intent, err = p.Capture(ctx, "pi_1")
+	if err != nil {
+		t.Fatalf("Capture() of a succeeded intent error = %v", err)
+	}
+	if intent.Status != IntentSucceeded {
+		t.Errorf("Capture() status = %s, want %s", intent.Status, IntentSucceeded)
+	}
+
+	if _, err := p.Capture(ctx, "pi_missing"); !errors.Is(err, ErrIntentNotFound) {
+		t.Errorf("Capture(missing) error = %v, want ErrIntentNotFound", err)
+	}
+
+	refund, err := p.Refund(ctx, "pi_1", 20000)
+	if err != nil {
+		t.Fatalf("Refund() error = %v", err)
+	}
+	if refund.ID != "re_1" || refund.IntentID != "pi_1" || refund.Currency != "NGN" {
+		t.Errorf("Refund() = %+v", refund)
+	}
+
+	if _, err := p.Refund(ctx, "pi_1", 90000); !errors.Is(err, ErrRefundTooLarge) {
+		t.Errorf("Refund(too large) error = %v, want ErrRefundTooLarge", err)
+	}
+
+	p.apiKey = "sk_wrong"
+	if _, err := p.CreateIntent(ctx, 50000, "NGN", "TM-1"); err == nil || err.Error() != "stripe: Invalid API Key" {
+		t.Errorf("CreateIntent() with a bad key error = %v", err)
+	}
+}
@@ -0,0 +1,257 @@
+// Package rrule reads the subset of iCalendar recurrence rules (RFC 5545)
+// used for event series, e.g. "FREQ=WEEKLY;BYDAY=FR,SA;COUNT=10", and lists
+// the dates they produce. Rules work on whole dates; the time of day comes
+// from the event.
+package rrule
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Frequency string
+
+const (
+	Daily   Frequency = "DAILY"
+	Weekly  Frequency = "WEEKLY"
+	Monthly Frequency = "MONTHLY"
+)
+
+var (
+	ErrInvalidRule        = errors.New("invalid recurrence rule")
+	ErrTooManyOccurrences = errors.New("recurrence rule produces too many dates")
+)
+
+var weekdays = map[string]time.Weekday{
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+	"SU": time.Sunday,
+}
+
+// Rule is a parsed recurrence rule. Every rule is bounded by Count or Until.
+type Rule struct {
+	Freq     Frequency
+	Interval int
+	Count    int       // number of dates, before exceptions are removed
+	Until    time.Time // last possible date, inclusive
+	ByDay    []time.Weekday
+}
+
+// Parse reads a rule such as "FREQ=MONTHLY;INTERVAL=2;UNTIL=20261231". An
+// "RRULE:" prefix is allowed. BYDAY takes plain weekdays and only works with
+// WEEKLY rules.
+func Parse(s string) (*Rule, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	if s == "" {
+		return nil, fmt.Errorf("rule is empty: %w", ErrInvalidRule)
+	}
+
+	r := &Rule{Interval: 1}
+	seen := map[string]bool{}
+
+	for _, part := range strings.Split(s, ";") {
+		name, value, ok := strings.Cut(part, "=")
+		name = strings.ToUpper(strings.TrimSpace(name))
+		value = strings.ToUpper(strings.TrimSpace(value))
+		if !ok || value == "" {
+			return nil, fmt.Errorf("%q is not NAME=VALUE: %w", part, ErrInvalidRule)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("%s is set twice: %w", name, ErrInvalidRule)
+		}
+		seen[name] = true
+
+		switch name {
+		case "FREQ":
+			switch f := Frequency(value); f {
+			case Daily, Weekly, Monthly:
+				r.Freq = f
+			default:
+				return nil, fmt.Errorf("FREQ must be DAILY, WEEKLY or MONTHLY: %w", ErrInvalidRule)
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > 365 {
+				return nil, fmt.Errorf("INTERVAL must be between 1 and 365: %w", ErrInvalidRule)
+			}
+			r.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("COUNT must be a positive number: %w", ErrInvalidRule)
+			}
+			r.Count = n
+		case "UNTIL":
+			until, err := parseUntil(value)
+			if err != nil {
+				return nil, err
+			}
+			r.Until = until
+		case "BYDAY":
+			for _, day := range strings.Split(value, ",") {
+				wd, ok := weekdays[strings.TrimSpace(day)]
+				if !ok {
+					return nil, fmt.Errorf("BYDAY takes weekdays such as MO,FR: %w", ErrInvalidRule)
+				}
+				if !hasWeekday(r.ByDay, wd) {
+					r.ByDay = append(r.ByDay, wd)
+				}
+			}
+		default:
+			return nil, fmt.Errorf("%s is not supported: %w", name, ErrInvalidRule)
+		}
+	}
+
+	switch {
+	case r.Freq == "":
+		return nil, fmt.Errorf("FREQ is required: %w", ErrInvalidRule)
+	case r.Count == 0 && r.Until.IsZero():
+		return nil, fmt.Errorf("COUNT or UNTIL is required: %w", ErrInvalidRule)
+	case r.Count > 0 && !r.Until.IsZero():
+		return nil, fmt.Errorf("COUNT and UNTIL cannot both be set: %w", ErrInvalidRule)
+	case len(r.ByDay) > 0 && r.Freq != Weekly:
+		return nil, fmt.Errorf("BYDAY is only supported with FREQ=WEEKLY: %w", ErrInvalidRule)
+	}
+
+	return r, nil
+}
+
+// parseUntil reads an UNTIL date, either a date or a UTC date-time of which
+// only the date is used.
+func parseUntil(value string) (time.Time, error) {
+	if len(value) >= 8 {
+		if t, err := time.Parse("20060102", value[:8]); err == nil && (len(value) == 8 || value[8] == 'T') {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("UNTIL must be a date such as 20261231: %w", ErrInvalidRule)
+}
+
+// String returns the rule in its canonical form.
+func (r *Rule) String() string {
+	parts := []string{"FREQ=" + string(r.Freq)}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, wd := range r.ByDay {
+			days[i] = strings.ToUpper(wd.String()[:2])
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.Format("20060102"))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Dates returns the dates the rule produces from start onwards, without
+// those in except, in order. Like EXDATE, exceptions still count towards
+// Count. Rules producing more than max dates return ErrTooManyOccurrences.
+// Monthly rules skip months without the start's day of the month.
+func (r *Rule) Dates(start time.Time, except []time.Time, max int) ([]time.Time, error) {
+	start = day(start)
+
+	skip := make(map[time.Time]bool, len(except))
+	for _, d := range except {
+		skip[day(d)] = true
+	}
+
+	dates := []time.Time{}
+	produced := 0
+
+	// add takes the next candidate and reports whether to keep going
+	add := func(d time.Time) (bool, error) {
+		if d.Before(start) {
+			return true, nil
+		}
+		if !r.Until.IsZero() && d.After(r.Until) {
+			return false, nil
+		}
+		produced++
+		if !skip[d] {
+			if len(dates) == max {
+				return false, ErrTooManyOccurrences
+			}
+			dates = append(dates, d)
+		}
+		return r.Count == 0 || produced < r.Count, nil
+	}
+
+	// Each step moves one period; a period with no dates in range still
+	// counts, so the loop is capped by the number of periods max allows
+	for period := 0; period <= max*31; period++ {
+		var candidates []time.Time
+
+		switch r.Freq {
+		case Daily:
+			candidates = []time.Time{start.AddDate(0, 0, period*r.Interval)}
+		case Weekly:
+			candidates = r.weekDates(start, period)
+		case Monthly:
+			y, m, _ := start.Date()
+			d := time.Date(y, m+time.Month(period*r.Interval), start.Day(), 0, 0, 0, 0, time.UTC)
+			// Skip months the day does not exist in, such as 31 April
+			if d.Day() == start.Day() {
+				candidates = []time.Time{d}
+			}
+		}
+
+		for _, d := range candidates {
+			more, err := add(d)
+			if err != nil {
+				return nil, err
+			}
+			if !more {
+				return dates, nil
+			}
+		}
+	}
+
+	return nil, ErrTooManyOccurrences
+}
+
+// weekDates returns the dates of a weekly rule in the period-th week it
+// runs in, weeks starting on Monday.
+func (r *Rule) weekDates(start time.Time, period int) []time.Time {
+	offset := (int(start.Weekday()) + 6) % 7 // days since Monday
+	monday := start.AddDate(0, 0, -offset+7*period*r.Interval)
+
+	if len(r.ByDay) == 0 {
+		return []time.Time{monday.AddDate(0, 0, offset)}
+	}
+
+	dates := make([]time.Time, 0, len(r.ByDay))
+	for _, wd := range r.ByDay {
+		dates = append(dates, monday.AddDate(0, 0, (int(wd)+6)%7))
+	}
+	sort.Slice(dates, func(i, j int) bool { return dates[i].Before(dates[j]) })
+	return dates
+}
+
+func hasWeekday(days []time.Weekday, wd time.Weekday) bool {
+	for _, d := range days {
+		if d == wd {
+			return true
+		}
+	}
+	return false
+}
+
+// day returns the date of t at midnight UTC.
+func day(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
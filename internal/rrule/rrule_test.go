@@ -0,0 +1,196 @@
+package rrule
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func date(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func dates(ss ...string) []time.Time {
+	ts := make([]time.Time, len(ss))
+	for i, s := range ss {
+		ts[i] = date(s)
+	}
+	return ts
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  string
+		want  string
+		valid bool
+	}{
+		{"weekly with count", "FREQ=WEEKLY;COUNT=4", "FREQ=WEEKLY;COUNT=4", true},
+		{"prefix and lower case", "RRULE:freq=daily;interval=2;until=20261231", "FREQ=DAILY;INTERVAL=2;UNTIL=20261231", true},
+		{"until date-time", "FREQ=MONTHLY;UNTIL=20261231T235959Z", "FREQ=MONTHLY;UNTIL=20261231", true},
+		{"byday kept in given order without duplicates", "FREQ=WEEKLY;BYDAY=SA,FR,SA;COUNT=3", "FREQ=WEEKLY;BYDAY=SA,FR;COUNT=3", true},
+		{"interval of one left out", "FREQ=DAILY;INTERVAL=1;COUNT=2", "FREQ=DAILY;COUNT=2", true},
+		{"empty", "", "", false},
+		{"missing freq", "COUNT=3", "", false},
+		{"unsupported freq", "FREQ=YEARLY;COUNT=3", "", false},
+		{"unbounded", "FREQ=DAILY", "", false},
+		{"count and until", "FREQ=DAILY;COUNT=3;UNTIL=20261231", "", false},
+		{"byday with daily", "FREQ=DAILY;BYDAY=MO;COUNT=3", "", false},
+		{"bad weekday", "FREQ=WEEKLY;BYDAY=XX;COUNT=3", "", false},
+		{"zero interval", "FREQ=DAILY;INTERVAL=0;COUNT=3", "", false},
+		{"zero count", "FREQ=DAILY;COUNT=0", "", false},
+		{"bad until", "FREQ=DAILY;UNTIL=2026-12-31", "", false},
+		{"set twice", "FREQ=DAILY;COUNT=2;COUNT=3", "", false},
+		{"unsupported part", "FREQ=DAILY;COUNT=2;BYMONTH=1", "", false},
+		{"not name=value", "FREQ=DAILY;COUNT", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := Parse(tt.rule)
+			if !tt.valid {
+				if !errors.Is(err, ErrInvalidRule) {
+					t.Fatalf("Parse(%q) error = %v, want ErrInvalidRule", tt.rule, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.rule, err)
+			}
+			if got := r.String(); got != tt.want {
+				t.Errorf("Parse(%q).String() = %q, want %q", tt.rule, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDates(t *testing.T) {
+	tests := []struct {
+		name   string
+		rule   string
+		start  string
+		except []time.Time
+		want   []time.Time
+	}{
+		{
+			name:  "daily count",
+			rule:  "FREQ=DAILY;COUNT=3",
+			start: "2026-06-01",
+			want:  dates("2026-06-01", "2026-06-02", "2026-06-03"),
+		},
+		{
+			name:  "daily interval until inclusive",
+			rule:  "FREQ=DAILY;INTERVAL=3;UNTIL=20260607",
+			start: "2026-06-01",
+			want:  dates("2026-06-01", "2026-06-04", "2026-06-07"),
+		},
+		{
+			name:  "weekly on the start's weekday",
+			rule:  "FREQ=WEEKLY;COUNT=3",
+			start: "2026-06-05",
+			want:  dates("2026-06-05", "2026-06-12", "2026-06-19"),
+		},
+		{
+			name:  "byday in week order whatever the order given",
+			rule:  "FREQ=WEEKLY;BYDAY=SA,FR;COUNT=4",
+			start: "2026-06-05",
+			want:  dates("2026-06-05", "2026-06-06", "2026-06-12", "2026-06-13"),
+		},
+		{
+			name:  "byday days before the start are not produced",
+			rule:  "FREQ=WEEKLY;BYDAY=MO,FR;COUNT=3",
+			start: "2026-06-03",
+			want:  dates("2026-06-05", "2026-06-08", "2026-06-12"),
+		},
+		{
+			name:  "byday every other week",
+			rule:  "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE;UNTIL=20260630",
+			start: "2026-06-01",
+			want:  dates("2026-06-01", "2026-06-03", "2026-06-15", "2026-06-17", "2026-06-29"),
+		},
+		{
+			name:  "monthly skips months without the 31st",
+			rule:  "FREQ=MONTHLY;COUNT=4",
+			start: "2026-01-31",
+			want:  dates("2026-01-31", "2026-03-31", "2026-05-31", "2026-07-31"),
+		},
+		{
+			name:  "monthly on the 29th skips february outside leap years",
+			rule:  "FREQ=MONTHLY;UNTIL=20280331",
+			start: "2027-01-29",
+			want: dates("2027-01-29", "2027-03-29", "2027-04-29", "2027-05-29", "2027-06-29",
+				"2027-07-29", "2027-08-29", "2027-09-29", "2027-10-29", "2027-11-29", "2027-12-29",
+				"2028-01-29", "2028-02-29", "2028-03-29"),
+		},
+		{
+			name:   "exceptions count towards count",
+			rule:   "FREQ=WEEKLY;COUNT=3",
+			start:  "2026-06-05",
+			except: dates("2026-06-12"),
+			want:   dates("2026-06-05", "2026-06-19"),
+		},
+		{
+			name:   "exceptions match whole dates",
+			rule:   "FREQ=DAILY;UNTIL=20260603",
+			start:  "2026-06-01",
+			except: []time.Time{time.Date(2026, 6, 2, 18, 30, 0, 0, time.UTC)},
+			want:   dates("2026-06-01", "2026-06-03"),
+		},
+		{
+			name:  "until before start",
+			rule:  "FREQ=DAILY;UNTIL=20260101",
+			start: "2026-06-01",
+			want:  dates(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := Parse(tt.rule)
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.rule, err)
+			}
+
+			got, err := r.Dates(date(tt.start), tt.except, 100)
+			if err != nil {
+				t.Fatalf("Dates() error = %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Dates() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if !got[i].Equal(tt.want[i]) {
+					t.Fatalf("Dates() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestDatesTooMany(t *testing.T) {
+	tests := []struct {
+		name string
+		rule string
+	}{
+		{"count over max", "FREQ=DAILY;COUNT=11"},
+		{"until over max", "FREQ=WEEKLY;UNTIL=20271231"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := Parse(tt.rule)
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.rule, err)
+			}
+
+			_, err = r.Dates(date("2026-06-01"), nil, 10)
+			if !errors.Is(err, ErrTooManyOccurrences) {
+				t.Errorf("Dates() error = %v, want ErrTooManyOccurrences", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+// Package ticketsign holds the API's Ed25519 ticket signing keys. Tokens are
+// produced in the format checked by pkg/ticketverify.
+package ticketsign
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/AbrahamMayowa/ticketmania/pkg/ticketverify"
+)
+
+// KeyRing signs with its active key and publishes the public half of every
+// key it holds, so tickets signed before a rotation keep verifying.
+type KeyRing struct {
+	active   string
+	keys     map[string]ed25519.PrivateKey
+	order    []string
+	verifier *ticketverify.Verifier
+}
+
+// Parse reads keys in the form "kid1:seed1,kid2:seed2", where each seed is a
+// standard base64 32-byte Ed25519 seed (openssl rand -base64 32). active names
+// the key used for new signatures; when empty the last key listed is used.
+func Parse(spec, active string) (*KeyRing, error) {
+	keys := make(map[string]ed25519.PrivateKey)
+	order := []string{}
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		kid, encoded, ok := strings.Cut(entry, ":")
+		if !ok || kid == "" || strings.Contains(kid, ".") {
+			return nil, fmt.Errorf("invalid signing key entry %q", entry)
+		}
+
+		seed, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return nil, fmt.Errorf("signing key %q must be a base64 encoded %d byte seed", kid, ed25519.SeedSize)
+		}
+
+		if _, exists := keys[kid]; exists {
+			return nil, fmt.Errorf("signing key %q is listed twice", kid)
+		}
+
+		keys[kid] = ed25519.NewKeyFromSeed(seed)
+		order = append(order, kid)
+	}
+
+	if len(order) == 0 {
+		return nil, fmt.Errorf("at least one signing key is required")
+	}
+
+	if active == "" {
+		active = order[len(order)-1]
+	}
+	if _, ok := keys[active]; !ok {
+		return nil, fmt.Errorf("active signing key %q is not configured", active)
+	}
+
+	return newKeyRing(active, keys, order)
+}
+
+// Generate creates a key ring with a single random key. It is meant for
+// development: tickets it signs stop verifying once the process restarts.
+func Generate() (*KeyRing, error) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return newKeyRing("dev", map[string]ed25519.PrivateKey{"dev": priv}, []string{"dev"})
+}
+
+func newKeyRing(active string, keys map[string]ed25519.PrivateKey, order []string) (*KeyRing, error) {
+	k := &KeyRing{active: active, keys: keys, order: order}
+
+	verifier, err := ticketverify.NewVerifier(k.PublicKeys()...)
+	if err != nil {
+		return nil, err
+	}
+	k.verifier = verifier
+
+	return k, nil
+}
+
+// Sign returns a token for payload signed with the active key.
+func (k *KeyRing) Sign(payload ticketverify.Payload) (string, error) {
+	return ticketverify.Sign(k.active, k.keys[k.active], payload)
+}
+
+// Verifier checks tokens against every key in the ring.
+func (k *KeyRing) Verifier() *ticketverify.Verifier {
+	return k.verifier
+}
+
+// PublicKeys returns the public keys to publish, in configuration order.
+func (k *KeyRing) PublicKeys() []ticketverify.Key {
+	keys := make([]ticketverify.Key, 0, len(k.order))
+	for _, kid := range k.order {
+		keys = append(keys, ticketverify.NewKey(kid, k.keys[kid].Public().(ed25519.PublicKey)))
+	}
+	return keys
+}
@@ -0,0 +1,14 @@
+BEGIN;
+
+DROP INDEX IF EXISTS ix_tickets_reservation_id;
+ALTER TABLE tickets DROP COLUMN IF EXISTS reservation_id;
+
+ALTER TABLE ticket_types DROP COLUMN IF EXISTS reserved_qty;
+
+DROP INDEX IF EXISTS ix_reservations_active_expires_at;
+DROP INDEX IF EXISTS ix_reservations_event_id;
+DROP TABLE IF EXISTS reservations;
+
+DROP TYPE IF EXISTS reservation_status;
+
+COMMIT;
@@ -0,0 +1,25 @@
+BEGIN;
+
+CREATE TYPE reservation_status AS ENUM ('active', 'completed', 'expired', 'cancelled');
+
+-- Reservations hold ticket inventory for a limited time while the buyer pays
+CREATE TABLE IF NOT EXISTS reservations (
+  id BIGSERIAL PRIMARY KEY,
+  event_id BIGINT NOT NULL REFERENCES events(id) ON DELETE CASCADE,
+  user_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+  status reservation_status NOT NULL DEFAULT 'active',
+  expires_at TIMESTAMPTZ NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS ix_reservations_event_id ON reservations(event_id);
+CREATE INDEX IF NOT EXISTS ix_reservations_active_expires_at ON reservations(expires_at) WHERE status = 'active';
+
+-- Held tickets are counted separately from sold ones so expired holds can be released
+ALTER TABLE ticket_types ADD COLUMN IF NOT EXISTS reserved_qty INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE tickets ADD COLUMN IF NOT EXISTS reservation_id BIGINT REFERENCES reservations(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS ix_tickets_reservation_id ON tickets(reservation_id);
+
+COMMIT;
@@ -0,0 +1,9 @@
+BEGIN;
+
+DROP INDEX IF EXISTS ix_payments_reservation_id;
+DROP INDEX IF EXISTS ux_payments_provider_ref;
+DROP TABLE IF EXISTS payments;
+
+DROP TYPE IF EXISTS payment_status;
+
+COMMIT;
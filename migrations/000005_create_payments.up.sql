@@ -0,0 +1,21 @@
+BEGIN;
+
+CREATE TYPE payment_status AS ENUM ('pending', 'succeeded', 'failed', 'refunded');
+
+-- One row per payment intent created with the configured provider
+CREATE TABLE IF NOT EXISTS payments (
+  id BIGSERIAL PRIMARY KEY,
+  reservation_id BIGINT NOT NULL REFERENCES reservations(id) ON DELETE CASCADE,
+  provider TEXT NOT NULL,
+  provider_ref TEXT NOT NULL,
+  amount BIGINT NOT NULL,                 -- amount in smallest currency unit
+  currency VARCHAR(8) NOT NULL,
+  status payment_status NOT NULL DEFAULT 'pending',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS ux_payments_provider_ref ON payments(provider, provider_ref);
+CREATE INDEX IF NOT EXISTS ix_payments_reservation_id ON payments(reservation_id);
+
+COMMIT;
@@ -0,0 +1,17 @@
+BEGIN;
+
+DROP INDEX IF EXISTS ix_tickets_order_id;
+ALTER TABLE tickets DROP COLUMN IF EXISTS order_id;
+
+DROP INDEX IF EXISTS ix_order_items_order_id;
+DROP TABLE IF EXISTS order_items;
+
+DROP INDEX IF EXISTS ux_orders_reservation_id;
+DROP INDEX IF EXISTS ix_orders_user_id;
+DROP INDEX IF EXISTS ix_orders_event_id;
+DROP INDEX IF EXISTS ux_orders_order_number;
+DROP TABLE IF EXISTS orders;
+
+DROP TYPE IF EXISTS order_status;
+
+COMMIT;
@@ -0,0 +1,44 @@
+BEGIN;
+
+CREATE TYPE order_status AS ENUM ('pending', 'paid', 'cancelled', 'expired', 'refunded');
+
+-- Orders group the tickets bought together and snapshot what was charged
+CREATE TABLE IF NOT EXISTS orders (
+  id BIGSERIAL PRIMARY KEY,
+  order_number TEXT NOT NULL,
+  event_id BIGINT NOT NULL REFERENCES events(id) ON DELETE CASCADE,
+  reservation_id BIGINT REFERENCES reservations(id) ON DELETE SET NULL,
+  user_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+  buyer_email TEXT NOT NULL,
+  buyer_phone TEXT,
+  status order_status NOT NULL DEFAULT 'pending',
+  subtotal BIGINT NOT NULL DEFAULT 0,     -- amounts in smallest currency unit
+  total BIGINT NOT NULL DEFAULT 0,
+  currency VARCHAR(8) NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS ux_orders_order_number ON orders(order_number);
+CREATE INDEX IF NOT EXISTS ix_orders_event_id ON orders(event_id);
+CREATE INDEX IF NOT EXISTS ix_orders_user_id ON orders(user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS ux_orders_reservation_id ON orders(reservation_id);
+
+CREATE TABLE IF NOT EXISTS order_items (
+  id BIGSERIAL PRIMARY KEY,
+  order_id BIGINT NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+  ticket_type_id BIGINT NOT NULL REFERENCES ticket_types(id) ON DELETE CASCADE,
+  name TEXT NOT NULL,                     -- ticket type name at purchase time
+  unit_price BIGINT NOT NULL,
+  currency VARCHAR(8) NOT NULL,
+  quantity INTEGER NOT NULL,
+  line_total BIGINT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS ix_order_items_order_id ON order_items(order_id);
+
+-- Tickets sold before orders existed keep a NULL order_id
+ALTER TABLE tickets ADD COLUMN IF NOT EXISTS order_id BIGINT REFERENCES orders(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS ix_tickets_order_id ON tickets(order_id);
+
+COMMIT;
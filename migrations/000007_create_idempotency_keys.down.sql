@@ -0,0 +1,7 @@
+BEGIN;
+
+DROP INDEX IF EXISTS ix_idempotency_keys_created_at;
+DROP INDEX IF EXISTS ux_idempotency_keys_scope_key;
+DROP TABLE IF EXISTS idempotency_keys;
+
+COMMIT;
@@ -0,0 +1,18 @@
+BEGIN;
+
+-- Responses stored against client supplied Idempotency-Key headers
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+  id BIGSERIAL PRIMARY KEY,
+  key TEXT NOT NULL,
+  scope TEXT NOT NULL,                    -- method, path and caller the key was used for
+  request_hash TEXT NOT NULL,
+  status_code INTEGER,                    -- NULL while the first request is in flight
+  response_body BYTEA,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  completed_at TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS ux_idempotency_keys_scope_key ON idempotency_keys(scope, key);
+CREATE INDEX IF NOT EXISTS ix_idempotency_keys_created_at ON idempotency_keys(created_at);
+
+COMMIT;
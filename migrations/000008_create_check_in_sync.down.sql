@@ -0,0 +1,15 @@
+BEGIN;
+
+DROP INDEX IF EXISTS ux_check_in_scans_device_scan;
+DROP INDEX IF EXISTS ix_check_in_scans_ticket_id;
+DROP INDEX IF EXISTS ix_check_in_scans_event_id;
+DROP TABLE IF EXISTS check_in_scans;
+DROP TYPE IF EXISTS check_in_result;
+
+DROP INDEX IF EXISTS ix_tickets_event_revision;
+DROP TRIGGER IF EXISTS tickets_bump_revision ON tickets;
+DROP FUNCTION IF EXISTS bump_ticket_revision();
+ALTER TABLE tickets DROP COLUMN IF EXISTS revision;
+DROP SEQUENCE IF EXISTS ticket_revision_seq;
+
+COMMIT;
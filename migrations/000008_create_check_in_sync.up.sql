@@ -0,0 +1,41 @@
+BEGIN;
+
+-- Every insert or update of a ticket gets a new revision so scanners can
+-- download only what changed since their last sync
+CREATE SEQUENCE IF NOT EXISTS ticket_revision_seq;
+
+ALTER TABLE tickets ADD COLUMN IF NOT EXISTS revision BIGINT NOT NULL DEFAULT nextval('ticket_revision_seq');
+
+CREATE OR REPLACE FUNCTION bump_ticket_revision() RETURNS trigger AS $$
+BEGIN
+  NEW.revision := nextval('ticket_revision_seq');
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER tickets_bump_revision
+  BEFORE UPDATE ON tickets
+  FOR EACH ROW EXECUTE FUNCTION bump_ticket_revision();
+
+CREATE INDEX IF NOT EXISTS ix_tickets_event_revision ON tickets(event_id, revision);
+
+CREATE TYPE check_in_result AS ENUM ('accepted', 'duplicate', 'rejected');
+
+-- Scans reported by door scanners, online or uploaded after working offline
+CREATE TABLE IF NOT EXISTS check_in_scans (
+  id BIGSERIAL PRIMARY KEY,
+  event_id BIGINT NOT NULL REFERENCES events(id) ON DELETE CASCADE,
+  ticket_id BIGINT NOT NULL REFERENCES tickets(id) ON DELETE CASCADE,
+  device_id TEXT NOT NULL,
+  scanned_at TIMESTAMPTZ NOT NULL,
+  result check_in_result NOT NULL,
+  reason TEXT,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS ix_check_in_scans_event_id ON check_in_scans(event_id);
+CREATE INDEX IF NOT EXISTS ix_check_in_scans_ticket_id ON check_in_scans(ticket_id);
+-- a device re-uploading the same batch must not record its scans twice
+CREATE UNIQUE INDEX IF NOT EXISTS ux_check_in_scans_device_scan ON check_in_scans(device_id, ticket_id, scanned_at);
+
+COMMIT;
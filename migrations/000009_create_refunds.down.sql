@@ -0,0 +1,15 @@
+BEGIN;
+
+ALTER TABLE tickets DROP COLUMN IF EXISTS refund_id;
+ALTER TABLE tickets DROP COLUMN IF EXISTS cancelled_at;
+
+DROP INDEX IF EXISTS ix_refunds_order_id;
+DROP TABLE IF EXISTS refunds;
+DROP TYPE IF EXISTS refund_status;
+
+ALTER TABLE events DROP COLUMN IF EXISTS refund_cutoff_hours;
+ALTER TABLE events DROP COLUMN IF EXISTS refund_percent;
+ALTER TABLE events DROP COLUMN IF EXISTS refund_policy;
+DROP TYPE IF EXISTS refund_policy;
+
+COMMIT;
@@ -0,0 +1,34 @@
+BEGIN;
+
+CREATE TYPE refund_policy AS ENUM ('full', 'partial', 'none');
+
+-- Refund policy applied when ticket holders cancel; nothing is refunded within
+-- refund_cutoff_hours of the event start
+ALTER TABLE events ADD COLUMN IF NOT EXISTS refund_policy refund_policy NOT NULL DEFAULT 'full';
+ALTER TABLE events ADD COLUMN IF NOT EXISTS refund_percent INTEGER NOT NULL DEFAULT 100
+  CHECK (refund_percent BETWEEN 0 AND 100);
+ALTER TABLE events ADD COLUMN IF NOT EXISTS refund_cutoff_hours INTEGER NOT NULL DEFAULT 24
+  CHECK (refund_cutoff_hours >= 0);
+
+CREATE TYPE refund_status AS ENUM ('pending', 'succeeded', 'failed');
+
+CREATE TABLE IF NOT EXISTS refunds (
+  id BIGSERIAL PRIMARY KEY,
+  order_id BIGINT REFERENCES orders(id) ON DELETE CASCADE,   -- NULL for tickets sold before orders
+  payment_id BIGINT REFERENCES payments(id) ON DELETE SET NULL,
+  amount BIGINT NOT NULL DEFAULT 0,       -- amount in smallest currency unit
+  currency VARCHAR(8) NOT NULL,
+  reason TEXT,
+  status refund_status NOT NULL DEFAULT 'pending',
+  provider_ref TEXT,
+  requested_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS ix_refunds_order_id ON refunds(order_id);
+
+ALTER TABLE tickets ADD COLUMN IF NOT EXISTS cancelled_at TIMESTAMPTZ;
+ALTER TABLE tickets ADD COLUMN IF NOT EXISTS refund_id BIGINT REFERENCES refunds(id) ON DELETE SET NULL;
+
+COMMIT;
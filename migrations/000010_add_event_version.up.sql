@@ -0,0 +1,6 @@
+BEGIN;
+
+-- Incremented on every change so concurrent edits can be detected
+ALTER TABLE events ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+
+COMMIT;
@@ -0,0 +1,8 @@
+BEGIN;
+
+ALTER TABLE ticket_types DROP CONSTRAINT IF EXISTS ck_ticket_types_sales_window;
+ALTER TABLE ticket_types DROP COLUMN IF EXISTS sales_paused;
+ALTER TABLE ticket_types DROP COLUMN IF EXISTS sales_end;
+ALTER TABLE ticket_types DROP COLUMN IF EXISTS sales_start;
+
+COMMIT;
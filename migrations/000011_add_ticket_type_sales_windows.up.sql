@@ -0,0 +1,11 @@
+BEGIN;
+
+-- Sales windows and a pause switch, checked when tickets are reserved
+ALTER TABLE ticket_types ADD COLUMN IF NOT EXISTS sales_start TIMESTAMPTZ;
+ALTER TABLE ticket_types ADD COLUMN IF NOT EXISTS sales_end TIMESTAMPTZ;
+ALTER TABLE ticket_types ADD COLUMN IF NOT EXISTS sales_paused BOOLEAN NOT NULL DEFAULT false;
+
+ALTER TABLE ticket_types ADD CONSTRAINT ck_ticket_types_sales_window
+  CHECK (sales_start IS NULL OR sales_end IS NULL OR sales_start < sales_end);
+
+COMMIT;
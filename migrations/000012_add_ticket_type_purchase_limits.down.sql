@@ -0,0 +1,9 @@
+BEGIN;
+
+DROP INDEX IF EXISTS ix_tickets_ticket_type_buyer_email;
+
+ALTER TABLE ticket_types DROP COLUMN IF EXISTS max_per_buyer;
+ALTER TABLE ticket_types DROP COLUMN IF EXISTS max_per_order;
+ALTER TABLE ticket_types DROP COLUMN IF EXISTS min_per_order;
+
+COMMIT;
@@ -0,0 +1,14 @@
+BEGIN;
+
+-- Purchase limits per order and per buyer; NULL means no limit
+ALTER TABLE ticket_types ADD COLUMN IF NOT EXISTS min_per_order INTEGER NOT NULL DEFAULT 1
+  CHECK (min_per_order >= 1);
+ALTER TABLE ticket_types ADD COLUMN IF NOT EXISTS max_per_order INTEGER
+  CHECK (max_per_order IS NULL OR max_per_order >= min_per_order);
+ALTER TABLE ticket_types ADD COLUMN IF NOT EXISTS max_per_buyer INTEGER
+  CHECK (max_per_buyer IS NULL OR max_per_buyer >= 1);
+
+-- Per-buyer limits count earlier tickets by email
+CREATE INDEX IF NOT EXISTS ix_tickets_ticket_type_buyer_email ON tickets(ticket_type_id, lower(buyer_email));
+
+COMMIT;
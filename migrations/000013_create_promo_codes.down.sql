@@ -0,0 +1,11 @@
+BEGIN;
+
+ALTER TABLE order_items DROP COLUMN IF EXISTS discount;
+ALTER TABLE orders DROP COLUMN IF EXISTS discount;
+ALTER TABLE orders DROP COLUMN IF EXISTS promo_code_id;
+
+DROP INDEX IF EXISTS ux_promo_codes_event_code;
+DROP TABLE IF EXISTS promo_codes;
+DROP TYPE IF EXISTS discount_type;
+
+COMMIT;
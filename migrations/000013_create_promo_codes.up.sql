@@ -0,0 +1,31 @@
+BEGIN;
+
+CREATE TYPE discount_type AS ENUM ('percent', 'fixed');
+
+CREATE TABLE IF NOT EXISTS promo_codes (
+  id BIGSERIAL PRIMARY KEY,
+  event_id BIGINT NOT NULL REFERENCES events(id) ON DELETE CASCADE,
+  code TEXT NOT NULL,
+  discount_type discount_type NOT NULL,
+  discount_value BIGINT NOT NULL CHECK (discount_value > 0), -- percent, or amount in smallest currency unit
+  currency VARCHAR(8),                                       -- required for fixed discounts
+  ticket_type_ids BIGINT[] NOT NULL DEFAULT '{}',            -- empty applies to every ticket type
+  max_uses INTEGER CHECK (max_uses IS NULL OR max_uses > 0),
+  used_count INTEGER NOT NULL DEFAULT 0,
+  valid_from TIMESTAMPTZ,
+  valid_until TIMESTAMPTZ,
+  active BOOLEAN NOT NULL DEFAULT true,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  CHECK (used_count >= 0 AND (max_uses IS NULL OR used_count <= max_uses)),
+  CHECK (discount_type <> 'percent' OR discount_value <= 100),
+  CHECK (valid_from IS NULL OR valid_until IS NULL OR valid_from < valid_until)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS ux_promo_codes_event_code ON promo_codes(event_id, upper(code));
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS promo_code_id BIGINT REFERENCES promo_codes(id) ON DELETE SET NULL;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS discount BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS discount BIGINT NOT NULL DEFAULT 0;
+
+COMMIT;
@@ -0,0 +1,9 @@
+BEGIN;
+
+DROP INDEX IF EXISTS ix_waitlist_entries_reservation_id;
+DROP INDEX IF EXISTS ix_waitlist_entries_waiting;
+DROP INDEX IF EXISTS ux_waitlist_entries_ticket_type_email;
+DROP TABLE IF EXISTS waitlist_entries;
+DROP TYPE IF EXISTS waitlist_status;
+
+COMMIT;
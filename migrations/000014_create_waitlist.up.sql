@@ -0,0 +1,29 @@
+BEGIN;
+
+CREATE TYPE waitlist_status AS ENUM ('waiting', 'offered', 'purchased', 'expired', 'cancelled');
+
+CREATE TABLE IF NOT EXISTS waitlist_entries (
+  id BIGSERIAL PRIMARY KEY,
+  event_id BIGINT NOT NULL REFERENCES events(id) ON DELETE CASCADE,
+  ticket_type_id BIGINT NOT NULL REFERENCES ticket_types(id) ON DELETE CASCADE,
+  user_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+  email TEXT NOT NULL,
+  phone TEXT NOT NULL,
+  quantity INTEGER NOT NULL CHECK (quantity > 0),
+  status waitlist_status NOT NULL DEFAULT 'waiting',
+  reservation_id BIGINT REFERENCES reservations(id) ON DELETE SET NULL, -- the hold offered to this entry
+  offered_at TIMESTAMPTZ,
+  offer_expires_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- One place in line per buyer and ticket type
+CREATE UNIQUE INDEX IF NOT EXISTS ux_waitlist_entries_ticket_type_email
+  ON waitlist_entries(ticket_type_id, lower(email))
+  WHERE status IN ('waiting', 'offered');
+
+CREATE INDEX IF NOT EXISTS ix_waitlist_entries_waiting ON waitlist_entries(ticket_type_id, id) WHERE status = 'waiting';
+CREATE INDEX IF NOT EXISTS ix_waitlist_entries_reservation_id ON waitlist_entries(reservation_id);
+
+COMMIT;
@@ -0,0 +1,10 @@
+BEGIN;
+
+DROP INDEX IF EXISTS ux_tickets_seat_id;
+ALTER TABLE tickets DROP COLUMN IF EXISTS seat_id;
+
+DROP INDEX IF EXISTS ix_seats_ticket_type_id;
+DROP INDEX IF EXISTS ux_seats_event_position;
+DROP TABLE IF EXISTS seats;
+
+COMMIT;
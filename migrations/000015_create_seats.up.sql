@@ -0,0 +1,22 @@
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS seats (
+  id BIGSERIAL PRIMARY KEY,
+  event_id BIGINT NOT NULL REFERENCES events(id) ON DELETE CASCADE,
+  section TEXT NOT NULL,
+  row_label TEXT NOT NULL,
+  number TEXT NOT NULL,
+  ticket_type_id BIGINT NOT NULL REFERENCES ticket_types(id) ON DELETE CASCADE, -- sets the seat's price
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS ux_seats_event_position ON seats(event_id, section, row_label, number);
+CREATE INDEX IF NOT EXISTS ix_seats_ticket_type_id ON seats(ticket_type_id);
+
+ALTER TABLE tickets ADD COLUMN IF NOT EXISTS seat_id BIGINT REFERENCES seats(id) ON DELETE SET NULL;
+
+-- A seat can only be held or sold once; cancelled tickets free it again
+CREATE UNIQUE INDEX IF NOT EXISTS ux_tickets_seat_id ON tickets(seat_id)
+  WHERE seat_id IS NOT NULL AND status IN ('reserved', 'paid', 'used');
+
+COMMIT;
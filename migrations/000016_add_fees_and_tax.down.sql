@@ -0,0 +1,16 @@
+BEGIN;
+
+ALTER TABLE order_items DROP COLUMN IF EXISTS tax;
+ALTER TABLE order_items DROP COLUMN IF EXISTS absorbed_fee;
+ALTER TABLE order_items DROP COLUMN IF EXISTS service_fee;
+
+ALTER TABLE orders DROP COLUMN IF EXISTS tax;
+ALTER TABLE orders DROP COLUMN IF EXISTS absorbed_fee;
+ALTER TABLE orders DROP COLUMN IF EXISTS service_fee;
+
+ALTER TABLE events DROP COLUMN IF EXISTS tax_rate_bps;
+ALTER TABLE events DROP COLUMN IF EXISTS fees_absorbed;
+ALTER TABLE events DROP COLUMN IF EXISTS service_fee_bps;
+ALTER TABLE events DROP COLUMN IF EXISTS service_fee_flat;
+
+COMMIT;
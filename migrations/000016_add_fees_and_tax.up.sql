@@ -0,0 +1,16 @@
+BEGIN;
+
+ALTER TABLE events ADD COLUMN IF NOT EXISTS service_fee_flat BIGINT NOT NULL DEFAULT 0 CHECK (service_fee_flat >= 0);
+ALTER TABLE events ADD COLUMN IF NOT EXISTS service_fee_bps INTEGER NOT NULL DEFAULT 0 CHECK (service_fee_bps BETWEEN 0 AND 10000);
+ALTER TABLE events ADD COLUMN IF NOT EXISTS fees_absorbed BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE events ADD COLUMN IF NOT EXISTS tax_rate_bps INTEGER NOT NULL DEFAULT 0 CHECK (tax_rate_bps BETWEEN 0 AND 10000);
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS service_fee BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS absorbed_fee BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS tax BIGINT NOT NULL DEFAULT 0;
+
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS service_fee BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS absorbed_fee BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS tax BIGINT NOT NULL DEFAULT 0;
+
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN;
+
+DROP INDEX IF EXISTS ix_ticket_types_event_id_price;
+DROP INDEX IF EXISTS ix_events_created_at;
+DROP INDEX IF EXISTS ix_events_status_date;
+
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN;
+
+CREATE INDEX IF NOT EXISTS ix_events_status_date ON events(status, date, start_time);
+CREATE INDEX IF NOT EXISTS ix_events_created_at ON events(created_at);
+CREATE INDEX IF NOT EXISTS ix_ticket_types_event_id_price ON ticket_types(event_id, price);
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP INDEX IF EXISTS ix_events_search_vector;
+ALTER TABLE events DROP COLUMN IF EXISTS search_vector;
+
+COMMIT;
@@ -0,0 +1,12 @@
+BEGIN;
+
+ALTER TABLE events ADD COLUMN IF NOT EXISTS search_vector tsvector
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+        setweight(to_tsvector('english', coalesce(description, '')), 'B') ||
+        setweight(to_tsvector('english', coalesce(location, '')), 'C')
+    ) STORED;
+
+CREATE INDEX IF NOT EXISTS ix_events_search_vector ON events USING GIN (search_vector);
+
+COMMIT;
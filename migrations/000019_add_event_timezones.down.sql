@@ -0,0 +1,11 @@
+BEGIN;
+
+DROP INDEX IF EXISTS ix_events_status_starts_at;
+
+ALTER TABLE events DROP CONSTRAINT IF EXISTS events_ends_after_starts;
+ALTER TABLE events DROP COLUMN IF EXISTS ends_at;
+ALTER TABLE events DROP COLUMN IF EXISTS starts_at;
+ALTER TABLE events DROP COLUMN IF EXISTS end_date;
+ALTER TABLE events DROP COLUMN IF EXISTS timezone;
+
+COMMIT;
@@ -0,0 +1,28 @@
+BEGIN;
+
+-- Events used to be single-day and in UTC; existing rows keep that meaning
+ALTER TABLE events ADD COLUMN IF NOT EXISTS timezone TEXT NOT NULL DEFAULT 'UTC';
+ALTER TABLE events ADD COLUMN IF NOT EXISTS end_date DATE;
+ALTER TABLE events ADD COLUMN IF NOT EXISTS starts_at TIMESTAMPTZ;
+ALTER TABLE events ADD COLUMN IF NOT EXISTS ends_at TIMESTAMPTZ;
+
+-- Only the time of day survived 000003, so events that ran past midnight
+-- now end at or before their start time; they end on the next day
+UPDATE events
+SET end_date = CASE WHEN end_time <= start_time THEN date + 1 ELSE date END
+WHERE end_date IS NULL;
+
+UPDATE events
+SET starts_at = (date + start_time) AT TIME ZONE 'UTC',
+    ends_at = (end_date + end_time) AT TIME ZONE 'UTC'
+WHERE starts_at IS NULL;
+
+ALTER TABLE events ALTER COLUMN end_date SET NOT NULL;
+ALTER TABLE events ALTER COLUMN starts_at SET NOT NULL;
+ALTER TABLE events ALTER COLUMN ends_at SET NOT NULL;
+
+ALTER TABLE events ADD CONSTRAINT events_ends_after_starts CHECK (ends_at > starts_at);
+
+CREATE INDEX IF NOT EXISTS ix_events_status_starts_at ON events(status, starts_at);
+
+COMMIT;
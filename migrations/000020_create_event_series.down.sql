@@ -0,0 +1,8 @@
+BEGIN;
+
+DROP INDEX IF EXISTS ux_events_series_date;
+ALTER TABLE events DROP COLUMN IF EXISTS series_id;
+
+DROP TABLE IF EXISTS event_series;
+
+COMMIT;
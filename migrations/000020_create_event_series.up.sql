@@ -0,0 +1,20 @@
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS event_series (
+  id BIGSERIAL PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  rrule TEXT NOT NULL,
+  exdates DATE[] NOT NULL DEFAULT '{}', -- dates the rule skips
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS ix_event_series_user_id ON event_series(user_id);
+
+-- Occurrences are ordinary events; deleting the series keeps them as
+-- standalone events
+ALTER TABLE events ADD COLUMN IF NOT EXISTS series_id BIGINT REFERENCES event_series(id) ON DELETE SET NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS ux_events_series_date ON events(series_id, date) WHERE series_id IS NOT NULL;
+
+COMMIT;
@@ -0,0 +1,8 @@
+BEGIN;
+
+DROP INDEX IF EXISTS ix_events_venue_id;
+ALTER TABLE events DROP COLUMN IF EXISTS venue_id;
+
+DROP TABLE IF EXISTS venues;
+
+COMMIT;
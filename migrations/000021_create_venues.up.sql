@@ -0,0 +1,30 @@
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS venues (
+  id BIGSERIAL PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE, -- who added it and can change it
+  name TEXT NOT NULL,
+  address TEXT NOT NULL DEFAULT '',
+  latitude DOUBLE PRECISION,
+  longitude DOUBLE PRECISION,
+  timezone TEXT NOT NULL DEFAULT 'UTC',
+  capacity INTEGER NOT NULL CHECK (capacity > 0),
+  version INTEGER NOT NULL DEFAULT 1,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  CONSTRAINT venues_coordinates CHECK (
+    (latitude IS NULL) = (longitude IS NULL)
+    AND latitude BETWEEN -90 AND 90
+    AND longitude BETWEEN -180 AND 180
+  )
+);
+
+CREATE INDEX IF NOT EXISTS ix_venues_user_id ON venues(user_id);
+CREATE INDEX IF NOT EXISTS ix_venues_lower_name ON venues(lower(name));
+
+-- Venues with events cannot be deleted
+ALTER TABLE events ADD COLUMN IF NOT EXISTS venue_id BIGINT REFERENCES venues(id) ON DELETE RESTRICT;
+
+CREATE INDEX IF NOT EXISTS ix_events_venue_id ON events(venue_id);
+
+COMMIT;
@@ -0,0 +1,9 @@
+BEGIN;
+
+DROP INDEX IF EXISTS ix_events_latitude_longitude;
+
+ALTER TABLE events DROP CONSTRAINT IF EXISTS events_coordinates;
+ALTER TABLE events DROP COLUMN IF EXISTS longitude;
+ALTER TABLE events DROP COLUMN IF EXISTS latitude;
+
+COMMIT;
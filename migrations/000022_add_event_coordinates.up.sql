@@ -0,0 +1,21 @@
+BEGIN;
+
+ALTER TABLE events ADD COLUMN IF NOT EXISTS latitude DOUBLE PRECISION;
+ALTER TABLE events ADD COLUMN IF NOT EXISTS longitude DOUBLE PRECISION;
+
+ALTER TABLE events ADD CONSTRAINT events_coordinates CHECK (
+  (latitude IS NULL) = (longitude IS NULL)
+  AND latitude BETWEEN -90 AND 90
+  AND longitude BETWEEN -180 AND 180
+);
+
+-- Events at a venue start out at the venue's coordinates
+UPDATE events e
+SET latitude = v.latitude, longitude = v.longitude
+FROM venues v
+WHERE v.id = e.venue_id AND e.latitude IS NULL AND v.latitude IS NOT NULL;
+
+-- Serves the bounding box that narrows down searches by distance
+CREATE INDEX IF NOT EXISTS ix_events_latitude_longitude ON events(latitude, longitude) WHERE latitude IS NOT NULL;
+
+COMMIT;
@@ -0,0 +1,14 @@
+BEGIN;
+
+DROP INDEX IF EXISTS ix_tickets_event_revision_xid;
+
+CREATE OR REPLACE FUNCTION bump_ticket_revision() RETURNS trigger AS $$
+BEGIN
+  NEW.revision := nextval('ticket_revision_seq');
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+ALTER TABLE tickets DROP COLUMN IF EXISTS revision_xid;
+
+COMMIT;
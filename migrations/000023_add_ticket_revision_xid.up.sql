@@ -0,0 +1,19 @@
+BEGIN;
+
+-- Revisions are taken when a ticket is written, not when the transaction
+-- commits, so a scanner that synced past a revision could miss an earlier one
+-- committed later. Recording the writing transaction lets the manifest only
+-- hand out changes from transactions that have all finished.
+ALTER TABLE tickets ADD COLUMN IF NOT EXISTS revision_xid xid8 NOT NULL DEFAULT pg_current_xact_id();
+
+CREATE OR REPLACE FUNCTION bump_ticket_revision() RETURNS trigger AS $$
+BEGIN
+  NEW.revision := nextval('ticket_revision_seq');
+  NEW.revision_xid := pg_current_xact_id();
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE INDEX IF NOT EXISTS ix_tickets_event_revision_xid ON tickets(event_id, revision_xid, id);
+
+COMMIT;
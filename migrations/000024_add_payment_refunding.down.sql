@@ -0,0 +1,15 @@
+BEGIN;
+
+-- Enum values cannot be dropped, so the type is rebuilt without it
+UPDATE payments SET status = 'pending' WHERE status = 'refunding';
+
+ALTER TYPE payment_status RENAME TO payment_status_old;
+CREATE TYPE payment_status AS ENUM ('pending', 'succeeded', 'failed', 'refunded');
+
+ALTER TABLE payments ALTER COLUMN status DROP DEFAULT;
+ALTER TABLE payments ALTER COLUMN status TYPE payment_status USING status::text::payment_status;
+ALTER TABLE payments ALTER COLUMN status SET DEFAULT 'pending';
+
+DROP TYPE payment_status_old;
+
+COMMIT;
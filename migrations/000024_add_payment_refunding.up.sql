@@ -0,0 +1,4 @@
+-- A payment for a released reservation is claimed as refunding before the
+-- provider is asked to return it, so concurrent webhook deliveries cannot
+-- both refund it. ADD VALUE cannot be used in the transaction that adds it.
+ALTER TYPE payment_status ADD VALUE IF NOT EXISTS 'refunding' AFTER 'failed';
@@ -0,0 +1,5 @@
+BEGIN;
+
+ALTER TABLE reservations DROP COLUMN IF EXISTS secret_hash;
+
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN;
+
+-- Reservations made without signing in can only be paid for with the secret
+-- handed out when they were made. Only its SHA-256 hash is stored.
+ALTER TABLE reservations ADD COLUMN IF NOT EXISTS secret_hash BYTEA;
+
+COMMIT;
@@ -0,0 +1,165 @@
+// Package ticketverify checks signed tickets without contacting the API, so
+// door scanners can keep admitting people when they lose connectivity.
+//
+// A scanner downloads the public keys from GET /v1/keys while online, builds a
+// Verifier with ParseKeySet and then calls VerifyForEvent for every scan:
+//
+//	v, err := ticketverify.ParseKeySet(body)
+//	payload, err := v.VerifyForEvent(scanned, eventID)
+//
+// Keys are identified by a key id, so the API can rotate its signing key while
+// tickets signed with older keys keep verifying.
+package ticketverify
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// TokenPrefix marks and versions the signed ticket format:
+// tmt1.<key id>.<base64url payload>.<base64url signature>
+const TokenPrefix = "tmt1"
+
+var (
+	ErrMalformedToken   = errors.New("malformed ticket token")
+	ErrUnknownKey       = errors.New("ticket token signed with an unknown key")
+	ErrInvalidSignature = errors.New("ticket token signature is invalid")
+	ErrWrongEvent       = errors.New("ticket is for a different event")
+)
+
+// Payload is the signed content of a ticket.
+type Payload struct {
+	TicketID     int64  `json:"tid"`
+	EventID      int64  `json:"eid"`
+	TicketTypeID int64  `json:"ttid"`
+	Holder       string `json:"h"`
+	IssuedAt     int64  `json:"iat"` // unix seconds
+}
+
+// Key is an Ed25519 public key in JWK form (RFC 8037).
+type Key struct {
+	KeyType string `json:"kty"` // always "OKP"
+	Curve   string `json:"crv"` // always "Ed25519"
+	ID      string `json:"kid"`
+	X       string `json:"x"` // base64url public key
+}
+
+// KeySet is the document served by GET /v1/keys.
+type KeySet struct {
+	Keys []Key `json:"keys"`
+}
+
+// NewKey wraps an Ed25519 public key for publishing.
+func NewKey(id string, pub ed25519.PublicKey) Key {
+	return Key{
+		KeyType: "OKP",
+		Curve:   "Ed25519",
+		ID:      id,
+		X:       base64.RawURLEncoding.EncodeToString(pub),
+	}
+}
+
+// Sign produces a ticket token for payload with the private key keyID.
+func Sign(keyID string, priv ed25519.PrivateKey, payload Payload) (string, error) {
+	if keyID == "" || strings.Contains(keyID, ".") {
+		return "", fmt.Errorf("invalid key id %q", keyID)
+	}
+
+	js, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+
+	signed := TokenPrefix + "." + keyID + "." + base64.RawURLEncoding.EncodeToString(js)
+	signature := ed25519.Sign(priv, []byte(signed))
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// Verifier checks tokens against a fixed set of public keys.
+type Verifier struct {
+	keys map[string]ed25519.PublicKey
+}
+
+// NewVerifier builds a Verifier from published keys.
+func NewVerifier(keys ...Key) (*Verifier, error) {
+	v := &Verifier{keys: make(map[string]ed25519.PublicKey, len(keys))}
+
+	for _, k := range keys {
+		if k.KeyType != "OKP" || k.Curve != "Ed25519" {
+			return nil, fmt.Errorf("key %q is not an Ed25519 key", k.ID)
+		}
+
+		pub, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(pub) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("key %q has an invalid public key", k.ID)
+		}
+
+		v.keys[k.ID] = ed25519.PublicKey(pub)
+	}
+
+	return v, nil
+}
+
+// ParseKeySet builds a Verifier from the JSON body of GET /v1/keys.
+func ParseKeySet(data []byte) (*Verifier, error) {
+	var set KeySet
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+
+	return NewVerifier(set.Keys...)
+}
+
+// Verify checks the token's signature and returns its payload.
+func (v *Verifier) Verify(token string) (*Payload, error) {
+	parts := strings.Split(strings.TrimSpace(token), ".")
+	if len(parts) != 4 || parts[0] != TokenPrefix {
+		return nil, ErrMalformedToken
+	}
+
+	pub, ok := v.keys[parts[1]]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[3])
+	if err != nil {
+		return nil, ErrMalformedToken
+	}
+
+	signed := strings.Join(parts[:3], ".")
+	if !ed25519.Verify(pub, []byte(signed), signature) {
+		return nil, ErrInvalidSignature
+	}
+
+	js, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformedToken
+	}
+
+	var payload Payload
+	if err := json.Unmarshal(js, &payload); err != nil {
+		return nil, ErrMalformedToken
+	}
+
+	return &payload, nil
+}
+
+// VerifyForEvent is Verify plus a check that the ticket is for eventID.
+func (v *Verifier) VerifyForEvent(token string, eventID int64) (*Payload, error) {
+	payload, err := v.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if payload.EventID != eventID {
+		return payload, ErrWrongEvent
+	}
+
+	return payload, nil
+}
@@ -0,0 +1,130 @@
+package ticketverify
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func testKey(seed byte) ed25519.PrivateKey {
+	return ed25519.NewKeyFromSeed(bytes.Repeat([]byte{seed}, ed25519.SeedSize))
+}
+
+func public(priv ed25519.PrivateKey) ed25519.PublicKey {
+	return priv.Public().(ed25519.PublicKey)
+}
+
+func TestVerify(t *testing.T) {
+	oldKey, newKey, otherKey := testKey(1), testKey(2), testKey(3)
+
+	v, err := NewVerifier(NewKey("k1", public(oldKey)), NewKey("k2", public(newKey)))
+	if err != nil {
+		t.Fatalf("NewVerifier() error = %v", err)
+	}
+
+	payload := Payload{TicketID: 42, EventID: 7, TicketTypeID: 3, Holder: "Ada Obi", IssuedAt: 1_790_000_000}
+
+	sign := func(kid string, priv ed25519.PrivateKey) string {
+		token, err := Sign(kid, priv, payload)
+		if err != nil {
+			t.Fatalf("Sign(%q) error = %v", kid, err)
+		}
+		return token
+	}
+	valid := sign("k2", newKey)
+	parts := strings.Split(valid, ".")
+
+	tests := []struct {
+		name    string
+		token   string
+		eventID int64
+		wantErr error
+	}{
+		{"active key", valid, 7, nil},
+		{"surrounding whitespace", " " + valid + "\n", 7, nil},
+		{"rotated out key", sign("k1", oldKey), 7, nil},
+		{"wrong event", valid, 8, ErrWrongEvent},
+		{"unknown key id", sign("k9", otherKey), 7, ErrUnknownKey},
+		{"signed with another key", sign("k2", otherKey), 7, ErrInvalidSignature},
+		{"key id swapped", strings.Join([]string{parts[0], "k1", parts[2], parts[3]}, "."), 7, ErrInvalidSignature},
+		{"payload changed", strings.Join([]string{parts[0], parts[1], parts[2] + "A", parts[3]}, "."), 7, ErrInvalidSignature},
+		{"signature not base64", strings.Join([]string{parts[0], parts[1], parts[2], "!!"}, "."), 7, ErrMalformedToken},
+		{"wrong prefix", strings.Join([]string{"tmt0", parts[1], parts[2], parts[3]}, "."), 7, ErrMalformedToken},
+		{"missing part", strings.Join(parts[:3], "."), 7, ErrMalformedToken},
+		{"empty", "", 7, ErrMalformedToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := v.VerifyForEvent(tt.token, tt.eventID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("VerifyForEvent() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil && tt.wantErr != ErrWrongEvent {
+				return
+			}
+			if got == nil || *got != payload {
+				t.Errorf("VerifyForEvent() payload = %+v, want %+v", got, payload)
+			}
+		})
+	}
+}
+
+func TestSignInvalidKeyID(t *testing.T) {
+	for _, kid := range []string{"", "k.1"} {
+		if _, err := Sign(kid, testKey(1), Payload{}); err == nil {
+			t.Errorf("Sign(%q) error = nil, want an error", kid)
+		}
+	}
+}
+
+func TestNewVerifierInvalidKeys(t *testing.T) {
+	good := NewKey("k1", public(testKey(1)))
+
+	tests := []struct {
+		name string
+		key  Key
+	}{
+		{"wrong key type", Key{KeyType: "EC", Curve: good.Curve, ID: "k1", X: good.X}},
+		{"wrong curve", Key{KeyType: good.KeyType, Curve: "X25519", ID: "k1", X: good.X}},
+		{"not base64", Key{KeyType: good.KeyType, Curve: good.Curve, ID: "k1", X: "!!"}},
+		{"short key", Key{KeyType: good.KeyType, Curve: good.Curve, ID: "k1", X: good.X[:20]}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewVerifier(tt.key); err == nil {
+				t.Error("NewVerifier() error = nil, want an error")
+			}
+		})
+	}
+}
+
+func TestParseKeySet(t *testing.T) {
+	priv := testKey(1)
+
+	body, err := json.Marshal(KeySet{Keys: []Key{NewKey("k1", public(priv))}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := ParseKeySet(body)
+	if err != nil {
+		t.Fatalf("ParseKeySet() error = %v", err)
+	}
+
+	token, err := Sign("k1", priv, Payload{TicketID: 1, EventID: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Verify(token); err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+
+	if _, err := ParseKeySet([]byte("not json")); err == nil {
+		t.Error("ParseKeySet(invalid JSON) error = nil, want an error")
+	}
+}